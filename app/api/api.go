@@ -1,7 +1,11 @@
 package api
 
 import (
+	"context"
+	"log/slog"
+	"posto/app/config"
 	"posto/app/repositories"
+	"posto/app/services"
 )
 
 type ApiResponse[T any] struct {
@@ -12,17 +16,81 @@ type ApiResponse[T any] struct {
 }
 
 type Api struct {
-	Repositories  *repositories.Repositories
-	CollectionApi *CollectionApi
-	FileApi       *FileApi
+	Repositories   *repositories.Active
+	Executor       *services.Executor
+	CollectionApi  *CollectionApi
+	FileApi        *FileApi
+	EnvironmentApi *EnvironmentApi
+	MockServerApi  *MockServerApi
+	ExampleApi     *ExampleApi
+	ProxyApi       *ProxyApi
+	HistoryApi     *HistoryApi
+	MirrorApi      *MirrorApi
+	SearchApi      *SearchApi
+	RevisionApi    *RevisionApi
+	TrashApi       *TrashApi
+	BackupApi      *BackupApi
+	WorkspaceApi   *WorkspaceApi
+	SettingsApi    *SettingsApi
+	SecretApi      *SecretApi
+	LogApi         *LogApi
 }
 
-func NewApi(repositories *repositories.Repositories) *Api {
-	return &Api{
-		Repositories:  repositories,
-		CollectionApi: NewCollectionApi(repositories),
-		FileApi:       NewFileApi(repositories),
+func NewApi(repos *repositories.Repositories) *Api {
+	// the apis read the repositories through Active, which is swapped when
+	// another workspace is opened
+	repositories := repositories.NewActive(repos)
+	executor := services.NewExecutor(0)
+	if config.ConfigData != nil {
+		// the settings were validated on load, this only fails when a
+		// certificate file disappeared since
+		if err := executor.Configure(config.ConfigData.Settings); err != nil {
+			slog.Warn("Error applying request settings", "error", err)
+		}
 	}
+	api := &Api{
+		Repositories:   repositories,
+		Executor:       executor,
+		CollectionApi:  NewCollectionApi(repositories, executor),
+		FileApi:        NewFileApi(repositories, executor),
+		EnvironmentApi: NewEnvironmentApi(repositories),
+		MockServerApi:  NewMockServerApi(repositories),
+		ExampleApi:     NewExampleApi(repositories),
+		ProxyApi:       NewProxyApi(repositories),
+		HistoryApi:     NewHistoryApi(repositories),
+		MirrorApi:      NewMirrorApi(repositories),
+		SearchApi:      NewSearchApi(repositories),
+		RevisionApi:    NewRevisionApi(repositories),
+		TrashApi:       NewTrashApi(repositories),
+		BackupApi:      NewBackupApi(repositories),
+		SecretApi:      NewSecretApi(repositories),
+		LogApi:         NewLogApi(),
+	}
+	api.WorkspaceApi = NewWorkspaceApi(api)
+	api.SettingsApi = NewSettingsApi(repositories, executor, api.BackupApi.Scheduler)
+	return api
+}
+
+// Startup keeps the context of the window to emit events with.
+func (a *Api) Startup(ctx context.Context) {
+	a.FileApi.ctx = ctx
+}
+
+// Shutdown stops the background servers started from the UI, the mirror
+// watcher and the backup scheduler.
+func (a *Api) Shutdown() {
+	a.MockServerApi.MockServer.Stop()
+	a.ProxyApi.Proxy.Stop()
+	a.MirrorApi.Mirror.StopWatching()
+	a.BackupApi.Scheduler.Stop()
+}
+
+// restartBackground starts the mirror watcher and backup scheduler again
+// after Shutdown, with the mirrors of the current database.
+func (a *Api) restartBackground() {
+	a.MirrorApi.Mirror.ClearReports()
+	a.MirrorApi.Mirror.Watch(mirrorWatchInterval)
+	a.BackupApi.Scheduler.Start()
 }
 
 func (a *Api) Test() string {
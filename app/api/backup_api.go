@@ -0,0 +1,99 @@
+package api
+
+import (
+	"posto/app/config"
+	"posto/app/db"
+	"posto/app/models"
+	"posto/app/repositories"
+	"posto/app/services"
+)
+
+type BackupApi struct {
+	Repositories *repositories.Active
+	Scheduler    *services.BackupScheduler
+}
+
+func NewBackupApi(repositories *repositories.Active) *BackupApi {
+	interval, keep := config.DefaultBackupInterval, config.DefaultBackupKeep
+	if config.ConfigData != nil {
+		interval, keep = config.ConfigData.BackupInterval, config.ConfigData.BackupKeep
+	}
+	scheduler := services.NewBackupScheduler(interval, keep)
+	scheduler.Start()
+	return &BackupApi{Repositories: repositories, Scheduler: scheduler}
+}
+
+// CreateBackup backs up the database now. The oldest backups are deleted
+// beyond the configured number.
+func (b *BackupApi) CreateBackup() ApiResponse[models.Backup] {
+	resp := ApiResponse[models.Backup]{}
+
+	backup, err := b.Scheduler.BackupNow()
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Unable to back up the database"
+		resp.Data = backup
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Database backed up to " + backup.Path
+	resp.Data = backup
+	return resp
+}
+
+// SelectBackups lists the backups of the database, newest first.
+func (b *BackupApi) SelectBackups() ApiResponse[[]models.Backup] {
+	resp := ApiResponse[[]models.Backup]{}
+
+	backups, err := db.SelectBackups()
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to fetch backups"
+		resp.Data = []models.Backup{}
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Backups fetched successfully"
+	resp.Data = backups
+	return resp
+}
+
+// RestoreBackup replaces the database with the backup called name, as
+// listed by SelectBackups. The current database is backed up first.
+func (b *BackupApi) RestoreBackup(name string) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := db.RestoreBackup(name)
+	if err == nil {
+		err = b.Repositories.Load().Search.EnsureSearchIndex()
+	}
+	if err != nil {
+		resp.Message = "Unable to restore backup"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Backup restored"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
+
+// CheckIntegrity runs SQLite's integrity check on the database.
+func (b *BackupApi) CheckIntegrity() ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := db.CheckIntegrity()
+	if err != nil {
+		resp.Message = "Database integrity check failed"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Database is healthy"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
@@ -1,22 +1,26 @@
 package api
 
 import (
+	"fmt"
+	"os"
 	"posto/app/models"
 	"posto/app/repositories"
+	"posto/app/services"
 )
 
 type CollectionApi struct {
-	Repositories *repositories.Repositories
+	Repositories *repositories.Active
+	Executor     *services.Executor
 }
 
-func NewCollectionApi(repositories *repositories.Repositories) *CollectionApi {
-	return &CollectionApi{Repositories: repositories}
+func NewCollectionApi(repositories *repositories.Active, executor *services.Executor) *CollectionApi {
+	return &CollectionApi{Repositories: repositories, Executor: executor}
 }
 
 func (c *CollectionApi) SelectAllCollections() ApiResponse[[]models.Collection] {
 	resp := ApiResponse[[]models.Collection]{}
 
-	collections, err := c.Repositories.Collection.SelectAllCollections()
+	collections, err := c.Repositories.Load().Collection.SelectAllCollections()
 	if err != nil {
 		resp.Error = err.Error()
 		resp.Success = false
@@ -33,7 +37,7 @@ func (c *CollectionApi) SelectAllCollections() ApiResponse[[]models.Collection]
 func (c *CollectionApi) SelectAllCollectionsWithFilesNested() ApiResponse[[]repositories.CollectionJoinType] {
 	resp := ApiResponse[[]repositories.CollectionJoinType]{}
 
-	collections, err := c.Repositories.Collection.SelectAllCollectionsWithFilesNested()
+	collections, err := c.Repositories.Load().Collection.SelectAllCollectionsWithFilesNested()
 	if err != nil {
 		resp.Error = err.Error()
 		resp.Success = false
@@ -51,7 +55,7 @@ func (c *CollectionApi) SelectAllCollectionsWithFilesNested() ApiResponse[[]repo
 func (c *CollectionApi) SelectAllCollectionsWithFiles() ApiResponse[[]repositories.CollectionJoinFileType] {
 	resp := ApiResponse[[]repositories.CollectionJoinFileType]{}
 
-	collections, err := c.Repositories.Collection.SelectAllCollectionJoinFiles()
+	collections, err := c.Repositories.Load().Collection.SelectAllCollectionJoinFiles()
 	if err != nil {
 		resp.Error = err.Error()
 		resp.Success = false
@@ -68,7 +72,7 @@ func (c *CollectionApi) SelectAllCollectionsWithFiles() ApiResponse[[]repositori
 
 func (c *CollectionApi) InsertCollection(name string) ApiResponse[int] {
 	resp := ApiResponse[int]{}
-	id, err := c.Repositories.Collection.InsertCollection(name)
+	id, err := c.Repositories.Load().Collection.InsertCollection(name)
 	if err != nil {
 		resp.Error = err.Error()
 		resp.Message = "Unable to create the collection"
@@ -82,3 +86,276 @@ func (c *CollectionApi) InsertCollection(name string) ApiResponse[int] {
 
 	return resp
 }
+
+// RunCollection executes every request of a collection (or of one folder)
+// and evaluates their assertions.
+func (c *CollectionApi) RunCollection(options services.RunOptions) ApiResponse[services.RunResult] {
+	resp := ApiResponse[services.RunResult]{}
+
+	runner := services.NewCollectionRunner(c.Repositories.Load(), c.Executor)
+	result, err := runner.Run(options)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to run collection"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = fmt.Sprintf("%d of %d requests passed", result.Passed, result.Total)
+	resp.Data = result
+	return resp
+}
+
+// WriteRunReport saves the result of RunCollection as a junit, json or html
+// report at path.
+func (c *CollectionApi) WriteRunReport(result services.RunResult, format string, path string) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+
+	err := services.WriteRunReport(result, format, path)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to write report"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Report written successfully"
+	resp.Data = true
+	return resp
+}
+
+// ExportCollection writes the collection as a JSON bundle to path. Secret
+// variables are written empty and requests redacted unless includeSecrets
+// is set.
+func (c *CollectionApi) ExportCollection(collectionId int, path string, includeEnvironments bool, includeSecrets bool) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+
+	bundle, err := services.ExportCollectionBundle(c.Repositories.Load(), collectionId, includeEnvironments, includeSecrets)
+	if err == nil {
+		err = services.WriteCollectionBundle(path, bundle)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to export collection"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Collection exported successfully"
+	resp.Data = true
+	return resp
+}
+
+// ImportCollection creates a new collection from a JSON bundle at path.
+func (c *CollectionApi) ImportCollection(path string) ApiResponse[int] {
+	resp := ApiResponse[int]{Data: -1}
+
+	bundle, err := services.ReadCollectionBundle(path)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to read collection file"
+		return resp
+	}
+
+	id, err := services.ImportCollectionBundle(c.Repositories.Load(), bundle)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to import collection"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Collection imported successfully"
+	resp.Data = id
+	return resp
+}
+
+// ImportHar creates a new collection from the entries of a HAR file.
+func (c *CollectionApi) ImportHar(path string, options services.HarImporter) ApiResponse[services.ImportReport] {
+	return c.runImport(&options, path)
+}
+
+// ImportFrom imports a third party export (har, insomnia, bruno or http)
+// found at path, or a directory written by ExportDirectory. Bruno
+// collections are imported from their directory.
+func (c *CollectionApi) ImportFrom(format string, path string) ApiResponse[services.ImportReport] {
+	importer, err := services.ImporterFor(format)
+	if err != nil {
+		return ApiResponse[services.ImportReport]{
+			Success: false,
+			Message: "Unsupported import format",
+			Error:   err.Error(),
+		}
+	}
+	return c.runImport(importer, path)
+}
+
+func (c *CollectionApi) runImport(importer services.Importer, path string) ApiResponse[services.ImportReport] {
+	resp := ApiResponse[services.ImportReport]{}
+
+	report, err := services.RunImport(c.Repositories.Load(), importer, path)
+	resp.Data = report
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to import " + importer.Format()
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = fmt.Sprintf("%d requests imported", report.Requests)
+	if len(report.Warnings) > 0 {
+		resp.Message += fmt.Sprintf(" with %d warnings", len(report.Warnings))
+	}
+	return resp
+}
+
+// ExportRunAsHar writes the requests of a collection run as a HAR 1.2 file.
+func (c *CollectionApi) ExportRunAsHar(result services.RunResult, path string) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+
+	err := services.WriteHar(path, services.RunResultToHar(result))
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to export run"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Run exported successfully"
+	resp.Data = true
+	return resp
+}
+
+// ExportHttpFile writes the requests of a collection as a REST Client .http
+// file. With environmentId its variables are written as @variables.
+func (c *CollectionApi) ExportHttpFile(collectionId int, path string, environmentId *int) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	repos := c.Repositories.Load()
+
+	var environment *models.Environment
+	if environmentId != nil {
+		selected, err := repos.Environment.SelectEnvironmentById(*environmentId)
+		if err != nil {
+			resp.Error = err.Error()
+			resp.Success = false
+			resp.Message = "Failed to load environment"
+			return resp
+		}
+		environment = &selected
+	}
+
+	content, err := services.ExportHttpFile(repos, collectionId, environment)
+	if err == nil {
+		err = os.WriteFile(path, []byte(content), 0644)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to export .http file"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Collection exported successfully"
+	resp.Data = true
+	return resp
+}
+
+// ExportDirectory writes a collection as one JSON file per request with a
+// directory per folder, see MirrorApi to keep the directory in sync.
+func (c *CollectionApi) ExportDirectory(collectionId int, path string) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+
+	err := services.ExportCollectionDirectory(c.Repositories.Load(), collectionId, path)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to export collection"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Collection exported successfully"
+	resp.Data = true
+	return resp
+}
+
+// ExportDocs writes browsable documentation of a collection to dir: a
+// static index.html and a README.md.
+func (c *CollectionApi) ExportDocs(collectionId int, dir string) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+
+	err := services.ExportCollectionDocs(c.Repositories.Load(), collectionId, dir)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to export documentation"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Documentation exported successfully"
+	resp.Data = true
+	return resp
+}
+
+// ExportOpenApi writes an OpenAPI 3 document inferred from the requests and
+// saved examples of a collection. With environmentId its variables are used
+// as server defaults and parameter examples.
+func (c *CollectionApi) ExportOpenApi(collectionId int, path string, environmentId *int) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	repos := c.Repositories.Load()
+
+	var environment *models.Environment
+	if environmentId != nil {
+		selected, err := repos.Environment.SelectEnvironmentById(*environmentId)
+		if err != nil {
+			resp.Error = err.Error()
+			resp.Success = false
+			resp.Message = "Failed to load environment"
+			return resp
+		}
+		environment = &selected
+	}
+
+	document, err := services.ExportOpenApiDocument(repos, collectionId, environment)
+	if err == nil {
+		err = services.WriteOpenApiDocument(path, document)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to export OpenAPI document"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "OpenAPI document exported successfully"
+	resp.Data = true
+	return resp
+}
+
+// UpdateCollectionDescription sets the Markdown description of a
+// collection. Folder and request descriptions are set with
+// FileApi.UpdateFile.
+func (c *CollectionApi) UpdateCollectionDescription(collectionId int, description string) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := c.Repositories.Load().Collection.UpdateCollectionDescription(collectionId, description)
+	if err != nil {
+		resp.Message = "Unable to update description"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Description updated successfully"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
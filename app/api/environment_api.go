@@ -0,0 +1,125 @@
+package api
+
+import (
+	"posto/app/models"
+	"posto/app/repositories"
+	"posto/app/services"
+)
+
+type EnvironmentApi struct {
+	Repositories *repositories.Active
+}
+
+func NewEnvironmentApi(repositories *repositories.Active) *EnvironmentApi {
+	return &EnvironmentApi{Repositories: repositories}
+}
+
+// SelectAllEnvironments returns the environments with the values of secret
+// variables masked, see services.SecretMask.
+func (e *EnvironmentApi) SelectAllEnvironments() ApiResponse[[]models.Environment] {
+	resp := ApiResponse[[]models.Environment]{}
+
+	environments, err := e.Repositories.Load().Environment.SelectAllEnvironments()
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to fetch environments"
+		resp.Data = []models.Environment{}
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Environments fetched successfully"
+	resp.Data = services.MaskEnvironments(environments)
+	return resp
+}
+
+func (e *EnvironmentApi) InsertEnvironment(name string, variables []models.Variable) ApiResponse[int] {
+	resp := ApiResponse[int]{}
+	variables, err := services.SealVariables(variables, nil)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Message = "Unable to store secret variables"
+		resp.Success = false
+		resp.Data = -1
+		return resp
+	}
+	id, err := e.Repositories.Load().Environment.InsertEnvironment(name, variables)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Message = "Unable to create the environment"
+		resp.Success = false
+		resp.Data = -1
+	} else {
+		resp.Message = "Environment created successfully"
+		resp.Success = true
+		resp.Data = id
+	}
+
+	return resp
+}
+
+// UpdateEnvironment saves the variables of an environment. Secret variables
+// still holding services.SecretMask keep their value, a renamed secret has
+// to be entered again.
+func (e *EnvironmentApi) UpdateEnvironment(id int, name string, variables []models.Variable) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	repos := e.Repositories.Load()
+	previous, err := repos.Environment.SelectEnvironmentById(id)
+	if err != nil {
+		resp.Message = "Unable to update environment"
+		resp.Error = err.Error()
+		resp.Success = false
+		return resp
+	}
+	variables, err = services.SealVariables(variables, previous.Variables)
+	if err != nil {
+		resp.Message = "Unable to store secret variables"
+		resp.Error = err.Error()
+		resp.Success = false
+		return resp
+	}
+	err = repos.Environment.UpdateEnvironment(id, name, variables)
+	if err != nil {
+		resp.Message = "Unable to update environment"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Environment updated successfully"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
+
+func (e *EnvironmentApi) DeleteEnvironment(id int) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := e.Repositories.Load().Environment.DeleteEnvironment(id)
+	if err != nil {
+		resp.Message = "Unable to delete environment"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Environment deleted successfully"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
+
+// SetActiveEnvironment selects the environment whose variables are used by
+// SendRequest. Passing nil deactivates all environments.
+func (e *EnvironmentApi) SetActiveEnvironment(id *int) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := e.Repositories.Load().Environment.SetActiveEnvironment(id)
+	if err != nil {
+		resp.Message = "Unable to change active environment"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Active environment changed successfully"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
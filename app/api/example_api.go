@@ -0,0 +1,90 @@
+package api
+
+import (
+	"posto/app/models"
+	"posto/app/repositories"
+)
+
+type ExampleApi struct {
+	Repositories *repositories.Active
+}
+
+func NewExampleApi(repositories *repositories.Active) *ExampleApi {
+	return &ExampleApi{Repositories: repositories}
+}
+
+func (e *ExampleApi) SelectExamples(fileId int) ApiResponse[[]models.Example] {
+	resp := ApiResponse[[]models.Example]{}
+
+	examples, err := e.Repositories.Load().Example.SelectExamplesByFile(fileId)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to fetch examples"
+		resp.Data = []models.Example{}
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Examples fetched successfully"
+	resp.Data = examples
+	return resp
+}
+
+// SaveResponseAsExample stores a response returned by FileApi.SendRequest as
+// a named example of the request.
+func (e *ExampleApi) SaveResponseAsExample(fileId int, name string, response models.HttpResponse) ApiResponse[int] {
+	resp := ApiResponse[int]{}
+
+	id, err := e.Repositories.Load().Example.InsertExample(models.Example{
+		FileId:      int64(fileId),
+		Name:        name,
+		StatusCode:  response.StatusCode,
+		ContentType: response.ContentType,
+		Headers:     response.Headers,
+		Body:        response.Body,
+		IsBinary:    response.IsBinary,
+	})
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Message = "Unable to save the example"
+		resp.Success = false
+		resp.Data = -1
+	} else {
+		resp.Message = "Example saved successfully"
+		resp.Success = true
+		resp.Data = id
+	}
+
+	return resp
+}
+
+func (e *ExampleApi) UpdateExample(id int, example models.Example) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := e.Repositories.Load().Example.UpdateExample(id, example)
+	if err != nil {
+		resp.Message = "Unable to update example"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Example updated successfully"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
+
+func (e *ExampleApi) DeleteExample(id int) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := e.Repositories.Load().Example.DeleteExample(id)
+	if err != nil {
+		resp.Message = "Unable to delete example"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Example deleted successfully"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
@@ -1,36 +1,36 @@
 package api
 
 import (
-	"encoding/base64"
-	"encoding/json"
-	"io"
-	"net/http"
+	"context"
+	"errors"
+	"log/slog"
+	"posto/app/models"
 	"posto/app/repositories"
-	"strings"
+	"posto/app/services"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
-type FileApi struct {
-	Repositories *repositories.Repositories
-}
+// ResponseProgressEvent is emitted with a models.ResponseProgress while
+// the body of a response is received.
+const ResponseProgressEvent = "response:progress"
 
-func NewFileApi(repositories *repositories.Repositories) *FileApi {
-	return &FileApi{Repositories: repositories}
+type FileApi struct {
+	Repositories *repositories.Active
+	Executor     *services.Executor
+	// ctx is the context of the window, nil until the app started, which
+	// events are emitted with.
+	ctx context.Context
 }
 
-// HttpResponse is the structured result returned to the frontend after an HTTP request.
-type HttpResponse struct {
-	StatusCode  int    `json:"status_code"`
-	ContentType string `json:"content_type"`
-	// Body holds the response body as a UTF-8 string (JSON / plain text) or
-	// a base64-encoded string when IsBinary is true.
-	Body     string `json:"body"`
-	IsBinary bool   `json:"is_binary"`
+func NewFileApi(repositories *repositories.Active, executor *services.Executor) *FileApi {
+	return &FileApi{Repositories: repositories, Executor: executor}
 }
 
 func (f *FileApi) CreateFileOrFolder(param repositories.FileCreationParam) ApiResponse[*int] {
 	resp := ApiResponse[*int]{}
 
-	fileId, err := f.Repositories.File.CreateFileOrFolder(param)
+	fileId, err := f.Repositories.Load().File.CreateFileOrFolder(param)
 	if err != nil {
 		resp.Error = err.Error()
 		resp.Success = false
@@ -44,9 +44,11 @@ func (f *FileApi) CreateFileOrFolder(param repositories.FileCreationParam) ApiRe
 	return resp
 }
 
+// UpdateFile saves a request or folder. Saves of requests are kept as
+// revisions, see RevisionApi.
 func (f *FileApi) UpdateFile(fileId int, requestData repositories.FileRequestData) ApiResponse[bool] {
 	resp := ApiResponse[bool]{Data: false}
-	err := f.Repositories.File.UpdateFile(fileId, requestData)
+	err := services.SaveRequest(f.Repositories.Load(), fileId, requestData, true)
 	if err != nil {
 		resp.Message = "Unable to update data"
 		resp.Error = err.Error()
@@ -62,7 +64,7 @@ func (f *FileApi) UpdateFile(fileId int, requestData repositories.FileRequestDat
 func (f *FileApi) GetRequestData(fileId int) ApiResponse[repositories.FileRequestData] {
 	resp := ApiResponse[repositories.FileRequestData]{}
 
-	data, err := f.Repositories.File.GetRequestData(fileId)
+	data, err := f.Repositories.Load().File.GetRequestData(fileId)
 
 	if err != nil {
 		resp.Message = "Unable to fetch Api data"
@@ -78,12 +80,15 @@ func (f *FileApi) GetRequestData(fileId int) ApiResponse[repositories.FileReques
 }
 
 // SendRequest fetches the stored request data for the given fileId and executes
-// the HTTP call. The result is returned as an ApiResponse[HttpResponse].
-func (f *FileApi) SendRequest(fileId int) ApiResponse[HttpResponse] {
-	resp := ApiResponse[HttpResponse]{}
+// the HTTP call with the variables of the active environment. The result is
+// returned as an ApiResponse[HttpResponse]. When the request fails Data
+// still holds what went over the wire.
+func (f *FileApi) SendRequest(fileId int) ApiResponse[models.HttpResponse] {
+	resp := ApiResponse[models.HttpResponse]{}
+	repos := f.Repositories.Load()
 
 	// 1. Load the stored request from the DB.
-	data, err := f.Repositories.File.GetRequestData(fileId)
+	data, err := repos.File.GetRequestData(fileId)
 	if err != nil {
 		resp.Success = false
 		resp.Message = "Failed to load request data"
@@ -91,83 +96,84 @@ func (f *FileApi) SendRequest(fileId int) ApiResponse[HttpResponse] {
 		return resp
 	}
 
-	url := ""
-	if data.Url != nil {
-		url = *data.Url
-	}
-	if url == "" {
-		resp.Success = false
-		resp.Message = "URL is empty"
-		return resp
-	}
-
-	method := "GET"
-	if data.Method != nil && *data.Method != "" {
-		method = *data.Method
-	}
-
-	// 2. Build the request body (for non-GET requests).
-	var bodyReader io.Reader
-	if method != "GET" && data.Body != nil && *data.Body != "" {
-		bodyReader = strings.NewReader(*data.Body)
-	}
-
-	req, err := http.NewRequest(method, url, bodyReader)
+	// 2. Resolve variables from the active environment.
+	vars := map[string]string{}
+	secretValues := []string{}
+	environment, err := repos.Environment.SelectActiveEnvironment()
 	if err != nil {
 		resp.Success = false
-		resp.Message = "Failed to build HTTP request"
+		resp.Message = "Failed to load active environment"
 		resp.Error = err.Error()
 		return resp
 	}
-
-	// 3. Apply stored headers.
-	req.Header.Set("Content-Type", "application/json")
-	if data.Headers != nil && *data.Headers != "" {
-		var headers map[string]string
-		if jsonErr := json.Unmarshal([]byte(*data.Headers), &headers); jsonErr == nil {
-			for k, v := range headers {
-				req.Header.Set(k, v)
-			}
+	if environment != nil {
+		vars, secretValues, err = services.RevealVariables(*environment)
+		if err != nil {
+			resp.Success = false
+			resp.Message = "Failed to resolve secret variables"
+			resp.Error = err.Error()
+			return resp
 		}
 	}
 
-	// 4. Execute the request.
-	client := &http.Client{}
-	httpResp, err := client.Do(req)
-	if err != nil {
-		resp.Success = false
-		resp.Message = "HTTP request failed"
-		resp.Error = err.Error()
-		return resp
+	// 3. Execute the request and keep it in the history, with the secrets
+	// masked. A failing history write must not hide the response from the
+	// user.
+	progress := func(received int64, total int64, done bool) {
+		if f.ctx != nil {
+			runtime.EventsEmit(f.ctx, ResponseProgressEvent, models.ResponseProgress{FileId: fileId, Received: received, Total: total, Done: done})
+		}
+	}
+	sent, httpResult, err := f.Executor.SendWith(data, vars, services.SendOptions{Secrets: secretValues, Progress: progress})
+	if sent.Method != "" {
+		fileIdRef := int64(fileId)
+		if _, historyErr := repos.History.InsertHistory(services.NewHistoryEntry(&fileIdRef, sent, httpResult, err)); historyErr != nil {
+			slog.Warn("Error saving history", "error", historyErr)
+		}
 	}
-	defer httpResp.Body.Close()
-
-	bodyBytes, err := io.ReadAll(httpResp.Body)
 	if err != nil {
 		resp.Success = false
-		resp.Message = "Failed to read response body"
-		resp.Error = err.Error()
+		resp.Data = httpResult
+		setRequestError(&resp, err)
 		return resp
 	}
 
-	contentType := httpResp.Header.Get("Content-Type")
+	resp.Success = true
+	resp.Message = "Request completed"
+	resp.Data = httpResult
+	return resp
+}
 
-	httpResult := HttpResponse{
-		StatusCode:  httpResp.StatusCode,
-		ContentType: contentType,
-	}
+// SaveResponseBody writes the whole body of a truncated response, named by
+// its body_id, to path.
+func (f *FileApi) SaveResponseBody(bodyId string, path string) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
 
-	// Treat JSON and text responses as plain strings; everything else as base64.
-	if strings.Contains(contentType, "application/json") || strings.Contains(contentType, "text/") {
-		httpResult.Body = string(bodyBytes)
-		httpResult.IsBinary = false
-	} else {
-		httpResult.Body = base64.StdEncoding.EncodeToString(bodyBytes)
-		httpResult.IsBinary = true
+	err := f.Executor.Bodies.SaveTo(bodyId, path)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to save response body"
+		return resp
 	}
 
 	resp.Success = true
-	resp.Message = "Request completed"
-	resp.Data = httpResult
+	resp.Message = "Response body saved successfully"
+	resp.Data = true
 	return resp
 }
+
+// setRequestError fills Message/Error from a services.RequestError so the
+// frontend keeps seeing which stage of the request failed.
+func setRequestError[T any](resp *ApiResponse[T], err error) {
+	var reqErr *services.RequestError
+	if errors.As(err, &reqErr) {
+		resp.Message = reqErr.Message
+		if reqErr.Err != nil {
+			resp.Error = reqErr.Err.Error()
+		}
+		return
+	}
+	resp.Message = "HTTP request failed"
+	resp.Error = err.Error()
+}
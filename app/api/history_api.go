@@ -0,0 +1,72 @@
+package api
+
+import (
+	"posto/app/models"
+	"posto/app/repositories"
+	"posto/app/services"
+)
+
+type HistoryApi struct {
+	Repositories *repositories.Active
+}
+
+func NewHistoryApi(repositories *repositories.Active) *HistoryApi {
+	return &HistoryApi{Repositories: repositories}
+}
+
+// SelectHistory returns the latest sent requests, newest first. A limit <= 0
+// returns the whole history.
+func (h *HistoryApi) SelectHistory(limit int) ApiResponse[[]models.HistoryEntry] {
+	resp := ApiResponse[[]models.HistoryEntry]{}
+
+	entries, err := h.Repositories.Load().History.SelectHistory(limit)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to fetch history"
+		resp.Data = []models.HistoryEntry{}
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "History fetched successfully"
+	resp.Data = entries
+	return resp
+}
+
+func (h *HistoryApi) ClearHistory() ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := h.Repositories.Load().History.DeleteAllHistory()
+	if err != nil {
+		resp.Message = "Unable to clear history"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "History cleared"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
+
+// ExportHistoryAsHar writes the latest limit history entries (all when
+// limit <= 0) as a HAR 1.2 file.
+func (h *HistoryApi) ExportHistoryAsHar(path string, limit int) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+
+	entries, err := h.Repositories.Load().History.SelectHistory(limit)
+	if err == nil {
+		err = services.WriteHar(path, services.HistoryToHar(entries))
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to export history"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "History exported successfully"
+	resp.Data = true
+	return resp
+}
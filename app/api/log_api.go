@@ -0,0 +1,63 @@
+package api
+
+import (
+	"fmt"
+	"posto/app/config"
+	"posto/app/logging"
+	"posto/app/models"
+)
+
+type LogApi struct{}
+
+func NewLogApi() *LogApi {
+	return &LogApi{}
+}
+
+// SelectLogTail returns the last lines of the log, at most
+// logging.MaxTailLines, all of them when lines is 0.
+func (l *LogApi) SelectLogTail(lines int) ApiResponse[models.LogTail] {
+	resp := ApiResponse[models.LogTail]{}
+
+	tail, err := logging.Tail(lines)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to read the log"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Log fetched successfully"
+	resp.Data = models.LogTail{Path: logging.Path(), Lines: tail, Debug: logging.Debug()}
+	return resp
+}
+
+// SetDebugLogging turns the logging of request and response headers and
+// bodies on or off right away, and saves it as debug_logging.
+func (l *LogApi) SetDebugLogging(enabled bool) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+
+	if env, ok := config.ConfigData.SettingsInfo().Overrides["debug_logging"]; ok {
+		resp.Message = "Unable to change debug logging"
+		resp.Error = "debug logging is set by " + env
+		resp.Success = false
+		return resp
+	}
+	settings := config.ConfigData.Settings
+	settings.DebugLogging = enabled
+	problems, err := config.ConfigData.UpdateSettings(settings)
+	if err == nil && len(problems) > 0 {
+		err = fmt.Errorf("%s", config.FormatProblems(problems))
+	}
+	if err != nil {
+		resp.Message = "Unable to change debug logging"
+		resp.Error = err.Error()
+		resp.Success = false
+		return resp
+	}
+
+	resp.Message = "Debug logging updated"
+	resp.Success = true
+	resp.Data = true
+	return resp
+}
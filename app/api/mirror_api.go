@@ -0,0 +1,116 @@
+package api
+
+import (
+	"posto/app/repositories"
+	"posto/app/services"
+	"time"
+)
+
+// mirrorWatchInterval is how often mirror directories are checked for
+// edits made outside the app.
+const mirrorWatchInterval = 2 * time.Second
+
+type MirrorApi struct {
+	Repositories *repositories.Active
+	Mirror       *services.CollectionMirror
+}
+
+func NewMirrorApi(repositories *repositories.Active) *MirrorApi {
+	mirror := services.NewCollectionMirror(repositories)
+	mirror.Watch(mirrorWatchInterval)
+	return &MirrorApi{Repositories: repositories, Mirror: mirror}
+}
+
+// LinkMirror keeps a collection in sync with a directory, e.g. inside a git
+// repository. Requests already in the directory are imported.
+func (m *MirrorApi) LinkMirror(collectionId int, path string) ApiResponse[services.MirrorSyncReport] {
+	resp := ApiResponse[services.MirrorSyncReport]{}
+
+	report, err := m.Mirror.Link(collectionId, path)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to mirror collection"
+		resp.Data = report
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Collection mirrored to " + report.Path
+	resp.Data = report
+	return resp
+}
+
+func (m *MirrorApi) UnlinkMirror(collectionId int) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := m.Mirror.Unlink(collectionId)
+	if err != nil {
+		resp.Message = "Unable to stop mirroring collection"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Collection is no longer mirrored"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
+
+// SyncMirror syncs a collection right away instead of waiting for the
+// watcher.
+func (m *MirrorApi) SyncMirror(collectionId int) ApiResponse[services.MirrorSyncReport] {
+	resp := ApiResponse[services.MirrorSyncReport]{}
+
+	report, err := m.Mirror.Sync(collectionId)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to sync collection"
+		resp.Data = report
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Collection synced"
+	resp.Data = report
+	return resp
+}
+
+// ResolveMirrorConflict keeps either the "app" or the "disk" version of a
+// conflicting request or folder.
+func (m *MirrorApi) ResolveMirrorConflict(collectionId int, fileId int64, keep string) ApiResponse[services.MirrorSyncReport] {
+	resp := ApiResponse[services.MirrorSyncReport]{}
+
+	report, err := m.Mirror.Resolve(collectionId, fileId, keep)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to resolve conflict"
+		resp.Data = report
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Conflict resolved"
+	resp.Data = report
+	return resp
+}
+
+// GetMirrorStatus returns the mirrored collections with the last report of
+// the watcher, including unresolved conflicts.
+func (m *MirrorApi) GetMirrorStatus() ApiResponse[services.MirrorStatus] {
+	resp := ApiResponse[services.MirrorStatus]{}
+
+	status, err := m.Mirror.Status()
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to fetch mirror status"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Mirror status fetched successfully"
+	resp.Data = status
+	return resp
+}
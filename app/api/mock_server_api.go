@@ -0,0 +1,103 @@
+package api
+
+import (
+	"posto/app/models"
+	"posto/app/repositories"
+	"posto/app/services"
+)
+
+type MockServerApi struct {
+	Repositories *repositories.Active
+	MockServer   *services.MockServer
+}
+
+func NewMockServerApi(repositories *repositories.Active) *MockServerApi {
+	return &MockServerApi{
+		Repositories: repositories,
+		MockServer:   services.NewMockServer(repositories),
+	}
+}
+
+// StartMockServer serves the mock responses of a collection on the given
+// port of 127.0.0.1. A running mock server is restarted.
+func (m *MockServerApi) StartMockServer(collectionId int, port int) ApiResponse[services.MockServerStatus] {
+	resp := ApiResponse[services.MockServerStatus]{}
+
+	status, err := m.MockServer.Start(services.MockServerOptions{CollectionId: collectionId, Port: port})
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to start mock server"
+		resp.Data = status
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Mock server started at " + status.Address
+	resp.Data = status
+	return resp
+}
+
+func (m *MockServerApi) StopMockServer() ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := m.MockServer.Stop()
+	if err != nil {
+		resp.Message = "Unable to stop mock server"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Mock server stopped"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
+
+// ReloadMockServer picks up edited urls and mock responses without
+// restarting the server.
+func (m *MockServerApi) ReloadMockServer() ApiResponse[services.MockServerStatus] {
+	resp := ApiResponse[services.MockServerStatus]{}
+
+	status, err := m.MockServer.Reload()
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to reload mock server"
+		resp.Data = status
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Mock server reloaded"
+	resp.Data = status
+	return resp
+}
+
+func (m *MockServerApi) GetMockServerStatus() ApiResponse[services.MockServerStatus] {
+	return ApiResponse[services.MockServerStatus]{
+		Success: true,
+		Message: "Mock server status fetched successfully",
+		Data:    m.MockServer.Status(),
+	}
+}
+
+func (m *MockServerApi) GetMockRoutes() ApiResponse[[]services.MockRoute] {
+	return ApiResponse[[]services.MockRoute]{
+		Success: true,
+		Message: "Mock routes fetched successfully",
+		Data:    m.MockServer.Routes(),
+	}
+}
+
+func (m *MockServerApi) GetMockRequestLog() ApiResponse[[]models.MockRequestLog] {
+	return ApiResponse[[]models.MockRequestLog]{
+		Success: true,
+		Message: "Mock request log fetched successfully",
+		Data:    m.MockServer.RequestLog(),
+	}
+}
+
+func (m *MockServerApi) ClearMockRequestLog() ApiResponse[bool] {
+	m.MockServer.ClearRequestLog()
+	return ApiResponse[bool]{Success: true, Message: "Mock request log cleared", Data: true}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"posto/app/config"
+	"posto/app/models"
+	"posto/app/repositories"
+	"posto/app/services"
+)
+
+type ProxyApi struct {
+	Repositories *repositories.Active
+	Proxy        *services.RecordingProxy
+}
+
+func NewProxyApi(repositories *repositories.Active) *ProxyApi {
+	caDir := ""
+	if config.ConfigData != nil {
+		caDir = config.ConfigData.Dir
+	}
+	return &ProxyApi{
+		Repositories: repositories,
+		Proxy:        services.NewRecordingProxy(caDir),
+	}
+}
+
+// StartProxy listens for proxied traffic on 0.0.0.0 so other devices such as
+// phones on the same network can use it. With interceptHttps the local CA
+// certificate (see ExportCACertificate) must be trusted by the client.
+func (p *ProxyApi) StartProxy(port int, interceptHttps bool) ApiResponse[services.ProxyStatus] {
+	resp := ApiResponse[services.ProxyStatus]{}
+
+	status, err := p.Proxy.Start(services.ProxyOptions{Host: "0.0.0.0", Port: port, InterceptHttps: interceptHttps})
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to start proxy"
+		resp.Data = status
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Proxy listening on " + status.Address
+	resp.Data = status
+	return resp
+}
+
+func (p *ProxyApi) StopProxy() ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := p.Proxy.Stop()
+	if err != nil {
+		resp.Message = "Unable to stop proxy"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Proxy stopped"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
+
+func (p *ProxyApi) GetProxyStatus() ApiResponse[services.ProxyStatus] {
+	return ApiResponse[services.ProxyStatus]{
+		Success: true,
+		Message: "Proxy status fetched successfully",
+		Data:    p.Proxy.Status(),
+	}
+}
+
+func (p *ProxyApi) GetCaptures() ApiResponse[[]models.ProxyCapture] {
+	return ApiResponse[[]models.ProxyCapture]{
+		Success: true,
+		Message: "Captures fetched successfully",
+		Data:    p.Proxy.Captures(),
+	}
+}
+
+func (p *ProxyApi) ClearCaptures() ApiResponse[bool] {
+	p.Proxy.ClearCaptures()
+	return ApiResponse[bool]{Success: true, Message: "Captures cleared", Data: true}
+}
+
+// SaveCaptures creates a request file for every selected capture in the
+// collection, inside the folder parentId when given. Nothing is saved when
+// one of them fails.
+func (p *ProxyApi) SaveCaptures(captureIds []int64, collectionId int, parentId *int) ApiResponse[[]int] {
+	resp := ApiResponse[[]int]{Data: []int{}}
+
+	captures := []models.ProxyCapture{}
+	for _, id := range captureIds {
+		capture, ok := p.Proxy.Capture(id)
+		if !ok {
+			resp.Error = fmt.Sprintf("capture %d not found", id)
+			resp.Success = false
+			resp.Message = "Failed to save captures"
+			return resp
+		}
+		captures = append(captures, capture)
+	}
+
+	fileIds, err := services.SaveProxyCaptures(p.Repositories.Load(), captures, collectionId, parentId)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to save captures"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Data = fileIds
+	resp.Message = fmt.Sprintf("%d requests saved", len(fileIds))
+	return resp
+}
+
+// ExportCACertificate writes the proxy CA certificate (PEM) to path so it can
+// be installed on the device whose HTTPS traffic should be recorded.
+func (p *ProxyApi) ExportCACertificate(path string) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+
+	ca, err := p.Proxy.CA()
+	if err == nil {
+		err = os.WriteFile(path, ca.CertificatePEM(), 0644)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to export CA certificate"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "CA certificate exported successfully"
+	resp.Data = true
+	return resp
+}
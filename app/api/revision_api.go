@@ -0,0 +1,78 @@
+package api
+
+import (
+	"fmt"
+	"posto/app/models"
+	"posto/app/repositories"
+	"posto/app/services"
+)
+
+type RevisionApi struct {
+	Repositories *repositories.Active
+}
+
+func NewRevisionApi(repositories *repositories.Active) *RevisionApi {
+	return &RevisionApi{Repositories: repositories}
+}
+
+// SelectRevisions returns the saved states of a request, newest first. The
+// newest revision is the current state once the request has been saved.
+func (r *RevisionApi) SelectRevisions(fileId int) ApiResponse[[]models.Revision] {
+	resp := ApiResponse[[]models.Revision]{}
+
+	revisions, err := r.Repositories.Load().Revision.SelectRevisionsByFile(fileId)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to fetch revisions"
+		resp.Data = []models.Revision{}
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Revisions fetched successfully"
+	resp.Data = revisions
+	return resp
+}
+
+// DiffRevisions compares two revisions of the same request.
+func (r *RevisionApi) DiffRevisions(fromId int, toId int) ApiResponse[models.RevisionDiff] {
+	resp := ApiResponse[models.RevisionDiff]{}
+	repos := r.Repositories.Load()
+
+	from, err := repos.Revision.SelectRevisionById(fromId)
+	var to models.Revision
+	if err == nil {
+		to, err = repos.Revision.SelectRevisionById(toId)
+	}
+	if err == nil && from.FileId != to.FileId {
+		err = fmt.Errorf("revisions %d and %d belong to different requests", fromId, toId)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Unable to compare revisions"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Revisions compared"
+	resp.Data = services.DiffRevisions(from, to)
+	return resp
+}
+
+// RestoreRevision writes a revision back to its request.
+func (r *RevisionApi) RestoreRevision(revisionId int) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := services.RestoreRevision(r.Repositories.Load(), revisionId)
+	if err != nil {
+		resp.Message = "Unable to restore revision"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Revision restored"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
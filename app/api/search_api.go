@@ -0,0 +1,36 @@
+package api
+
+import (
+	"posto/app/models"
+	"posto/app/repositories"
+)
+
+type SearchApi struct {
+	Repositories *repositories.Active
+}
+
+func NewSearchApi(repositories *repositories.Active) *SearchApi {
+	return &SearchApi{Repositories: repositories}
+}
+
+// Search finds requests and folders by name, URL, headers, body and
+// description. Every word of query must match, as a prefix. A nil
+// collectionId searches all collections; a limit <= 0 returns the 50 best
+// hits.
+func (s *SearchApi) Search(query string, collectionId *int, limit int) ApiResponse[[]models.SearchHit] {
+	resp := ApiResponse[[]models.SearchHit]{}
+
+	hits, err := s.Repositories.Load().Search.Search(query, collectionId, limit)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Search failed"
+		resp.Data = []models.SearchHit{}
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Search completed"
+	resp.Data = hits
+	return resp
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"fmt"
+	"posto/app/config"
+	"posto/app/models"
+	"posto/app/repositories"
+	"posto/app/secrets"
+	"posto/app/services"
+)
+
+type SecretApi struct {
+	Repositories *repositories.Active
+}
+
+func NewSecretApi(repositories *repositories.Active) *SecretApi {
+	return &SecretApi{Repositories: repositories}
+}
+
+func (s *SecretApi) SelectSecretStatus() ApiResponse[models.SecretStatus] {
+	resp := ApiResponse[models.SecretStatus]{}
+
+	status, err := services.SecretStatus(s.Repositories.Load())
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to fetch secret status"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Secret status fetched successfully"
+	resp.Data = status
+	return resp
+}
+
+// SetupSecrets protects secret variables of the current workspace with a
+// master password (method "password") or a key file (method "key_file",
+// secret is its path). A new key file is also saved as secrets_key_file
+// so that secrets unlock on start.
+func (s *SecretApi) SetupSecrets(method string, secret string) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+
+	err := services.SetupSecrets(s.Repositories.Load(), method, secret)
+	if err != nil {
+		resp.Message = "Unable to set up secrets"
+		resp.Error = err.Error()
+		resp.Success = false
+		return resp
+	}
+	if method == services.SecretMethodKeyFile && config.ConfigData.Settings.SecretsKeyFile == "" {
+		settings := config.ConfigData.Settings
+		settings.SecretsKeyFile = secret
+		problems, err := config.ConfigData.UpdateSettings(settings)
+		if err == nil && len(problems) > 0 {
+			err = fmt.Errorf("%s", config.FormatProblems(problems))
+		}
+		if err != nil {
+			// secrets work, they just need to be unlocked by hand on start
+			resp.Message = "Secrets set up, but the key file could not be saved in the settings"
+			resp.Error = err.Error()
+			resp.Success = true
+			resp.Data = true
+			return resp
+		}
+	}
+
+	resp.Message = "Secrets set up successfully"
+	resp.Success = true
+	resp.Data = true
+	return resp
+}
+
+// UnlockSecrets takes the master password or the path of the key file.
+func (s *SecretApi) UnlockSecrets(secret string) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := services.UnlockSecrets(s.Repositories.Load(), secret)
+	if err != nil {
+		resp.Message = "Unable to unlock secrets"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Secrets unlocked"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
+
+// LockSecrets forgets the key until secrets are unlocked again.
+func (s *SecretApi) LockSecrets() ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+
+	secrets.Lock()
+	resp.Message = "Secrets locked"
+	resp.Success = true
+	resp.Data = true
+	return resp
+}
+
+// RevealSecret returns the value of a secret variable, e.g. to show or
+// copy it in the UI.
+func (s *SecretApi) RevealSecret(environmentId int, key string) ApiResponse[string] {
+	resp := ApiResponse[string]{}
+
+	environment, err := s.Repositories.Load().Environment.SelectEnvironmentById(environmentId)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to load environment"
+		return resp
+	}
+	for _, variable := range environment.Variables {
+		if variable.Key != key || !variable.Secret {
+			continue
+		}
+		value := ""
+		if variable.Value != "" {
+			value, err = secrets.Open(variable.Value)
+		}
+		if err != nil {
+			resp.Error = err.Error()
+			resp.Success = false
+			resp.Message = "Unable to reveal secret"
+			return resp
+		}
+		resp.Success = true
+		resp.Message = "Secret revealed"
+		resp.Data = value
+		return resp
+	}
+
+	resp.Success = false
+	resp.Message = "Unable to reveal secret"
+	resp.Error = "no secret variable " + key + " in " + environment.Name
+	return resp
+}
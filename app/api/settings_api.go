@@ -0,0 +1,94 @@
+package api
+
+import (
+	"posto/app/config"
+	"posto/app/models"
+	"posto/app/repositories"
+	"posto/app/services"
+)
+
+type SettingsApi struct {
+	Repositories *repositories.Active
+	Executor     *services.Executor
+	Scheduler    *services.BackupScheduler
+}
+
+func NewSettingsApi(repositories *repositories.Active, executor *services.Executor, scheduler *services.BackupScheduler) *SettingsApi {
+	return &SettingsApi{Repositories: repositories, Executor: executor, Scheduler: scheduler}
+}
+
+// SelectSettings returns the settings in effect and the ones overridden by
+// environment variables, which UpdateSettings cannot change.
+func (s *SettingsApi) SelectSettings() ApiResponse[models.SettingsInfo] {
+	resp := ApiResponse[models.SettingsInfo]{}
+
+	resp.Success = true
+	resp.Message = "Settings fetched successfully"
+	resp.Data = config.ConfigData.SettingsInfo()
+	return resp
+}
+
+// ValidateSettings checks settings without saving them.
+func (s *SettingsApi) ValidateSettings(settings models.Settings) ApiResponse[[]models.SettingsProblem] {
+	resp := ApiResponse[[]models.SettingsProblem]{}
+
+	problems := config.ValidateSettings(settings)
+	resp.Data = problems
+	if len(problems) > 0 {
+		resp.Success = false
+		resp.Message = "Settings are invalid"
+		resp.Error = config.FormatProblems(problems)
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Settings are valid"
+	return resp
+}
+
+// UpdateSettings saves settings and applies them right away, except for
+// db_path which is used from the next start. Nothing is saved when they are
+// invalid, the problems are returned instead.
+func (s *SettingsApi) UpdateSettings(settings models.Settings) ApiResponse[[]models.SettingsProblem] {
+	resp := ApiResponse[[]models.SettingsProblem]{Data: []models.SettingsProblem{}}
+
+	previousDBPath := config.ConfigData.Settings.DBPath
+	problems, err := config.ConfigData.UpdateSettings(settings)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Unable to save settings"
+		return resp
+	}
+	if len(problems) > 0 {
+		resp.Error = config.FormatProblems(problems)
+		resp.Success = false
+		resp.Message = "Settings are invalid"
+		resp.Data = problems
+		return resp
+	}
+
+	applied := config.ConfigData
+	if err := s.Executor.Configure(applied.Settings); err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Settings were saved but could not be applied to requests"
+		return resp
+	}
+	s.Scheduler.SetSchedule(applied.BackupInterval, applied.BackupKeep)
+	if applied.HistoryRetention > 0 {
+		if err := s.Repositories.Load().History.PruneHistory(applied.HistoryRetention); err != nil {
+			resp.Error = err.Error()
+			resp.Success = false
+			resp.Message = "Settings were saved but old history could not be deleted"
+			return resp
+		}
+	}
+
+	resp.Success = true
+	resp.Message = "Settings saved"
+	if applied.Settings.DBPath != previousDBPath {
+		resp.Message = "Settings saved, restart posto to use the new database path"
+	}
+	return resp
+}
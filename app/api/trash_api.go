@@ -0,0 +1,114 @@
+package api
+
+import (
+	"posto/app/models"
+	"posto/app/repositories"
+)
+
+type TrashApi struct {
+	Repositories *repositories.Active
+}
+
+func NewTrashApi(repositories *repositories.Active) *TrashApi {
+	return &TrashApi{Repositories: repositories}
+}
+
+// TrashCollection moves a collection to the trash. It can be restored until
+// it is purged, see config.DefaultTrashRetention.
+func (t *TrashApi) TrashCollection(collectionId int) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := t.Repositories.Load().Trash.TrashCollection(collectionId)
+	if err != nil {
+		resp.Message = "Unable to move collection to trash"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Collection moved to trash"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
+
+// TrashFile moves a request, or a folder with everything below it, to the
+// trash.
+func (t *TrashApi) TrashFile(fileId int) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := t.Repositories.Load().Trash.TrashFile(fileId)
+	if err != nil {
+		resp.Message = "Unable to move to trash"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Moved to trash"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
+
+func (t *TrashApi) SelectTrash() ApiResponse[[]models.TrashItem] {
+	resp := ApiResponse[[]models.TrashItem]{}
+
+	items, err := t.Repositories.Load().Trash.SelectTrash()
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to fetch trash"
+		resp.Data = []models.TrashItem{}
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Trash fetched successfully"
+	resp.Data = items
+	return resp
+}
+
+func (t *TrashApi) RestoreCollection(collectionId int) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := t.Repositories.Load().Trash.RestoreCollection(collectionId)
+	if err != nil {
+		resp.Message = "Unable to restore collection"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Collection restored"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
+
+// RestoreFile puts a request or folder back where it was, with the files
+// that were trashed along with it.
+func (t *TrashApi) RestoreFile(fileId int) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := t.Repositories.Load().Trash.RestoreFile(fileId)
+	if err != nil {
+		resp.Message = "Unable to restore from trash"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Restored from trash"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
+
+// EmptyTrash permanently deletes everything in the trash.
+func (t *TrashApi) EmptyTrash() ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+	err := t.Repositories.Load().Trash.PurgeTrash(0)
+	if err != nil {
+		resp.Message = "Unable to empty trash"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Trash emptied"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"posto/app/config"
+	"posto/app/db"
+	"posto/app/models"
+	"posto/app/repositories"
+	"posto/app/services"
+	"sync"
+)
+
+type WorkspaceApi struct {
+	Repositories *repositories.Active
+	// api is used to stop and restart the background services, which work
+	// on the open database, when switching workspaces.
+	api *Api
+	mu  sync.Mutex
+}
+
+func NewWorkspaceApi(api *Api) *WorkspaceApi {
+	return &WorkspaceApi{Repositories: api.Repositories, api: api}
+}
+
+func (w *WorkspaceApi) SelectWorkspaces() ApiResponse[[]models.Workspace] {
+	resp := ApiResponse[[]models.Workspace]{}
+
+	workspaces, err := config.ConfigData.Workspaces()
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Failed to fetch workspaces"
+		resp.Data = []models.Workspace{}
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Workspaces fetched successfully"
+	resp.Data = workspaces
+	return resp
+}
+
+// CreateWorkspace adds an empty workspace. It is not opened, see
+// SwitchWorkspace.
+func (w *WorkspaceApi) CreateWorkspace(name string) ApiResponse[models.Workspace] {
+	resp := ApiResponse[models.Workspace]{}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	workspace, err := config.ConfigData.CreateWorkspace(name)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Unable to create workspace"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Workspace created successfully"
+	resp.Data = workspace
+	return resp
+}
+
+func (w *WorkspaceApi) RenameWorkspace(id string, name string) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := config.ConfigData.RenameWorkspace(id, name)
+	if err != nil {
+		resp.Message = "Unable to rename workspace"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Workspace renamed successfully"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
+
+// SwitchWorkspace opens the database of another workspace, migrates it and
+// makes every api use it. Mock server and proxy are stopped. On failure the
+// current workspace stays open.
+func (w *WorkspaceApi) SwitchWorkspace(id string) ApiResponse[models.Workspace] {
+	resp := ApiResponse[models.Workspace]{}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	workspace, err := w.switchWorkspace(id)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Success = false
+		resp.Message = "Unable to switch workspace"
+		return resp
+	}
+
+	resp.Success = true
+	resp.Message = "Switched to " + workspace.Name
+	resp.Data = workspace
+	return resp
+}
+
+func (w *WorkspaceApi) switchWorkspace(id string) (models.Workspace, error) {
+	if id == config.ConfigData.Workspace {
+		return models.Workspace{}, fmt.Errorf("workspace %q is already open", id)
+	}
+	workspaces, err := config.ConfigData.Workspaces()
+	if err != nil {
+		return models.Workspace{}, err
+	}
+	var workspace *models.Workspace
+	for i := range workspaces {
+		if workspaces[i].Id == id {
+			workspace = &workspaces[i]
+		}
+	}
+	if workspace == nil {
+		return models.Workspace{}, fmt.Errorf("workspace %q does not exist", id)
+	}
+
+	dbConn, err := db.OpenDB(workspace.DBPath)
+	if err != nil {
+		return models.Workspace{}, fmt.Errorf("error opening database: %v", err)
+	}
+	if err := db.MigrateDB(dbConn); err != nil {
+		dbConn.Close()
+		return models.Workspace{}, fmt.Errorf("error running migrations: %v", err)
+	}
+	repos := repositories.NewRepositories(dbConn)
+	if err := repos.Search.EnsureSearchIndex(); err != nil {
+		dbConn.Close()
+		return models.Workspace{}, fmt.Errorf("error creating search index: %v", err)
+	}
+	if err := config.ConfigData.SetCurrentWorkspace(id); err != nil {
+		dbConn.Close()
+		return models.Workspace{}, err
+	}
+
+	// every api reads the repositories through the same Active, swapping
+	// it switches all of them at once. Calls still running finish on the
+	// previous database, closing it waits for their queries.
+	w.api.Shutdown()
+	previous := db.Swap(dbConn)
+	w.Repositories.Swap(repos)
+	w.api.restartBackground()
+	previous.Close()
+
+	// secrets belong to a database, those of the new one may need unlocking.
+	// As on startup, these failures do not keep the workspace from opening.
+	if err := services.UnlockSecretsOnStart(repos); err != nil {
+		slog.Warn("Error unlocking secrets", "workspace", id, "error", err)
+	}
+	if err := repos.Trash.PurgeTrash(config.ConfigData.TrashRetention); err != nil {
+		slog.Warn("Error purging trash", "workspace", id, "error", err)
+	}
+	if config.ConfigData.HistoryRetention > 0 {
+		if err := repos.History.PruneHistory(config.ConfigData.HistoryRetention); err != nil {
+			slog.Warn("Error pruning history", "workspace", id, "error", err)
+		}
+	}
+	workspace.IsCurrent = true
+	return *workspace, nil
+}
+
+// DeleteWorkspace deletes a workspace with its database and backups. The
+// open workspace and the default one cannot be deleted.
+func (w *WorkspaceApi) DeleteWorkspace(id string) ApiResponse[bool] {
+	resp := ApiResponse[bool]{Data: false}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := config.ConfigData.DeleteWorkspace(id)
+	if err != nil {
+		resp.Message = "Unable to delete workspace"
+		resp.Error = err.Error()
+		resp.Success = false
+	} else {
+		resp.Message = "Workspace deleted"
+		resp.Success = true
+		resp.Data = true
+	}
+	return resp
+}
@@ -0,0 +1,175 @@
+// Package cli implements the headless posto subcommands that run without
+// starting the Wails window, e.g. `posto run --collection Orders`.
+package cli
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"posto/app/config"
+	"posto/app/db"
+	"posto/app/logging"
+	"posto/app/repositories"
+	"posto/app/services"
+	"strconv"
+)
+
+const (
+	exitOk      = 0
+	exitFailed  = 1
+	exitUsage   = 2
+	exitRuntime = 3
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands = []command{
+	{name: "run", usage: "run the requests of a collection and check their assertions", run: runCommand},
+	{name: "mock", usage: "serve the mock responses of a collection", run: mockCommand},
+	{name: "migrate", usage: "show, apply or revert database migrations", run: migrateCommand},
+}
+
+// IsCommand reports whether args (os.Args without the program name) start
+// with a CLI subcommand, in which case the GUI must not be started.
+func IsCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		return true
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// Main executes the subcommand in args and returns the process exit code.
+func Main(args []string) int {
+	return dispatch(args, os.Stdout, os.Stderr)
+}
+
+func dispatch(args []string, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		for _, cmd := range commands {
+			if cmd.name == args[0] {
+				return cmd.run(args[1:], stdout, stderr)
+			}
+		}
+	}
+
+	fmt.Fprintln(stderr, "Usage: posto <command> [flags]")
+	fmt.Fprintln(stderr, "")
+	fmt.Fprintln(stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(stderr, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintln(stderr, "")
+	fmt.Fprintln(stderr, "Run `posto <command> -h` for the flags of a command.")
+	return exitUsage
+}
+
+// openDatabase sets up config and opens the database without migrating it.
+// A non empty dbPath overrides the configured database file.
+func openDatabase(dbPath string) (*sql.DB, error) {
+	if _, err := config.NewConfig(); err != nil {
+		return nil, fmt.Errorf("error setting up config: %v", err)
+	}
+	if err := logging.Setup(config.ConfigData.LogDir, os.Stderr, nil); err != nil {
+		return nil, fmt.Errorf("error setting up logging: %v", err)
+	}
+	if problems := config.ConfigData.LoadProblems(); len(problems) > 0 {
+		slog.Warn("Invalid settings reset to their defaults", "path", config.ConfigData.SettingsPath, "problems", config.FormatProblems(problems))
+	}
+	if dbPath != "" {
+		config.ConfigData.DBPath = dbPath
+	}
+
+	DB, err := db.InitDB()
+	if err != nil {
+		return nil, fmt.Errorf("error initializing database: %v", err)
+	}
+	return DB, nil
+}
+
+// openRepositories sets up config and database the same way the GUI does.
+// A non empty dbPath overrides the configured database file.
+func openRepositories(dbPath string) (*repositories.Repositories, error) {
+	DB, err := openDatabase(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Migrate(); err != nil {
+		return nil, fmt.Errorf("error running migrations: %v", err)
+	}
+
+	repos := repositories.NewRepositories(DB)
+	if err := repos.Search.EnsureSearchIndex(); err != nil {
+		return nil, fmt.Errorf("error creating search index: %v", err)
+	}
+	if err := services.UnlockSecretsOnStart(repos); err != nil {
+		return nil, fmt.Errorf("error unlocking secrets: %v", err)
+	}
+	return repos, nil
+}
+
+// openCollection opens the database and resolves the collection given on the
+// command line. With a collection file the bundle is imported into an in
+// memory database instead, so the app database is never touched.
+func openCollection(dbPath string, file string, collection string) (*repositories.Repositories, int, error) {
+	if file != "" {
+		dbPath = ":memory:"
+	}
+	repos, err := openRepositories(dbPath)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	if file == "" {
+		collectionId, err := resolveCollection(repos, collection)
+		return repos, collectionId, err
+	}
+
+	bundle, err := services.ReadCollectionBundle(file)
+	if err != nil {
+		return nil, -1, err
+	}
+	if collection != "" && collection != bundle.Name {
+		return nil, -1, fmt.Errorf("collection %q not found in %s", collection, file)
+	}
+	collectionId, err := services.ImportCollectionBundle(repos, bundle)
+	if err != nil {
+		return nil, -1, err
+	}
+	return repos, collectionId, nil
+}
+
+func resolveCollection(repos *repositories.Repositories, nameOrId string) (int, error) {
+	collection, err := repos.Collection.SelectCollectionByName(nameOrId)
+	if err == nil {
+		return int(collection.PkCollectionId), nil
+	}
+	if err != sql.ErrNoRows {
+		return -1, err
+	}
+
+	if id, convErr := strconv.Atoi(nameOrId); convErr == nil {
+		collection, err = repos.Collection.SelectCollectionById(id)
+		if err == nil {
+			return int(collection.PkCollectionId), nil
+		}
+		if err != sql.ErrNoRows {
+			return -1, err
+		}
+	}
+	return -1, fmt.Errorf("collection %q not found", nameOrId)
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"posto/app/db"
+)
+
+func migrateCommand(args []string, stdout, stderr io.Writer) int {
+	var dbPath string
+	var steps int
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&dbPath, "db", "", "path of the SQLite database (defaults to the app database)")
+	fs.IntVar(&steps, "steps", 1, "number of migrations reverted by down")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: posto migrate [status|up|down] [flags]")
+		fmt.Fprintln(stderr, "")
+		fmt.Fprintln(stderr, "  status  list the migrations and whether they are applied (default)")
+		fmt.Fprintln(stderr, "  up      apply the pending migrations")
+		fmt.Fprintln(stderr, "  down    revert the last --steps migrations")
+		fmt.Fprintln(stderr, "")
+		fs.PrintDefaults()
+	}
+
+	action := "status"
+	if len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-' {
+		action, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOk
+		}
+		return exitUsage
+	}
+	if action != "status" && action != "up" && action != "down" {
+		fmt.Fprintf(stderr, "Unknown action %q\n", action)
+		fs.Usage()
+		return exitUsage
+	}
+
+	if _, err := openDatabase(dbPath); err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return exitRuntime
+	}
+
+	switch action {
+	case "up":
+		if err := db.Migrate(); err != nil {
+			fmt.Fprintln(stderr, "Error:", err)
+			return exitRuntime
+		}
+		fmt.Fprintln(stdout, "All migrations applied")
+	case "down":
+		reverted, err := db.Rollback(steps)
+		for _, name := range reverted {
+			fmt.Fprintln(stdout, "Reverted", name)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, "Error:", err)
+			return exitRuntime
+		}
+	default:
+		states, err := db.MigrationStatus()
+		if err != nil {
+			fmt.Fprintln(stderr, "Error:", err)
+			return exitRuntime
+		}
+		for _, state := range states {
+			status := "pending"
+			if state.Applied {
+				status = "applied " + state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			reversible := ""
+			if !state.Reversible {
+				reversible = "  (no down migration)"
+			}
+			fmt.Fprintf(stdout, "%-40s %s%s\n", state.Name, status, reversible)
+		}
+	}
+	return exitOk
+}
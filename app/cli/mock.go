@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"posto/app/models"
+	"posto/app/repositories"
+	"posto/app/services"
+	"syscall"
+)
+
+func mockCommand(args []string, stdout, stderr io.Writer) int {
+	var collection, dbPath, file, host string
+	var port int
+	fs := flag.NewFlagSet("mock", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&collection, "collection", "", "name or id of the collection to serve")
+	fs.StringVar(&dbPath, "db", "", "path of the SQLite database (defaults to the app database)")
+	fs.StringVar(&file, "file", "", "serve an exported collection file instead of the database")
+	fs.StringVar(&host, "host", "127.0.0.1", "address to listen on")
+	fs.IntVar(&port, "port", 4000, "port to listen on")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: posto mock --collection <name> [--port 4000] [flags]")
+		fmt.Fprintln(stderr, "")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOk
+		}
+		return exitUsage
+	}
+	if collection == "" && file == "" {
+		fmt.Fprintln(stderr, "Either --collection or --file is required")
+		fs.Usage()
+		return exitUsage
+	}
+
+	repos, collectionId, err := openCollection(dbPath, file, collection)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return exitRuntime
+	}
+
+	server := services.NewMockServer(repositories.NewActive(repos))
+	server.OnRequest = func(entry models.MockRequestLog) {
+		matched := "-"
+		if entry.MatchedName != "" {
+			matched = entry.MatchedName
+		}
+		fmt.Fprintf(stdout, "%s  %-6s %s  %d (%dms)  %s\n",
+			entry.Time.Format("15:04:05"), entry.Method, entry.Path, entry.Status, entry.DurationMs, matched)
+	}
+
+	status, err := server.Start(services.MockServerOptions{CollectionId: collectionId, Host: host, Port: port})
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return exitRuntime
+	}
+
+	fmt.Fprintf(stdout, "Mock server listening on %s with %d routes\n", status.Address, status.Routes)
+	for _, route := range server.Routes() {
+		note := ""
+		if route.Response == nil {
+			note = "  (no mock response)"
+		}
+		fmt.Fprintf(stdout, "  %-6s %s  %s%s\n", route.Method, route.Pattern, route.Name, note)
+	}
+	fmt.Fprintln(stdout, "Press Ctrl+C to stop")
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+
+	if err := server.Stop(); err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return exitRuntime
+	}
+	return exitOk
+}
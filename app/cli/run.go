@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"posto/app/config"
+	"posto/app/repositories"
+	"posto/app/services"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stringList collects repeated flags such as --var a=1 --var b=2.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+type runFlags struct {
+	collection  string
+	folder      string
+	environment string
+	dbPath      string
+	file        string
+	vars        stringList
+	reports     stringList
+	bail        bool
+	timeout     time.Duration
+}
+
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	flags := runFlags{}
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&flags.collection, "collection", "", "name or id of the collection to run")
+	fs.StringVar(&flags.folder, "folder", "", "only run the requests inside this folder")
+	fs.StringVar(&flags.environment, "env", "", "name of the environment whose variables are used")
+	fs.StringVar(&flags.dbPath, "db", "", "path of the SQLite database (defaults to the app database)")
+	fs.StringVar(&flags.file, "file", "", "run an exported collection file instead of the database")
+	fs.Var(&flags.vars, "var", "variable override as key=value, may be repeated")
+	fs.Var(&flags.reports, "report", "write a report as format=path (junit, json, html or har), may be repeated")
+	fs.BoolVar(&flags.bail, "bail", false, "stop at the first failed request")
+	fs.DurationVar(&flags.timeout, "timeout", 0, "timeout of every request (defaults to the request_timeout_seconds setting)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: posto run --collection <name> [flags]")
+		fmt.Fprintln(stderr, "       posto run --file <collection.json> [flags]")
+		fmt.Fprintln(stderr, "")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOk
+		}
+		return exitUsage
+	}
+	if flags.collection == "" && flags.file == "" {
+		fmt.Fprintln(stderr, "Either --collection or --file is required")
+		fs.Usage()
+		return exitUsage
+	}
+
+	vars := map[string]string{}
+	for _, v := range flags.vars {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			fmt.Fprintf(stderr, "Invalid --var %q, expected key=value\n", v)
+			return exitUsage
+		}
+		vars[key] = value
+	}
+
+	reports := [][2]string{}
+	for _, r := range flags.reports {
+		format, path, ok := strings.Cut(r, "=")
+		if !ok || !slices.Contains(services.ReportFormats, format) || path == "" {
+			fmt.Fprintf(stderr, "Invalid --report %q, expected <%s>=<path>\n", r, strings.Join(services.ReportFormats, "|"))
+			return exitUsage
+		}
+		reports = append(reports, [2]string{format, path})
+	}
+
+	options, repos, err := prepareRun(flags)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return exitRuntime
+	}
+	options.Variables = vars
+	options.Bail = flags.bail
+
+	executor := services.NewExecutor(flags.timeout)
+	if config.ConfigData != nil {
+		if err := executor.Configure(config.ConfigData.Settings); err != nil {
+			fmt.Fprintln(stderr, "Error:", err)
+			return exitRuntime
+		}
+		if flags.timeout > 0 {
+			executor.SetTimeout(flags.timeout)
+		}
+	}
+
+	defer executor.Bodies.RemoveAll()
+
+	runner := services.NewCollectionRunner(repos, executor)
+	result, err := runner.Run(options)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return exitRuntime
+	}
+
+	printRunResult(stdout, result)
+
+	for _, report := range reports {
+		if err := services.WriteRunReport(result, report[0], report[1]); err != nil {
+			fmt.Fprintln(stderr, "Error:", err)
+			return exitRuntime
+		}
+		fmt.Fprintf(stdout, "Wrote %s report to %s\n", report[0], report[1])
+	}
+	if !result.Success() {
+		return exitFailed
+	}
+	return exitOk
+}
+
+// prepareRun opens the database (or loads the collection file into an in
+// memory database) and resolves the names given on the command line.
+func prepareRun(flags runFlags) (services.RunOptions, *repositories.Repositories, error) {
+	options := services.RunOptions{}
+
+	repos, collectionId, err := openCollection(flags.dbPath, flags.file, flags.collection)
+	if err != nil {
+		return options, nil, err
+	}
+	options.CollectionId = collectionId
+
+	if flags.folder != "" {
+		files, err := repos.File.SelectFilesByCollection(options.CollectionId)
+		if err != nil {
+			return options, nil, err
+		}
+		folder := services.FindFolderByName(services.BuildFileTree(files), flags.folder)
+		if folder == nil {
+			return options, nil, fmt.Errorf("folder %q not found", flags.folder)
+		}
+		folderId := int(folder.File.PkFileId)
+		options.FolderId = &folderId
+	}
+
+	if flags.environment != "" {
+		environment, err := repos.Environment.SelectEnvironmentByName(flags.environment)
+		if err == sql.ErrNoRows {
+			return options, nil, fmt.Errorf("environment %q not found", flags.environment)
+		}
+		if err != nil {
+			return options, nil, err
+		}
+		environmentId := int(environment.PkEnvironmentId)
+		options.EnvironmentId = &environmentId
+	}
+
+	return options, repos, nil
+}
+
+func printRunResult(w io.Writer, result services.RunResult) {
+	header := fmt.Sprintf("Collection %q", result.CollectionName)
+	if result.EnvironmentName != "" {
+		header += fmt.Sprintf(" (env: %s)", result.EnvironmentName)
+	}
+	fmt.Fprintln(w, header)
+	fmt.Fprintln(w, "")
+
+	for _, request := range result.Requests {
+		mark := "PASS"
+		if !request.Passed {
+			mark = "FAIL"
+		}
+		status := "---"
+		if request.Response != nil {
+			status = strconv.Itoa(request.Response.StatusCode)
+		}
+		fmt.Fprintf(w, "  %s  %-6s %s  %s (%dms)\n", mark, request.Method, request.FullName(), status, request.DurationMs)
+
+		if request.Error != "" {
+			fmt.Fprintf(w, "        error: %s\n", request.Error)
+		}
+		for _, assertion := range request.Assertions {
+			if !assertion.Passed {
+				fmt.Fprintf(w, "        assertion failed: %s\n", assertion.Message)
+			}
+		}
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintf(w, "%d requests, %d passed, %d failed in %dms\n", result.Total, result.Passed, result.Failed, result.DurationMs)
+}
@@ -4,28 +4,139 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"posto/app/models"
+	"runtime"
+	"time"
+)
+
+const (
+	// DefaultTrashRetention is how long deleted collections and files stay
+	// in the trash.
+	DefaultTrashRetention = 30 * 24 * time.Hour
+	// DefaultBackupInterval is the time between automatic backups.
+	DefaultBackupInterval = 24 * time.Hour
+	// DefaultBackupKeep is the number of backups kept in the backups
+	// directory.
+	DefaultBackupKeep = 10
+	// DefaultResponseMemoryLimit is the size above which response bodies
+	// are streamed to a file instead of being kept in memory.
+	DefaultResponseMemoryLimit = 10 << 20
 )
 
 type Config struct {
-	DBPath string
+	// Dir is the directory holding the databases and other app files.
+	Dir string
+	// LogDir holds the log files.
+	LogDir string
+	// SettingsPath is the settings file, Settings the settings in effect
+	// including environment overrides.
+	SettingsPath string
+	Settings     models.Settings
+	// Workspace is the id of the open workspace and DBPath its database.
+	Workspace string
+	DBPath    string
+	// TrashRetention is the age after which trashed items are purged.
+	TrashRetention time.Duration
+	// BackupInterval is the time between automatic backups, 0 disables
+	// them.
+	BackupInterval time.Duration
+	BackupKeep     int
+	// HistoryRetention is the age after which history entries are deleted,
+	// 0 keeps them.
+	HistoryRetention time.Duration
+
+	savedSettings models.Settings
+	overrides     map[string]string
+	defaultDBPath string
+	// loadProblems is what was wrong with the settings when they were
+	// loaded, those fields are at their defaults.
+	loadProblems []models.SettingsProblem
 }
 
 var ConfigData *Config
 
 func NewConfig() (*Config, error) {
-	homeDir, err := os.UserHomeDir()
+	settingsDir, dataDir, err := resolveDirs()
 	if err != nil {
-		return nil, fmt.Errorf("error getting home directory: %v", err)
+		return nil, err
+	}
+	for _, dir := range []string{settingsDir, dataDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("error creating config directory: %v", err)
+		}
+	}
+
+	configData := &Config{
+		Dir:          dataDir,
+		LogDir:       filepath.Join(dataDir, "logs"),
+		SettingsPath: filepath.Join(settingsDir, settingsFile),
 	}
 
-	configDir := filepath.Join(homeDir, ".posto")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return nil, fmt.Errorf("error creating config directory: %v", err)
+	saved, err := loadSettings(configData.SettingsPath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading settings: %v", err)
+	}
+	settings, overrides, err := applyEnv(saved)
+	if err != nil {
+		return nil, err
+	}
+	// invalid settings, e.g. a certificate file that was moved, must not
+	// keep the app from starting; the UI reports them instead
+	if problems := ValidateSettings(settings); len(problems) > 0 {
+		settings = resetSettings(settings, problems)
+		configData.loadProblems = problems
 	}
+	configData.savedSettings = saved
+	configData.overrides = overrides
+	configData.applySettings(settings)
 
-	ConfigData = &Config{
-		DBPath: filepath.Join(configDir, "posto.db"),
+	configData.defaultDBPath = filepath.Join(dataDir, databaseFile)
+	if settings.DBPath != "" {
+		configData.defaultDBPath = ExpandPath(settings.DBPath)
 	}
 
+	registry, err := configData.loadWorkspaces()
+	if err != nil {
+		return nil, fmt.Errorf("error loading workspaces: %v", err)
+	}
+	configData.Workspace = registry.Current
+	configData.DBPath = configData.WorkspaceDBPath(registry.Current)
+	if err := os.MkdirAll(filepath.Dir(configData.DBPath), 0755); err != nil {
+		return nil, fmt.Errorf("error creating workspace directory: %v", err)
+	}
+
+	ConfigData = configData
 	return ConfigData, nil
 }
+
+// resolveDirs returns the directories of the settings and of the data.
+// Both are POSTO_HOME when it is set, or ~/.posto when it exists or the OS
+// is not Linux. On Linux they otherwise follow the XDG base directories.
+func resolveDirs() (string, string, error) {
+	if home := os.Getenv(EnvHome); home != "" {
+		home = ExpandPath(home)
+		return home, home, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", fmt.Errorf("error getting home directory: %v", err)
+	}
+	legacyDir := filepath.Join(homeDir, ".posto")
+	if _, err := os.Stat(legacyDir); err == nil || runtime.GOOS != "linux" {
+		return legacyDir, legacyDir, nil
+	}
+
+	settingsDir := filepath.Join(xdgDir("XDG_CONFIG_HOME", filepath.Join(homeDir, ".config")), "posto")
+	dataDir := filepath.Join(xdgDir("XDG_DATA_HOME", filepath.Join(homeDir, ".local", "share")), "posto")
+	return settingsDir, dataDir, nil
+}
+
+// xdgDir returns the directory in env, which the spec requires to be
+// absolute, or fallback.
+func xdgDir(env string, fallback string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	return fallback
+}
@@ -0,0 +1,380 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"posto/app/logging"
+	"posto/app/models"
+	"posto/app/redact"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const settingsFile = "settings.json"
+
+// Environment variables that override settings without changing the file.
+// POSTO_HOME moves every file of the app to another directory.
+const (
+	EnvHome               = "POSTO_HOME"
+	EnvDBPath             = "POSTO_DB_PATH"
+	EnvRequestTimeout     = "POSTO_REQUEST_TIMEOUT"
+	EnvProxy              = "POSTO_PROXY"
+	EnvInsecureSkipVerify = "POSTO_INSECURE_SKIP_VERIFY"
+	EnvCACertFile         = "POSTO_CA_CERT_FILE"
+	EnvSecretsKeyFile     = "POSTO_SECRETS_KEY_FILE"
+	EnvDebug              = "POSTO_DEBUG"
+	// EnvMasterPassword unlocks secret variables set up with a master
+	// password, for headless runs. It is not a setting.
+	EnvMasterPassword = "POSTO_MASTER_PASSWORD"
+)
+
+var Themes = []string{"system", "light", "dark"}
+
+const (
+	minFontSize = 8
+	maxFontSize = 32
+)
+
+func DefaultSettings() models.Settings {
+	return models.Settings{
+		RequestTimeoutSeconds: 30,
+		TrashRetentionDays:    int(DefaultTrashRetention / (24 * time.Hour)),
+		BackupIntervalHours:   int(DefaultBackupInterval / time.Hour),
+		BackupKeep:            DefaultBackupKeep,
+		ResponseMemoryLimitMB: DefaultResponseMemoryLimit >> 20,
+		DefaultHeaders:        map[string]string{},
+		Redaction: models.RedactionSettings{
+			Headers:  []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Auth-Token"},
+			JsonKeys: []string{"password", "passwd", "secret", "token", "access_token", "refresh_token", "client_secret", "api_key", "apikey"},
+			// JSON web tokens
+			Patterns: []string{`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`},
+			History:  true,
+			Logs:     true,
+			Exports:  true,
+		},
+		UI: models.UISettings{Theme: "system", FontSize: 14},
+	}
+}
+
+// settingsEnv lists the overridable settings. restore puts back the value
+// from the file so that saving never writes an overridden value.
+var settingsEnv = []struct {
+	env     string
+	field   string
+	apply   func(s *models.Settings, value string) error
+	restore func(s *models.Settings, saved models.Settings)
+}{
+	{
+		EnvDBPath, "db_path",
+		func(s *models.Settings, value string) error { s.DBPath = value; return nil },
+		func(s *models.Settings, saved models.Settings) { s.DBPath = saved.DBPath },
+	},
+	{
+		EnvRequestTimeout, "request_timeout_seconds",
+		func(s *models.Settings, value string) error {
+			// plain seconds or a duration such as 1m30s, rounded up to
+			// whole seconds so that 500ms does not become 0 (no timeout)
+			if seconds, err := strconv.Atoi(value); err == nil {
+				s.RequestTimeoutSeconds = seconds
+				return nil
+			}
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			s.RequestTimeoutSeconds = int(math.Ceil(d.Seconds()))
+			return nil
+		},
+		func(s *models.Settings, saved models.Settings) { s.RequestTimeoutSeconds = saved.RequestTimeoutSeconds },
+	},
+	{
+		EnvProxy, "proxy",
+		func(s *models.Settings, value string) error { s.Proxy = value; return nil },
+		func(s *models.Settings, saved models.Settings) { s.Proxy = saved.Proxy },
+	},
+	{
+		EnvInsecureSkipVerify, "tls.insecure_skip_verify",
+		func(s *models.Settings, value string) error {
+			insecure, err := strconv.ParseBool(value)
+			s.TLS.InsecureSkipVerify = insecure
+			return err
+		},
+		func(s *models.Settings, saved models.Settings) {
+			s.TLS.InsecureSkipVerify = saved.TLS.InsecureSkipVerify
+		},
+	},
+	{
+		EnvCACertFile, "tls.ca_cert_file",
+		func(s *models.Settings, value string) error { s.TLS.CACertFile = value; return nil },
+		func(s *models.Settings, saved models.Settings) { s.TLS.CACertFile = saved.TLS.CACertFile },
+	},
+	{
+		EnvSecretsKeyFile, "secrets_key_file",
+		func(s *models.Settings, value string) error { s.SecretsKeyFile = value; return nil },
+		func(s *models.Settings, saved models.Settings) { s.SecretsKeyFile = saved.SecretsKeyFile },
+	},
+	{
+		EnvDebug, "debug_logging",
+		func(s *models.Settings, value string) error {
+			debug, err := strconv.ParseBool(value)
+			s.DebugLogging = debug
+			return err
+		},
+		func(s *models.Settings, saved models.Settings) { s.DebugLogging = saved.DebugLogging },
+	},
+}
+
+// loadSettings reads the settings file over the defaults, so that settings
+// added later get their default. A missing file is created.
+func loadSettings(path string) (models.Settings, error) {
+	settings := DefaultSettings()
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return settings, saveSettings(path, settings)
+	}
+	if err != nil {
+		return settings, err
+	}
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return settings, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	if settings.DefaultHeaders == nil {
+		settings.DefaultHeaders = map[string]string{}
+	}
+	return settings, nil
+}
+
+func saveSettings(path string, settings models.Settings) error {
+	content, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0644)
+}
+
+// applyEnv returns settings with the environment variables applied and the
+// fields they override.
+func applyEnv(settings models.Settings) (models.Settings, map[string]string, error) {
+	overrides := map[string]string{}
+	for _, o := range settingsEnv {
+		value, ok := os.LookupEnv(o.env)
+		if !ok {
+			continue
+		}
+		if err := o.apply(&settings, value); err != nil {
+			return settings, nil, fmt.Errorf("invalid %s: %v", o.env, err)
+		}
+		overrides[o.field] = o.env
+	}
+	return settings, overrides, nil
+}
+
+// ExpandPath replaces a leading ~ with the home directory.
+func ExpandPath(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// ValidateSettings returns what is wrong with settings, nothing when they
+// can be saved.
+func ValidateSettings(settings models.Settings) []models.SettingsProblem {
+	problems := []models.SettingsProblem{}
+	problem := func(field string, format string, args ...any) {
+		problems = append(problems, models.SettingsProblem{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if settings.DBPath != "" && !filepath.IsAbs(ExpandPath(settings.DBPath)) {
+		problem("db_path", "must be an absolute path")
+	}
+	if settings.RequestTimeoutSeconds < 0 {
+		problem("request_timeout_seconds", "must be 0 or more")
+	}
+	if settings.Proxy != "" {
+		proxy, err := url.Parse(settings.Proxy)
+		switch {
+		case err != nil:
+			problem("proxy", "is not a valid URL")
+		case !slices.Contains([]string{"http", "https", "socks5"}, proxy.Scheme) || proxy.Host == "":
+			problem("proxy", "must be an http://, https:// or socks5:// URL with a host")
+		}
+	}
+
+	if settings.TLS.CACertFile != "" {
+		content, err := os.ReadFile(ExpandPath(settings.TLS.CACertFile))
+		if err != nil {
+			problem("tls.ca_cert_file", "cannot be read: %v", err)
+		} else if !x509.NewCertPool().AppendCertsFromPEM(content) {
+			problem("tls.ca_cert_file", "contains no PEM certificate")
+		}
+	}
+	if (settings.TLS.ClientCertFile == "") != (settings.TLS.ClientKeyFile == "") {
+		problem("tls.client_cert_file", "client certificate and key must be set together")
+	} else if settings.TLS.ClientCertFile != "" {
+		_, err := tls.LoadX509KeyPair(ExpandPath(settings.TLS.ClientCertFile), ExpandPath(settings.TLS.ClientKeyFile))
+		if err != nil {
+			problem("tls.client_cert_file", "cannot be loaded: %v", err)
+		}
+	}
+
+	if settings.SecretsKeyFile != "" {
+		if _, err := os.Stat(ExpandPath(settings.SecretsKeyFile)); err != nil {
+			problem("secrets_key_file", "cannot be read: %v", err)
+		}
+	}
+
+	if settings.HistoryRetentionDays < 0 {
+		problem("history_retention_days", "must be 0 or more")
+	}
+	if settings.TrashRetentionDays < 1 {
+		problem("trash_retention_days", "must be at least 1")
+	}
+	if settings.BackupIntervalHours < 0 {
+		problem("backup_interval_hours", "must be 0 or more")
+	}
+	if settings.BackupKeep < 1 {
+		problem("backup_keep", "must be at least 1")
+	}
+	if settings.ResponseMemoryLimitMB < 1 {
+		problem("response_memory_limit_mb", "must be at least 1")
+	}
+	for name := range settings.DefaultHeaders {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			problem("default_headers", "%q is not a valid header name", name)
+		}
+	}
+
+	if _, err := redactionPolicy(settings.Redaction); err != nil {
+		problem("redaction.patterns", "%v", err)
+	}
+
+	if !slices.Contains(Themes, settings.UI.Theme) {
+		problem("ui.theme", "must be one of %s", strings.Join(Themes, ", "))
+	}
+	if settings.UI.FontSize < minFontSize || settings.UI.FontSize > maxFontSize {
+		problem("ui.font_size", "must be between %d and %d", minFontSize, maxFontSize)
+	}
+	return problems
+}
+
+// settingsDefaults puts back the default of the settings behind each
+// problem field of ValidateSettings.
+var settingsDefaults = map[string]func(s *models.Settings, defaults models.Settings){
+	"db_path":                  func(s *models.Settings, d models.Settings) { s.DBPath = d.DBPath },
+	"request_timeout_seconds":  func(s *models.Settings, d models.Settings) { s.RequestTimeoutSeconds = d.RequestTimeoutSeconds },
+	"proxy":                    func(s *models.Settings, d models.Settings) { s.Proxy = d.Proxy },
+	"tls.ca_cert_file":         func(s *models.Settings, d models.Settings) { s.TLS.CACertFile = d.TLS.CACertFile },
+	"secrets_key_file":         func(s *models.Settings, d models.Settings) { s.SecretsKeyFile = d.SecretsKeyFile },
+	"history_retention_days":   func(s *models.Settings, d models.Settings) { s.HistoryRetentionDays = d.HistoryRetentionDays },
+	"trash_retention_days":     func(s *models.Settings, d models.Settings) { s.TrashRetentionDays = d.TrashRetentionDays },
+	"backup_interval_hours":    func(s *models.Settings, d models.Settings) { s.BackupIntervalHours = d.BackupIntervalHours },
+	"backup_keep":              func(s *models.Settings, d models.Settings) { s.BackupKeep = d.BackupKeep },
+	"response_memory_limit_mb": func(s *models.Settings, d models.Settings) { s.ResponseMemoryLimitMB = d.ResponseMemoryLimitMB },
+	"default_headers":          func(s *models.Settings, d models.Settings) { s.DefaultHeaders = d.DefaultHeaders },
+	"redaction.patterns":       func(s *models.Settings, d models.Settings) { s.Redaction.Patterns = d.Redaction.Patterns },
+	"ui.theme":                 func(s *models.Settings, d models.Settings) { s.UI.Theme = d.UI.Theme },
+	"ui.font_size":             func(s *models.Settings, d models.Settings) { s.UI.FontSize = d.UI.FontSize },
+	"tls.client_cert_file": func(s *models.Settings, d models.Settings) {
+		s.TLS.ClientCertFile, s.TLS.ClientKeyFile = d.TLS.ClientCertFile, d.TLS.ClientKeyFile
+	},
+}
+
+// resetSettings returns settings with the fields of problems set to their
+// defaults.
+func resetSettings(settings models.Settings, problems []models.SettingsProblem) models.Settings {
+	defaults := DefaultSettings()
+	for _, problem := range problems {
+		settingsDefaults[problem.Field](&settings, defaults)
+	}
+	return settings
+}
+
+// FormatProblems joins problems into one message.
+func FormatProblems(problems []models.SettingsProblem) string {
+	messages := []string{}
+	for _, problem := range problems {
+		messages = append(messages, problem.Field+" "+problem.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// applySettings makes settings the ones in effect.
+func (c *Config) applySettings(settings models.Settings) {
+	c.Settings = settings
+	c.TrashRetention = time.Duration(settings.TrashRetentionDays) * 24 * time.Hour
+	c.HistoryRetention = time.Duration(settings.HistoryRetentionDays) * 24 * time.Hour
+	c.BackupInterval = time.Duration(settings.BackupIntervalHours) * time.Hour
+	c.BackupKeep = settings.BackupKeep
+	logging.SetDebug(settings.DebugLogging)
+
+	// patterns are validated before settings are applied
+	policy, _ := redactionPolicy(settings.Redaction)
+	redact.Set(policy, redact.Scopes{
+		History: settings.Redaction.History,
+		Logs:    settings.Redaction.Logs,
+		Exports: settings.Redaction.Exports,
+	})
+}
+
+func redactionPolicy(redaction models.RedactionSettings) (*redact.Policy, error) {
+	return redact.NewPolicy(redaction.Headers, redaction.JsonKeys, redaction.Patterns)
+}
+
+// SettingsInfo returns the settings in effect.
+func (c *Config) SettingsInfo() models.SettingsInfo {
+	overrides := map[string]string{}
+	for field, env := range c.overrides {
+		overrides[field] = env
+	}
+	problems := append([]models.SettingsProblem{}, c.loadProblems...)
+	return models.SettingsInfo{Settings: c.Settings, Path: c.SettingsPath, Overrides: overrides, Problems: problems}
+}
+
+// LoadProblems returns what was wrong with the settings when they were
+// loaded. Those settings are at their defaults until valid ones are saved.
+func (c *Config) LoadProblems() []models.SettingsProblem {
+	return c.loadProblems
+}
+
+// UpdateSettings validates and saves settings and puts them in effect. The
+// settings are not saved when problems are returned. Values of overridden
+// settings are ignored, and db_path only applies on the next start.
+func (c *Config) UpdateSettings(settings models.Settings) ([]models.SettingsProblem, error) {
+	for _, o := range settingsEnv {
+		if _, ok := c.overrides[o.field]; ok {
+			o.restore(&settings, c.savedSettings)
+		}
+	}
+	if settings.DefaultHeaders == nil {
+		settings.DefaultHeaders = map[string]string{}
+	}
+	if problems := ValidateSettings(settings); len(problems) > 0 {
+		return problems, nil
+	}
+
+	if err := saveSettings(c.SettingsPath, settings); err != nil {
+		return nil, fmt.Errorf("error saving settings: %v", err)
+	}
+	c.savedSettings = settings
+	effective, _, err := applyEnv(settings)
+	if err != nil {
+		return nil, err
+	}
+	// an environment variable can still be invalid, as on start
+	c.loadProblems = ValidateSettings(effective)
+	c.applySettings(resetSettings(effective, c.loadProblems))
+	return nil, nil
+}
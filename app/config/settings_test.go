@@ -0,0 +1,47 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestResetSettings(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+	settings := DefaultSettings()
+	settings.DBPath = "relative.db"
+	settings.RequestTimeoutSeconds = -1
+	settings.Proxy = "ftp://proxy.test"
+	settings.TLS.CACertFile = missing
+	settings.TLS.ClientCertFile = missing
+	settings.SecretsKeyFile = missing
+	settings.HistoryRetentionDays = -1
+	settings.TrashRetentionDays = 0
+	settings.BackupIntervalHours = -1
+	settings.BackupKeep = 0
+	settings.ResponseMemoryLimitMB = 0
+	settings.DefaultHeaders = map[string]string{"Bad Name": "x"}
+	settings.Redaction.Patterns = []string{"("}
+	settings.UI.Theme = "purple"
+	settings.UI.FontSize = 100
+	// valid settings are kept
+	settings.UI.WrapResponse = true
+	settings.TLS.InsecureSkipVerify = true
+
+	problems := ValidateSettings(settings)
+	fields := map[string]bool{}
+	for _, problem := range problems {
+		fields[problem.Field] = true
+	}
+	// every field ValidateSettings can report is made invalid above
+	if len(fields) != len(settingsDefaults) {
+		t.Fatalf("got problems %q, want one for each of the %d reset fields", FormatProblems(problems), len(settingsDefaults))
+	}
+
+	reset := resetSettings(settings, problems)
+	if left := ValidateSettings(reset); len(left) > 0 {
+		t.Errorf("problems left after resetting: %s", FormatProblems(left))
+	}
+	if !reset.UI.WrapResponse || !reset.TLS.InsecureSkipVerify {
+		t.Errorf("resetting changed valid settings: %+v", reset)
+	}
+}
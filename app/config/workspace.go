@@ -0,0 +1,206 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"posto/app/models"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The default workspace keeps the database at Dir/posto.db, or at the
+// db_path setting, other workspaces get a directory of their own below
+// Dir/workspaces. The list of workspaces and the current one are stored in
+// Dir/workspaces.json.
+const (
+	DefaultWorkspaceId = "default"
+	workspacesFile     = "workspaces.json"
+	workspacesDir      = "workspaces"
+	databaseFile       = "posto.db"
+)
+
+type workspaceEntry struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type workspaceRegistry struct {
+	Current    string           `json:"current"`
+	Workspaces []workspaceEntry `json:"workspaces"`
+}
+
+func (r *workspaceRegistry) find(id string) int {
+	for i, workspace := range r.Workspaces {
+		if workspace.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// WorkspaceDBPath returns the database file of a workspace.
+func (c *Config) WorkspaceDBPath(id string) string {
+	if id == DefaultWorkspaceId {
+		return c.defaultDBPath
+	}
+	return filepath.Join(c.Dir, workspacesDir, id, databaseFile)
+}
+
+func (c *Config) loadWorkspaces() (*workspaceRegistry, error) {
+	registry := &workspaceRegistry{}
+	content, err := os.ReadFile(filepath.Join(c.Dir, workspacesFile))
+	if err == nil {
+		if err := json.Unmarshal(content, registry); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", workspacesFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if registry.find(DefaultWorkspaceId) < 0 {
+		registry.Workspaces = append([]workspaceEntry{{Id: DefaultWorkspaceId, Name: "Default"}}, registry.Workspaces...)
+	}
+	if registry.find(registry.Current) < 0 {
+		registry.Current = DefaultWorkspaceId
+	}
+	return registry, nil
+}
+
+func (c *Config) saveWorkspaces(registry *workspaceRegistry) error {
+	content, err := json.MarshalIndent(registry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.Dir, workspacesFile), append(content, '\n'), 0644)
+}
+
+// Workspaces lists the workspaces, the default one first.
+func (c *Config) Workspaces() ([]models.Workspace, error) {
+	registry, err := c.loadWorkspaces()
+	if err != nil {
+		return nil, err
+	}
+	workspaces := []models.Workspace{}
+	for _, entry := range registry.Workspaces {
+		workspaces = append(workspaces, models.Workspace{
+			Id:        entry.Id,
+			Name:      entry.Name,
+			DBPath:    c.WorkspaceDBPath(entry.Id),
+			IsCurrent: entry.Id == c.Workspace,
+			CreatedAt: entry.CreatedAt,
+		})
+	}
+	return workspaces, nil
+}
+
+func (c *Config) findWorkspace(id string) (models.Workspace, error) {
+	workspaces, err := c.Workspaces()
+	if err != nil {
+		return models.Workspace{}, err
+	}
+	for _, workspace := range workspaces {
+		if workspace.Id == id {
+			return workspace, nil
+		}
+	}
+	return models.Workspace{}, fmt.Errorf("workspace %q does not exist", id)
+}
+
+var workspaceIdInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+
+// CreateWorkspace adds a workspace with an empty directory. Its database is
+// created when the workspace is opened.
+func (c *Config) CreateWorkspace(name string) (models.Workspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return models.Workspace{}, fmt.Errorf("workspace name is required")
+	}
+	registry, err := c.loadWorkspaces()
+	if err != nil {
+		return models.Workspace{}, err
+	}
+
+	base := strings.Trim(workspaceIdInvalid.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if base == "" {
+		base = "workspace"
+	}
+	id := base
+	for i := 2; registry.find(id) >= 0; i++ {
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.WorkspaceDBPath(id)), 0755); err != nil {
+		return models.Workspace{}, err
+	}
+	registry.Workspaces = append(registry.Workspaces, workspaceEntry{Id: id, Name: name, CreatedAt: time.Now()})
+	if err := c.saveWorkspaces(registry); err != nil {
+		return models.Workspace{}, err
+	}
+	return c.findWorkspace(id)
+}
+
+// RenameWorkspace changes the display name, the id and files stay.
+func (c *Config) RenameWorkspace(id string, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("workspace name is required")
+	}
+	registry, err := c.loadWorkspaces()
+	if err != nil {
+		return err
+	}
+	i := registry.find(id)
+	if i < 0 {
+		return fmt.Errorf("workspace %q does not exist", id)
+	}
+	registry.Workspaces[i].Name = name
+	return c.saveWorkspaces(registry)
+}
+
+// SetCurrentWorkspace makes id the workspace opened on the next start and
+// points DBPath at its database.
+func (c *Config) SetCurrentWorkspace(id string) error {
+	registry, err := c.loadWorkspaces()
+	if err != nil {
+		return err
+	}
+	if registry.find(id) < 0 {
+		return fmt.Errorf("workspace %q does not exist", id)
+	}
+	registry.Current = id
+	if err := c.saveWorkspaces(registry); err != nil {
+		return err
+	}
+	c.Workspace = id
+	c.DBPath = c.WorkspaceDBPath(id)
+	return nil
+}
+
+// DeleteWorkspace removes a workspace with its database and backups. The
+// default and the current workspace cannot be deleted.
+func (c *Config) DeleteWorkspace(id string) error {
+	if id == DefaultWorkspaceId {
+		return fmt.Errorf("the default workspace cannot be deleted")
+	}
+	if id == c.Workspace {
+		return fmt.Errorf("the current workspace cannot be deleted, switch to another one first")
+	}
+	registry, err := c.loadWorkspaces()
+	if err != nil {
+		return err
+	}
+	i := registry.find(id)
+	if i < 0 {
+		return fmt.Errorf("workspace %q does not exist", id)
+	}
+
+	if err := os.RemoveAll(filepath.Dir(c.WorkspaceDBPath(id))); err != nil {
+		return err
+	}
+	registry.Workspaces = append(registry.Workspaces[:i], registry.Workspaces[i+1:]...)
+	return c.saveWorkspaces(registry)
+}
@@ -0,0 +1,282 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"posto/app/models"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Backups are named <database>-<label>-<time>.db and kept in a backups
+// directory next to the database, so every workspace has its own.
+const backupTimeFormat = "20060102-150405"
+
+func backupDir(file string) string {
+	return filepath.Join(filepath.Dir(file), "backups")
+}
+
+// databaseFile returns the file of the open database, "" when it is in
+// memory.
+func databaseFile(dbConn *sql.DB) (string, error) {
+	var file string
+	err := dbConn.QueryRow(`SELECT file FROM pragma_database_list WHERE name = 'main'`).Scan(&file)
+	return file, err
+}
+
+func backupPrefix(file string) string {
+	return strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)) + "-"
+}
+
+// Backup copies the open database into the backups directory with VACUUM
+// INTO, which is safe while the app is using it. It returns a zero Backup
+// for in memory databases.
+func Backup(label string) (models.Backup, error) {
+	dbConn := Current()
+	if dbConn == nil {
+		return models.Backup{}, fmt.Errorf("database connection not initialized")
+	}
+	return backup(dbConn, label)
+}
+
+func backup(dbConn *sql.DB, label string) (models.Backup, error) {
+	file, err := databaseFile(dbConn)
+	if err != nil || file == "" {
+		return models.Backup{}, err
+	}
+	dir := backupDir(file)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return models.Backup{}, err
+	}
+
+	name := backupPrefix(file) + label + "-" + time.Now().Format(backupTimeFormat)
+	target := filepath.Join(dir, name+".db")
+	for i := 2; fileExists(target); i++ {
+		target = filepath.Join(dir, fmt.Sprintf("%s-%d.db", name, i))
+	}
+	if _, err := dbConn.Exec(`VACUUM INTO $1`, target); err != nil {
+		return models.Backup{}, err
+	}
+	return backupInfo(target)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func backupInfo(path string) (models.Backup, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return models.Backup{}, err
+	}
+	return models.Backup{Name: info.Name(), Path: path, Size: info.Size(), CreatedAt: info.ModTime()}, nil
+}
+
+// SelectBackups lists the backups of the open database, newest first.
+func SelectBackups() ([]models.Backup, error) {
+	dbConn := Current()
+	if dbConn == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
+	file, err := databaseFile(dbConn)
+	if err != nil {
+		return nil, err
+	}
+	backups := []models.Backup{}
+	if file == "" {
+		return backups, nil
+	}
+	dir := backupDir(file)
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return backups, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	prefix := backupPrefix(file)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) || filepath.Ext(entry.Name()) != ".db" {
+			continue
+		}
+		backup, err := backupInfo(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+// backupName matches the part of a backup name after backupPrefix: the
+// label, the time and the number added when a name was taken.
+var backupName = regexp.MustCompile(`^(.+)-(\d{8}-\d{6})(?:-\d+)?\.db$`)
+
+// backupLabel returns the label a backup was taken with, "" when name is
+// not a backup name.
+func backupLabel(prefix string, name string) string {
+	match := backupName.FindStringSubmatch(strings.TrimPrefix(name, prefix))
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// RotateBackups deletes all but the keep newest backups taken with one of
+// labels. Other backups, e.g. those taken before a migration, rollback or
+// restore, are never deleted here.
+func RotateBackups(keep int, labels ...string) error {
+	dbConn := Current()
+	if dbConn == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+	file, err := databaseFile(dbConn)
+	if err != nil {
+		return err
+	}
+	backups, err := SelectBackups()
+	if err != nil {
+		return err
+	}
+	prefix := backupPrefix(file)
+	kept := 0
+	for _, backup := range backups {
+		if !slices.Contains(labels, backupLabel(prefix, backup.Name)) {
+			continue
+		}
+		kept++
+		if kept <= keep {
+			continue
+		}
+		if err := os.Remove(backup.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckIntegrity runs SQLite's integrity check on the open database.
+func CheckIntegrity() error {
+	dbConn := Current()
+	if dbConn == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+	return checkIntegrity(dbConn)
+}
+
+func checkIntegrity(dbConn *sql.DB) error {
+	rows, err := dbConn.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	problems := []string{}
+	for rows.Next() {
+		var problem string
+		if err := rows.Scan(&problem); err != nil {
+			return err
+		}
+		if problem != "ok" {
+			problems = append(problems, problem)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("database is corrupt: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// RestoreBackup replaces the content of the open database with the backup
+// called name, using SQLite's online backup so that the connection stays
+// valid. The backup is checked first and the current database is backed up
+// before it is overwritten. The restored database is migrated to the
+// current schema.
+func RestoreBackup(name string) error {
+	dbConn := Current()
+	if dbConn == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+	file, err := databaseFile(dbConn)
+	if err != nil {
+		return err
+	}
+	if file == "" {
+		return fmt.Errorf("an in memory database has no backups")
+	}
+	if name != filepath.Base(name) || filepath.Ext(name) != ".db" {
+		return fmt.Errorf("invalid backup name %q", name)
+	}
+	path := filepath.Join(backupDir(file), name)
+	if !fileExists(path) {
+		return fmt.Errorf("backup %s does not exist", name)
+	}
+
+	source, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	source.SetMaxOpenConns(1)
+	if err := checkIntegrity(source); err != nil {
+		return fmt.Errorf("backup cannot be restored: %v", err)
+	}
+
+	if _, err := backup(dbConn, "pre-restore"); err != nil {
+		return fmt.Errorf("error backing up the current database: %v", err)
+	}
+
+	if err := copyDatabase(source, dbConn); err != nil {
+		return fmt.Errorf("error restoring backup: %v", err)
+	}
+	return MigrateDB(dbConn)
+}
+
+// copyDatabase overwrites the main database of dest with the one of src.
+func copyDatabase(src *sql.DB, dest *sql.DB) error {
+	ctx := context.Background()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	return destConn.Raw(func(destDriver any) error {
+		return srcConn.Raw(func(srcDriver any) error {
+			destSqlite, ok := destDriver.(*sqlite3.SQLiteConn)
+			srcSqlite, ok2 := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return fmt.Errorf("not a SQLite connection")
+			}
+
+			backup, err := destSqlite.Backup("main", srcSqlite, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
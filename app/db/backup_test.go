@@ -0,0 +1,88 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBackupLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"posto-auto-20250102-150405.db", "auto"},
+		{"posto-manual-20250102-150405-2.db", "manual"},
+		{"posto-pre-0003_mirror-20250102-150405.db", "pre-0003_mirror"},
+		{"posto-pre-rollback-0007_descriptions-20250102-150405.db", "pre-rollback-0007_descriptions"},
+		{"posto-auto.db", ""},
+	}
+	for _, tt := range tests {
+		if got := backupLabel("posto-", tt.name); got != tt.want {
+			t.Errorf("backupLabel(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRotateBackups(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "posto.db")
+	conn, err := OpenDB(file)
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	previous := Swap(conn)
+	t.Cleanup(func() {
+		Swap(previous)
+		conn.Close()
+	})
+
+	// oldest first
+	names := []string{
+		"posto-pre-restore-20250101-000000.db",
+		"posto-auto-20250102-000000.db",
+		"posto-pre-0011_history_truncated-20250103-000000.db",
+		"posto-manual-20250104-000000.db",
+		"posto-auto-20250105-000000.db",
+		"posto-pre-rollback-0011_history_truncated-20250106-000000.db",
+		"posto-auto-20250107-000000.db",
+	}
+	dir := backupDir(file)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Now().Add(-time.Hour)
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		modified = modified.Add(time.Minute)
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RotateBackups(2, "auto", "manual"); err != nil {
+		t.Fatalf("RotateBackups: %v", err)
+	}
+	backups, err := SelectBackups()
+	if err != nil {
+		t.Fatalf("SelectBackups: %v", err)
+	}
+	got := []string{}
+	for _, backup := range backups {
+		got = append(got, backup.Name)
+	}
+	want := []string{
+		"posto-auto-20250107-000000.db",
+		"posto-pre-rollback-0011_history_truncated-20250106-000000.db",
+		"posto-auto-20250105-000000.db",
+		"posto-pre-0011_history_truncated-20250103-000000.db",
+		"posto-pre-restore-20250101-000000.db",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("backups left:\n got %q\nwant %q", got, want)
+	}
+}
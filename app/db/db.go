@@ -4,25 +4,54 @@ import (
 	"database/sql"
 	"fmt"
 	"posto/app/config"
+	"sync/atomic"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var DB *sql.DB
+// current is the database of the open workspace. It is replaced when
+// another workspace is opened, see Swap.
+var current atomic.Pointer[sql.DB]
 
+// Current returns the database of the open workspace, nil before InitDB.
+func Current() *sql.DB {
+	return current.Load()
+}
+
+// Swap makes dbConn the database of the open workspace and returns the
+// previous one, which the caller closes once nothing uses it anymore.
+func Swap(dbConn *sql.DB) *sql.DB {
+	return current.Swap(dbConn)
+}
+
+// InitDB opens the database of the current workspace, see Current.
 func InitDB() (*sql.DB, error) {
-	var err error
 	configData := config.ConfigData
 	if configData == nil {
 		return nil, fmt.Errorf("config not initialized")
 	}
 
-	DB, err = sql.Open("sqlite3", configData.DBPath)
+	dbConn, err := OpenDB(configData.DBPath)
 	if err != nil {
 		return nil, err
 	}
+	current.Store(dbConn)
+	return dbConn, nil
+}
 
-	DB.SetMaxOpenConns(1)
+// OpenDB opens a database without making it the current one, e.g. to migrate another
+// workspace before switching to it.
+func OpenDB(path string) (*sql.DB, error) {
+	dbConn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	dbConn.SetMaxOpenConns(1)
 
-	return DB, nil
+	if err := dbConn.Ping(); err != nil {
+		dbConn.Close()
+		return nil, err
+	}
+	return dbConn, nil
 }
@@ -1,118 +1,385 @@
 package db
 
 import (
+	"crypto/sha256"
+	"database/sql"
 	"embed"
+	"encoding/hex"
 	"fmt"
+	"log/slog"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
-func Migrate() error {
-	fmt.Println("Started migration")
-	dbConn := DB
-	if dbConn == nil {
-		return fmt.Errorf("database connection not initialized")
-	}
+// Migrations are named NNNN_description.sql and numbered without gaps. A
+// migration can be reverted by an optional NNNN_description.down.sql.
+const (
+	migrationExt     = ".sql"
+	migrationDownExt = ".down.sql"
+)
 
-	files, err := migrationsFS.ReadDir("migrations")
+type migration struct {
+	Name     string
+	Up       string
+	Down     string
+	HasDown  bool
+	Checksum string
+}
+
+type appliedMigration struct {
+	Name      string
+	Checksum  string
+	CreatedAt time.Time
+}
+
+// The search index of repositories.SearchRepo is not part of the
+// migrations: it needs FTS5, which only some builds have, and it is rebuilt
+// from the file table whenever its triggers are missing. It is dropped
+// before migrations run, so that they can change the file table without
+// knowing about it.
+var searchIndexTriggers = []string{"file_search_ai", "file_search_ad", "file_search_au"}
+
+// dropSearchIndex drops the search triggers, and the index itself when FTS5
+// is available to drop it.
+func dropSearchIndex(dbConn *sql.DB) error {
+	return inTransaction(dbConn, func(tx *sql.Tx) error {
+		for _, name := range searchIndexTriggers {
+			if _, err := tx.Exec(`DROP TRIGGER IF EXISTS ` + name); err != nil {
+				return err
+			}
+		}
+		var fts bool
+		if err := tx.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts); err != nil {
+			return err
+		}
+		if !fts {
+			return nil
+		}
+		_, err := tx.Exec(`DROP TABLE IF EXISTS file_search`)
+		return err
+	})
+}
+
+// MigrationState is a migration with whether it has been applied.
+type MigrationState struct {
+	Name       string     `json:"name"`
+	Applied    bool       `json:"applied"`
+	AppliedAt  *time.Time `json:"applied_at"`
+	Reversible bool       `json:"reversible"`
+}
 
+func checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadMigrations reads the embedded migrations in order and checks that
+// they are numbered 1, 2, 3... and that every down migration has an up one.
+func loadMigrations() ([]migration, error) {
+	files, err := migrationsFS.ReadDir("migrations")
 	if err != nil {
-		return fmt.Errorf("error reading migrations directory: %v", err)
+		return nil, fmt.Errorf("error reading migrations directory: %v", err)
 	}
 
-	migration_files := []string{}
-
+	ups := map[string]string{}
+	downs := map[string]string{}
 	for _, file := range files {
-		if file.IsDir() {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), migrationExt) {
 			continue
 		}
-
-		if !strings.HasSuffix(file.Name(), ".sql") || len(file.Name()) <= 4 {
-			continue
+		content, err := migrationsFS.ReadFile(path.Join("migrations", file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration file %s: %v", file.Name(), err)
+		}
+		if name, ok := strings.CutSuffix(file.Name(), migrationDownExt); ok {
+			downs[name+migrationExt] = string(content)
+		} else {
+			ups[file.Name()] = string(content)
 		}
-
-		migration_files = append(migration_files, file.Name())
 	}
 
-	fmt.Println("Migration files:", migration_files)
-
-	// sort files by name
-	sort.Strings(migration_files)
-
-	if len(migration_files) == 0 {
-		return nil
+	migrations := []migration{}
+	for name, up := range ups {
+		down, hasDown := downs[name]
+		migrations = append(migrations, migration{Name: name, Up: up, Down: down, HasDown: hasDown, Checksum: checksum(up)})
+		delete(downs, name)
+	}
+	for name := range downs {
+		return nil, fmt.Errorf("down migration for %s has no up migration", name)
 	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Name < migrations[j].Name })
 
-	fmt.Println("Migration files to apply:", migration_files)
+	for i, m := range migrations {
+		number, _, found := strings.Cut(m.Name, "_")
+		n, err := strconv.Atoi(number)
+		if !found || err != nil {
+			return nil, fmt.Errorf("migration %s is not named NNNN_description.sql", m.Name)
+		}
+		if n != i+1 {
+			return nil, fmt.Errorf("migration %s is out of sequence, expected number %04d", m.Name, i+1)
+		}
+	}
+	return migrations, nil
+}
 
-	// Create migration talbe if not exist
-	_, err = dbConn.Exec(`
+func ensureMigrationTable(dbConn *sql.DB) error {
+	_, err := dbConn.Exec(`
 	CREATE TABLE IF NOT EXISTS migration (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		name TEXT NOT NULL,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	)
 	`)
-
 	if err != nil {
 		return fmt.Errorf("error creating migration table: %v", err)
 	}
 
-	latest_migration, err := dbConn.Query(`
-	SELECT name FROM migration ORDER BY id DESC LIMIT 1
-	`)
-
+	// checksums were added later, rows applied before are filled in by
+	// verifyMigrations
+	var hasChecksum bool
+	err = dbConn.QueryRow(`SELECT COUNT(*) > 0 FROM pragma_table_info('migration') WHERE name = 'checksum'`).Scan(&hasChecksum)
 	if err != nil {
-		return fmt.Errorf("error getting latest migration: %v", err)
+		return fmt.Errorf("error reading migration table: %v", err)
+	}
+	if !hasChecksum {
+		if _, err := dbConn.Exec(`ALTER TABLE migration ADD COLUMN checksum TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("error adding migration checksums: %v", err)
+		}
 	}
+	return nil
+}
 
-	defer latest_migration.Close()
+func selectAppliedMigrations(dbConn *sql.DB) ([]appliedMigration, error) {
+	rows, err := dbConn.Query(`SELECT name,checksum,created_at FROM migration ORDER BY id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading applied migrations: %v", err)
+	}
+	defer rows.Close()
 
-	var latest_migration_name string
-	if latest_migration.Next() {
-		err := latest_migration.Scan(&latest_migration_name)
-		if err != nil {
-			return fmt.Errorf("error scanning latest migration: %v", err)
+	applied := []appliedMigration{}
+	for rows.Next() {
+		var m appliedMigration
+		if err := rows.Scan(&m.Name, &m.Checksum, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error reading applied migrations: %v", err)
 		}
+		applied = append(applied, m)
 	}
+	return applied, rows.Err()
+}
 
-	fmt.Println("Latest migration:", latest_migration_name)
-
-	migrations_to_apply := []string{}
-	for _, migration_file := range migration_files {
-		if migration_file > latest_migration_name {
-			migrations_to_apply = append(migrations_to_apply, migration_file)
+// verifyMigrations checks that the applied migrations are the first ones
+// of migrations, in order and unchanged, and returns the pending ones.
+func verifyMigrations(dbConn *sql.DB, migrations []migration, applied []appliedMigration) ([]migration, error) {
+	if len(applied) > len(migrations) {
+		return nil, fmt.Errorf("migration %s was applied but is unknown to this version of posto", applied[len(migrations)].Name)
+	}
+	for i, m := range applied {
+		expected := migrations[i]
+		if m.Name != expected.Name {
+			if _, err := migrationsFS.ReadFile(path.Join("migrations", m.Name)); err != nil {
+				return nil, fmt.Errorf("migration %s was applied but its file is missing", m.Name)
+			}
+			return nil, fmt.Errorf("migration %s was applied out of order, expected %s", m.Name, expected.Name)
+		}
+		if m.Checksum == "" {
+			_, err := dbConn.Exec(`UPDATE migration SET checksum = $1 WHERE name = $2`, expected.Checksum, m.Name)
+			if err != nil {
+				return nil, fmt.Errorf("error storing checksum of %s: %v", m.Name, err)
+			}
+			continue
+		}
+		if m.Checksum != expected.Checksum {
+			return nil, fmt.Errorf("migration %s was modified after it was applied", m.Name)
 		}
 	}
+	return migrations[len(applied):], nil
+}
 
-	fmt.Println("Migrations to apply:", migrations_to_apply)
+// Migrate applies the pending migrations to the open database, see
+// MigrateDB.
+func Migrate() error {
+	dbConn := Current()
+	if dbConn == nil {
+		return fmt.Errorf("database connection not initialized")
+	}
+	return MigrateDB(dbConn)
+}
 
-	for _, migration_file := range migrations_to_apply {
-		file_path := path.Join("migrations", migration_file)
+// MigrateDB applies the pending migrations, each in a transaction together
+// with its migration row. The database is backed up first unless it is new,
+// and the search index is dropped.
+func MigrateDB(dbConn *sql.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if err := ensureMigrationTable(dbConn); err != nil {
+		return err
+	}
+	applied, err := selectAppliedMigrations(dbConn)
+	if err != nil {
+		return err
+	}
+	pending, err := verifyMigrations(dbConn, migrations, applied)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
 
-		migration_content, err := migrationsFS.ReadFile(file_path)
+	backupPath := ""
+	if len(applied) > 0 {
+		label := "pre-" + strings.TrimSuffix(pending[0].Name, migrationExt)
+		saved, err := backup(dbConn, label)
 		if err != nil {
-			return fmt.Errorf("error reading migration file: %v", err)
+			return fmt.Errorf("error backing up database before migrating: %v", err)
+		}
+		backupPath = saved.Path
+		if backupPath != "" {
+			slog.Info("Backed up database before migrating", "path", backupPath)
 		}
+	}
+	if err := dropSearchIndex(dbConn); err != nil {
+		return fmt.Errorf("error dropping search index: %v", err)
+	}
 
-		_, err = dbConn.Exec(string(migration_content))
+	for _, m := range pending {
+		err := inTransaction(dbConn, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(m.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO migration (name, checksum) VALUES ($1, $2)`, m.Name, m.Checksum)
+			return err
+		})
 		if err != nil {
-			return fmt.Errorf("error executing migration file: %v", err)
+			if backupPath != "" {
+				return fmt.Errorf("error applying migration %s: %v (a backup from before migrating is at %s)", m.Name, err, backupPath)
+			}
+			return fmt.Errorf("error applying migration %s: %v", m.Name, err)
+		}
+		slog.Info("Applied migration", "name", m.Name)
+	}
+	return nil
+}
+
+// Rollback reverts the last steps applied migrations with their down
+// migrations, newest first, and returns their names. Nothing is reverted
+// when one of them has no down migration.
+func Rollback(steps int) ([]string, error) {
+	dbConn := Current()
+	if dbConn == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationTable(dbConn); err != nil {
+		return nil, err
+	}
+	applied, err := selectAppliedMigrations(dbConn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := verifyMigrations(dbConn, migrations, applied); err != nil {
+		return nil, err
+	}
+	if steps > len(applied) {
+		return nil, fmt.Errorf("only %d migrations are applied", len(applied))
+	}
+
+	toRevert := []migration{}
+	for i := len(applied) - 1; i >= len(applied)-steps; i-- {
+		if !migrations[i].HasDown {
+			return nil, fmt.Errorf("migration %s has no down migration", migrations[i].Name)
 		}
+		toRevert = append(toRevert, migrations[i])
+	}
+	if len(toRevert) == 0 {
+		return []string{}, nil
+	}
+
+	label := "pre-rollback-" + strings.TrimSuffix(toRevert[0].Name, migrationExt)
+	saved, err := backup(dbConn, label)
+	if err != nil {
+		return nil, fmt.Errorf("error backing up database before rolling back: %v", err)
+	}
+	if saved.Path != "" {
+		slog.Info("Backed up database before rolling back", "path", saved.Path)
+	}
+	if err := dropSearchIndex(dbConn); err != nil {
+		return nil, fmt.Errorf("error dropping search index: %v", err)
+	}
 
-		_, err = dbConn.Exec(`
-		INSERT INTO migration (name) VALUES (?)
-		`, migration_file)
+	reverted := []string{}
+	for _, m := range toRevert {
+		err := inTransaction(dbConn, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(m.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`DELETE FROM migration WHERE name = $1`, m.Name)
+			return err
+		})
 		if err != nil {
-			return fmt.Errorf("error inserting migration: %v", err)
+			return reverted, fmt.Errorf("error reverting migration %s: %v", m.Name, err)
 		}
+		slog.Info("Reverted migration", "name", m.Name)
+		reverted = append(reverted, m.Name)
 	}
+	return reverted, nil
+}
 
-	fmt.Println("All migrations applied successfully")
+// MigrationStatus lists every known migration and whether it is applied,
+// after checking the applied ones like Migrate does.
+func MigrationStatus() ([]MigrationState, error) {
+	dbConn := Current()
+	if dbConn == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
 
-	return nil
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationTable(dbConn); err != nil {
+		return nil, err
+	}
+	applied, err := selectAppliedMigrations(dbConn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := verifyMigrations(dbConn, migrations, applied); err != nil {
+		return nil, err
+	}
+
+	states := []MigrationState{}
+	for i, m := range migrations {
+		state := MigrationState{Name: m.Name, Reversible: m.HasDown}
+		if i < len(applied) {
+			state.Applied = true
+			state.AppliedAt = &applied[i].CreatedAt
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+func inTransaction(dbConn *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// openMemoryDB makes a new in memory database the current one for the test.
+func openMemoryDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn, err := OpenDB(":memory:")
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	previous := Swap(conn)
+	t.Cleanup(func() {
+		Swap(previous)
+		conn.Close()
+	})
+	return conn
+}
+
+// schema returns the definition of every table, index and trigger but the
+// migration table.
+func schema(t *testing.T, conn *sql.DB) []string {
+	t.Helper()
+	rows, err := conn.Query(`
+		SELECT type || ' ' || name || ': ' || COALESCE(sql, '') FROM sqlite_master
+		WHERE name NOT LIKE 'sqlite_%' AND name != 'migration' ORDER BY type, name
+	`)
+	if err != nil {
+		t.Fatalf("reading schema: %v", err)
+	}
+	defer rows.Close()
+	definitions := []string{}
+	for rows.Next() {
+		var definition string
+		if err := rows.Scan(&definition); err != nil {
+			t.Fatalf("reading schema: %v", err)
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions
+}
+
+func appliedCount(t *testing.T) int {
+	t.Helper()
+	states, err := MigrationStatus()
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	count := 0
+	for _, state := range states {
+		if state.Applied {
+			count++
+		}
+	}
+	return count
+}
+
+func TestMigrateDB(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	conn := openMemoryDB(t)
+
+	if err := MigrateDB(conn); err != nil {
+		t.Fatalf("MigrateDB: %v", err)
+	}
+	if got := appliedCount(t); got != len(migrations) {
+		t.Errorf("%d migrations applied, want %d", got, len(migrations))
+	}
+	migrated := schema(t, conn)
+	if len(migrated) == 0 {
+		t.Fatal("MigrateDB created no tables")
+	}
+
+	// a second run has nothing left to do
+	if err := MigrateDB(conn); err != nil {
+		t.Fatalf("MigrateDB again: %v", err)
+	}
+	if got := schema(t, conn); !reflect.DeepEqual(got, migrated) {
+		t.Errorf("schema changed by a second MigrateDB:\n got %q\nwant %q", got, migrated)
+	}
+}
+
+func TestMigrateDBRejectsChangedHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  string
+		wantErr string
+	}{
+		{"modified migration", `UPDATE migration SET checksum = 'changed' WHERE id = 1`, "was modified after it was applied"},
+		{"unknown migration", `INSERT INTO migration (name, checksum) VALUES ('9999_unknown.sql', 'x')`, "is unknown to this version"},
+		{"missing migration", `UPDATE migration SET name = '0002_missing.sql' WHERE id = 2`, "its file is missing"},
+		{"out of order", `UPDATE migration SET name = CASE id WHEN 1 THEN '0002_assertions_environments.sql' ELSE '0001_init.sql' END WHERE id <= 2`, "was applied out of order"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := openMemoryDB(t)
+			if err := MigrateDB(conn); err != nil {
+				t.Fatalf("MigrateDB: %v", err)
+			}
+			if _, err := conn.Exec(tt.change); err != nil {
+				t.Fatalf("changing the migration table: %v", err)
+			}
+			if err := MigrateDB(conn); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("MigrateDB error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+
+	// every migration but the first one can be reverted, and applied again
+	for steps := 0; steps < len(migrations); steps++ {
+		conn := openMemoryDB(t)
+		if err := MigrateDB(conn); err != nil {
+			t.Fatalf("MigrateDB: %v", err)
+		}
+		migrated := schema(t, conn)
+
+		reverted, err := Rollback(steps)
+		if err != nil {
+			t.Fatalf("Rollback(%d): %v", steps, err)
+		}
+		want := []string{}
+		for i := len(migrations) - 1; i >= len(migrations)-steps; i-- {
+			want = append(want, migrations[i].Name)
+		}
+		if !reflect.DeepEqual(reverted, want) {
+			t.Errorf("Rollback(%d) reverted %q, want %q", steps, reverted, want)
+		}
+		if got := appliedCount(t); got != len(migrations)-steps {
+			t.Errorf("Rollback(%d) left %d migrations applied, want %d", steps, got, len(migrations)-steps)
+		}
+
+		if err := MigrateDB(conn); err != nil {
+			t.Fatalf("MigrateDB after Rollback(%d): %v", steps, err)
+		}
+		if got := schema(t, conn); !reflect.DeepEqual(got, migrated) {
+			t.Errorf("schema after Rollback(%d) and MigrateDB:\n got %q\nwant %q", steps, got, migrated)
+		}
+	}
+}
+
+func TestRollbackRejected(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	tests := []struct {
+		name    string
+		steps   int
+		wantErr string
+	}{
+		{"past a migration without down", len(migrations), "has no down migration"},
+		{"more than applied", len(migrations) + 1, "migrations are applied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := openMemoryDB(t)
+			if err := MigrateDB(conn); err != nil {
+				t.Fatalf("MigrateDB: %v", err)
+			}
+			reverted, err := Rollback(tt.steps)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Rollback(%d) error = %v, want %q", tt.steps, err, tt.wantErr)
+			}
+			if len(reverted) > 0 {
+				t.Errorf("Rollback(%d) reverted %q", tt.steps, reverted)
+			}
+			if got := appliedCount(t); got != len(migrations) {
+				t.Errorf("%d migrations applied after a rejected rollback, want %d", got, len(migrations))
+			}
+		})
+	}
+}
+
+func TestMigrationsDropSearchIndex(t *testing.T) {
+	conn := openMemoryDB(t)
+	if err := MigrateDB(conn); err != nil {
+		t.Fatalf("MigrateDB: %v", err)
+	}
+	// a search trigger on a column that a down migration drops, as the
+	// search repository creates them
+	if _, err := conn.Exec(`
+		CREATE TRIGGER file_search_au AFTER UPDATE OF description ON file BEGIN
+			SELECT new.description;
+		END
+	`); err != nil {
+		t.Fatalf("creating search trigger: %v", err)
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	steps := 0
+	for i := len(migrations) - 1; migrations[i].Name != "0007_descriptions.sql"; i-- {
+		steps++
+	}
+	if _, err := Rollback(steps + 1); err != nil {
+		t.Fatalf("Rollback past 0007_descriptions: %v", err)
+	}
+	var triggers int
+	if err := conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'file_search_%'`).Scan(&triggers); err != nil {
+		t.Fatalf("counting triggers: %v", err)
+	}
+	if triggers != 0 {
+		t.Errorf("%d search triggers left after Rollback", triggers)
+	}
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS environment;
+ALTER TABLE file DROP COLUMN assertions;
@@ -0,0 +1,9 @@
+ALTER TABLE file ADD COLUMN assertions JSON;
+CREATE TABLE IF NOT EXISTS environment (
+    pk_environment_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    variables JSON NOT NULL DEFAULT '[]',
+    is_active BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
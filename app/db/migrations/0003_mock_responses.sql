@@ -0,0 +1 @@
+ALTER TABLE file ADD COLUMN mock JSON;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_example_file_id;
+DROP TABLE IF EXISTS example;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS example (
+    pk_example_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    file_id INTEGER NOT NULL REFERENCES file(pk_file_id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 200,
+    content_type TEXT NOT NULL DEFAULT '',
+    headers JSON NOT NULL DEFAULT '{}',
+    body TEXT NOT NULL DEFAULT '',
+    is_binary BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_example_file_id ON example(file_id);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS history (
+    pk_history_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    file_id INTEGER REFERENCES file(pk_file_id) ON DELETE SET NULL,
+    method TEXT NOT NULL,
+    url TEXT NOT NULL,
+    request_headers JSON NOT NULL DEFAULT '{}',
+    request_body TEXT NOT NULL DEFAULT '',
+    status_code INTEGER NOT NULL DEFAULT 0,
+    content_type TEXT NOT NULL DEFAULT '',
+    response_headers JSON NOT NULL DEFAULT '{}',
+    response_body TEXT NOT NULL DEFAULT '',
+    is_binary BOOLEAN NOT NULL DEFAULT FALSE,
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_history_created_at ON history(created_at);
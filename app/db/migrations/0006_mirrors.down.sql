@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS mirror_entry;
+DROP TABLE IF EXISTS mirror;
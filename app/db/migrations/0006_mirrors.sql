@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS mirror (
+    pk_mirror_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    collection_id INTEGER NOT NULL UNIQUE REFERENCES collection(pk_collection_id),
+    path TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS mirror_entry (
+    pk_mirror_entry_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    mirror_id INTEGER NOT NULL REFERENCES mirror(pk_mirror_id) ON DELETE CASCADE,
+    file_id INTEGER NOT NULL,
+    path TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    synced_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(mirror_id, file_id)
+);
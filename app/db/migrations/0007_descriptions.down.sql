@@ -0,0 +1,2 @@
+ALTER TABLE file DROP COLUMN description;
+ALTER TABLE collection DROP COLUMN description;
@@ -0,0 +1,2 @@
+ALTER TABLE collection ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE file ADD COLUMN description TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_revision_file_id;
+DROP TABLE IF EXISTS revision;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS revision (
+    pk_revision_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    file_id INTEGER NOT NULL REFERENCES file(pk_file_id) ON DELETE CASCADE,
+    name TEXT NOT NULL DEFAULT '',
+    method TEXT NOT NULL DEFAULT '',
+    url TEXT NOT NULL DEFAULT '',
+    headers JSON NOT NULL DEFAULT '{}',
+    body TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_revision_file_id ON revision(file_id);
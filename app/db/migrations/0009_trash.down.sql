@@ -0,0 +1,4 @@
+-- rows in the trash become visible again
+DROP INDEX IF EXISTS idx_file_deleted_at;
+ALTER TABLE file DROP COLUMN deleted_at;
+ALTER TABLE collection DROP COLUMN deleted_at;
@@ -0,0 +1,3 @@
+ALTER TABLE collection ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE file ADD COLUMN deleted_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_file_deleted_at ON file(deleted_at);
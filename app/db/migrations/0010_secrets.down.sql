@@ -0,0 +1,2 @@
+-- sealed variable values stay in the environments but cannot be decrypted
+DROP TABLE IF EXISTS vault;
@@ -0,0 +1,9 @@
+-- how the key of secret variables is derived, at most one row
+CREATE TABLE IF NOT EXISTS vault (
+    pk_vault_id INTEGER PRIMARY KEY CHECK (pk_vault_id = 1),
+    method TEXT NOT NULL,
+    salt TEXT NOT NULL,
+    iterations INTEGER NOT NULL,
+    check_value TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1 @@
+ALTER TABLE history ADD COLUMN truncated BOOLEAN NOT NULL DEFAULT FALSE;
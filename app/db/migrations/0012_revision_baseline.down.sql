@@ -0,0 +1 @@
+ALTER TABLE revision DROP COLUMN is_baseline;
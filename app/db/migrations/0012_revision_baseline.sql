@@ -0,0 +1,5 @@
+ALTER TABLE revision ADD COLUMN is_baseline BOOLEAN NOT NULL DEFAULT FALSE;
+-- a request with a single revision has only been saved over its baseline
+UPDATE revision SET is_baseline = TRUE WHERE pk_revision_id IN (
+    SELECT MIN(pk_revision_id) FROM revision GROUP BY file_id HAVING COUNT(*) = 1
+);
@@ -0,0 +1,157 @@
+// Package logging sets up the structured logger of the app: slog records
+// are redacted with the logs policy and written to a rotating file, which
+// Tail reads back for bug reports.
+package logging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"posto/app/redact"
+	"strings"
+	"sync"
+)
+
+const (
+	fileName    = "posto.log"
+	maxFileSize = 5 << 20
+	keepFiles   = 3
+	// MaxTailLines limits the lines returned by Tail.
+	MaxTailLines = 2000
+)
+
+// level is shared by every handler set up, so that debug logging can be
+// toggled while the app runs.
+var level slog.LevelVar
+
+var (
+	mu   sync.Mutex
+	file *rotatingFile
+)
+
+// Setup makes the default logger write to posto.log in dir and, when
+// console is not nil, to console from consoleLevel on. A nil consoleLevel
+// follows SetDebug like the file.
+func Setup(dir string, console io.Writer, consoleLevel slog.Leveler) error {
+	f, err := openRotatingFile(filepath.Join(dir, fileName), maxFileSize, keepFiles)
+	if err != nil {
+		return err
+	}
+	handlers := []slog.Handler{slog.NewTextHandler(f, &slog.HandlerOptions{Level: &level})}
+	if console != nil {
+		if consoleLevel == nil {
+			consoleLevel = &level
+		}
+		handlers = append(handlers, slog.NewTextHandler(console, &slog.HandlerOptions{Level: consoleLevel}))
+	}
+	slog.SetDefault(slog.New(redact.NewHandler(fanout(handlers))))
+
+	mu.Lock()
+	previous := file
+	file = f
+	mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// SetDebug turns the debug records on or off, among them the headers and
+// bodies of the requests sent and their responses.
+func SetDebug(enabled bool) {
+	if enabled {
+		level.Set(slog.LevelDebug)
+	} else {
+		level.Set(slog.LevelInfo)
+	}
+}
+
+func Debug() bool {
+	return level.Level() <= slog.LevelDebug
+}
+
+// Path returns the log file, empty before Setup.
+func Path() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if file == nil {
+		return ""
+	}
+	return file.path
+}
+
+// Tail returns the last n lines of the log, continuing into the previous
+// file after a rotation. n is capped at MaxTailLines.
+func Tail(n int) ([]string, error) {
+	path := Path()
+	if path == "" {
+		return nil, errors.New("logging is not set up")
+	}
+	if n <= 0 || n > MaxTailLines {
+		n = MaxTailLines
+	}
+
+	lines := []string{}
+	for _, p := range []string{path, rotatedPath(path, 1)} {
+		content, err := os.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		text := strings.TrimRight(string(content), "\n")
+		if text == "" {
+			continue
+		}
+		lines = append(strings.Split(text, "\n"), lines...)
+		if len(lines) >= n {
+			break
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// fanout passes records to every handler enabled for them.
+type fanout []slog.Handler
+
+func (f fanout) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanout) Handle(ctx context.Context, record slog.Record) error {
+	errs := []error{}
+	for _, h := range f {
+		if h.Enabled(ctx, record.Level) {
+			errs = append(errs, h.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := fanout{}
+	for _, h := range f {
+		handlers = append(handlers, h.WithAttrs(attrs))
+	}
+	return handlers
+}
+
+func (f fanout) WithGroup(name string) slog.Handler {
+	handlers := fanout{}
+	for _, h := range f {
+		handlers = append(handlers, h.WithGroup(name))
+	}
+	return handlers
+}
@@ -0,0 +1,21 @@
+package models
+
+// Assertion is a single check evaluated against a response after a request
+// has been executed. Assertions are stored as a JSON array on the file row.
+type Assertion struct {
+	// Source is one of status, header, body, json or duration.
+	Source string `json:"source"`
+	// Property is the header name for header assertions or a dotted path
+	// (e.g. data.items.0.id) for json assertions.
+	Property string `json:"property,omitempty"`
+	// Operator is one of eq, neq, contains, not_contains, gt, lt, exists or matches.
+	Operator string `json:"operator"`
+	Expected string `json:"expected,omitempty"`
+}
+
+type AssertionResult struct {
+	Assertion Assertion `json:"assertion"`
+	Passed    bool      `json:"passed"`
+	Actual    string    `json:"actual"`
+	Message   string    `json:"message,omitempty"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Backup is a copy of the database in the backups directory.
+type Backup struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+type Variable struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Enabled bool   `json:"enabled"`
+	// Secret values are stored sealed, see services.SealVariables.
+	Secret bool `json:"secret,omitempty"`
+}
+
+type Environment struct {
+	PkEnvironmentId int64      `json:"pk_environment_id"`
+	Name            string     `json:"name"`
+	Variables       []Variable `json:"variables"`
+	IsActive        bool       `json:"is_active"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// VariableMap returns the enabled variables keyed by name. Secret variables
+// are left out, see services.RevealVariables.
+func (e *Environment) VariableMap() map[string]string {
+	vars := map[string]string{}
+	for _, v := range e.Variables {
+		if v.Enabled && v.Key != "" && !v.Secret {
+			vars[v.Key] = v.Value
+		}
+	}
+	return vars
+}
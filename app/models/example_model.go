@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Example is a saved response attached to a request file, used for
+// documentation and mock serving.
+type Example struct {
+	PkExampleId int64             `json:"pk_example_id"`
+	FileId      int64             `json:"file_id"`
+	Name        string            `json:"name"`
+	StatusCode  int               `json:"status_code"`
+	ContentType string            `json:"content_type"`
+	Headers     map[string]string `json:"headers"`
+	// Body is base64-encoded when IsBinary is true, like HttpResponse.Body.
+	Body      string    `json:"body"`
+	IsBinary  bool      `json:"is_binary"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
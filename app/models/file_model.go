@@ -7,11 +7,15 @@ type File struct {
 	Name         string    `json:"name"`
 	CollectionId int64     `json:"collection_id"`
 	IsFolder     bool      `json:"is_folder"`
-	ParentId     int64     `json:"parent_id"`
+	ParentId     *int64    `json:"parent_id"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 	Method       *string   `json:"method"`
 	Url          *string   `json:"url"`
 	Headers      *string   `json:"headers"`
 	Body         *string   `json:"body"`
+	Assertions   *string   `json:"assertions"`
+	Mock         *string   `json:"mock"`
+	// Description is Markdown, used for folders and requests.
+	Description string `json:"description"`
 }
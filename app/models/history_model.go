@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// HistoryEntry is a request sent from the app together with its response.
+type HistoryEntry struct {
+	PkHistoryId     int64             `json:"pk_history_id"`
+	FileId          *int64            `json:"file_id"`
+	Method          string            `json:"method"`
+	Url             string            `json:"url"`
+	RequestHeaders  map[string]string `json:"request_headers"`
+	RequestBody     string            `json:"request_body"`
+	StatusCode      int               `json:"status_code"`
+	ContentType     string            `json:"content_type"`
+	ResponseHeaders map[string]string `json:"response_headers"`
+	// ResponseBody is base64-encoded when IsBinary is true.
+	ResponseBody string `json:"response_body"`
+	IsBinary     bool   `json:"is_binary"`
+	// Truncated is set when ResponseBody only holds the start of a body
+	// larger than the memory limit.
+	Truncated  bool      `json:"truncated"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
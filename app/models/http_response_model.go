@@ -0,0 +1,44 @@
+package models
+
+// HttpResponse is the structured result returned to the frontend after an HTTP request.
+type HttpResponse struct {
+	StatusCode  int               `json:"status_code"`
+	ContentType string            `json:"content_type"`
+	Headers     map[string]string `json:"headers"`
+	// Body holds the response body as a UTF-8 string (JSON / plain text) or
+	// a base64-encoded string when IsBinary is true.
+	Body       string `json:"body"`
+	IsBinary   bool   `json:"is_binary"`
+	DurationMs int64  `json:"duration_ms"`
+	// Size is the size of the whole body, also when it is truncated.
+	Size int64 `json:"size"`
+	// Truncated is set when the body was larger than the memory limit:
+	// Body only holds its start and BodyId names the temporary file
+	// holding all of it, see FileApi.SaveResponseBody.
+	Truncated bool   `json:"truncated,omitempty"`
+	BodyId    string `json:"body_id,omitempty"`
+	// Wire is what went over the connection, one exchange per request
+	// sent, so that every redirect adds one. It is also set when the
+	// request failed.
+	Wire []WireExchange `json:"wire,omitempty"`
+}
+
+// WireExchange is a request as the transport wrote it, headers it added
+// included, and the head of the response it got.
+type WireExchange struct {
+	Request string `json:"request"`
+	// Response is the status line and headers, empty when no response
+	// came.
+	Response string `json:"response"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ResponseProgress reports how much of a response body was received, it is
+// emitted as the response:progress event while a request of the UI runs.
+type ResponseProgress struct {
+	FileId   int   `json:"file_id"`
+	Received int64 `json:"received"`
+	// Total is the Content-Length of the response, -1 when unknown.
+	Total int64 `json:"total"`
+	Done  bool  `json:"done"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// LogTail is the end of the log file, e.g. to attach to a bug report.
+type LogTail struct {
+	Path  string   `json:"path"`
+	Lines []string `json:"lines"`
+	// Debug tells whether requests and responses are logged in full.
+	Debug bool `json:"debug"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Mirror links a collection to a directory of request files.
+type Mirror struct {
+	PkMirrorId   int64     `json:"pk_mirror_id"`
+	CollectionId int64     `json:"collection_id"`
+	Path         string    `json:"path"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// MirrorEntry is the state of a file or folder at the last sync. Path is
+// relative to the mirror directory and Hash is the hash of the written
+// content, used to tell which side changed since.
+type MirrorEntry struct {
+	FileId   int64     `json:"file_id"`
+	Path     string    `json:"path"`
+	Hash     string    `json:"hash"`
+	SyncedAt time.Time `json:"synced_at"`
+}
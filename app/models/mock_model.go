@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// MockResponse is what the mock server answers for a request file. It is
+// stored as JSON on the file row.
+type MockResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	// Body may contain templated values such as {{request.params.id}},
+	// {{request.query.page}}, {{request.headers.X-Token}},
+	// {{request.body.user.name}}, {{$uuid}}, {{$timestamp}} or {{$randomInt}}.
+	Body     string `json:"body"`
+	IsBinary bool   `json:"is_binary,omitempty"`
+	DelayMs  int    `json:"delay_ms"`
+	// Example names a saved example of the request whose status, headers
+	// and body are served instead of the fields above.
+	Example string `json:"example,omitempty"`
+}
+
+// MockRequestLog is an entry of the log of requests that hit the mock server.
+type MockRequestLog struct {
+	Time          time.Time         `json:"time"`
+	Method        string            `json:"method"`
+	Path          string            `json:"path"`
+	Query         string            `json:"query"`
+	Headers       map[string]string `json:"headers"`
+	Body          string            `json:"body"`
+	MatchedFileId *int64            `json:"matched_file_id"`
+	MatchedName   string            `json:"matched_name"`
+	Status        int               `json:"status"`
+	DurationMs    int64             `json:"duration_ms"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// ProxyCapture is a request/response pair recorded by the recording proxy.
+type ProxyCapture struct {
+	Id              int64             `json:"id"`
+	Time            time.Time         `json:"time"`
+	Method          string            `json:"method"`
+	Url             string            `json:"url"`
+	RequestHeaders  map[string]string `json:"request_headers"`
+	RequestBody     string            `json:"request_body"`
+	StatusCode      int               `json:"status_code"`
+	ResponseHeaders map[string]string `json:"response_headers"`
+	ContentType     string            `json:"content_type"`
+	// ResponseBody is base64-encoded when IsBinary is true.
+	ResponseBody string `json:"response_body"`
+	IsBinary     bool   `json:"is_binary"`
+	// RequestTruncated and ResponseTruncated are set when the body was
+	// larger than the capture limit and only its start was kept.
+	RequestTruncated  bool   `json:"request_truncated"`
+	ResponseTruncated bool   `json:"response_truncated"`
+	DurationMs        int64  `json:"duration_ms"`
+	Error             string `json:"error,omitempty"`
+}
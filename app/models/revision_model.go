@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Revision is a saved state of a request file. Auto-saves made shortly after
+// each other update the same revision, so UpdatedAt is the time of the last
+// save it covers.
+type Revision struct {
+	PkRevisionId int64  `json:"pk_revision_id"`
+	FileId       int64  `json:"file_id"`
+	Name         string `json:"name"`
+	Method       string `json:"method"`
+	Url          string `json:"url"`
+	// Headers is a JSON object like File.Headers
+	Headers string `json:"headers"`
+	Body    string `json:"body"`
+	// IsBaseline marks the state a request had before its first tracked
+	// save. Later saves never update it.
+	IsBaseline bool      `json:"is_baseline"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// RevisionDiff lists the fields that differ between two revisions.
+type RevisionDiff struct {
+	From    Revision         `json:"from"`
+	To      Revision         `json:"to"`
+	Changes []RevisionChange `json:"changes"`
+}
+
+// RevisionChange is a changed field with a line diff of its values. Headers
+// are compared as one "Name: value" line per header.
+type RevisionChange struct {
+	Field string     `json:"field"`
+	From  string     `json:"from"`
+	To    string     `json:"to"`
+	Lines []DiffLine `json:"lines"`
+}
+
+// DiffLine is a line of a diff. Op is " " for unchanged, "-" for removed and
+// "+" for added lines.
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
@@ -0,0 +1,17 @@
+package models
+
+// SearchHit is a file matching a search query. Snippet is HTML escaped with
+// the matched terms wrapped in <mark>.
+type SearchHit struct {
+	FileId         int64  `json:"file_id"`
+	CollectionId   int64  `json:"collection_id"`
+	CollectionName string `json:"collection_name"`
+	// Breadcrumbs holds the names of the enclosing folders, outermost first.
+	Breadcrumbs []string `json:"breadcrumbs"`
+	Name        string   `json:"name"`
+	IsFolder    bool     `json:"is_folder"`
+	Method      *string  `json:"method"`
+	Url         *string  `json:"url"`
+	Snippet     string   `json:"snippet"`
+	Rank        float64  `json:"rank"`
+}
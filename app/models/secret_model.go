@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Vault describes how the key of the secret variables is derived. The key
+// itself is never stored, CheckValue is a known value sealed with it to
+// verify a password or key file.
+type Vault struct {
+	Method     string    `json:"method"`
+	Salt       string    `json:"salt"`
+	Iterations int       `json:"iterations"`
+	CheckValue string    `json:"check_value"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type SecretStatus struct {
+	// Configured is false until a master password or key file is set up.
+	Configured bool   `json:"configured"`
+	Method     string `json:"method"`
+	Unlocked   bool   `json:"unlocked"`
+}
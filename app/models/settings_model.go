@@ -0,0 +1,84 @@
+package models
+
+// Settings are the user preferences stored in settings.json. Durations are
+// whole units so that the file is easy to edit by hand.
+type Settings struct {
+	// DBPath replaces the database file of the default workspace, empty
+	// keeps it in the data directory.
+	DBPath string `json:"db_path"`
+	// RequestTimeoutSeconds limits every request sent, 0 waits forever.
+	RequestTimeoutSeconds int `json:"request_timeout_seconds"`
+	// ResponseMemoryLimitMB is the size above which response bodies are
+	// written to a temporary file, the UI then gets a preview.
+	ResponseMemoryLimitMB int `json:"response_memory_limit_mb"`
+	// Proxy is the URL of the proxy requests go through, empty uses the
+	// HTTP_PROXY and HTTPS_PROXY environment variables.
+	Proxy                string            `json:"proxy"`
+	TLS                  TLSSettings       `json:"tls"`
+	HistoryRetentionDays int               `json:"history_retention_days"`
+	TrashRetentionDays   int               `json:"trash_retention_days"`
+	BackupIntervalHours  int               `json:"backup_interval_hours"`
+	BackupKeep           int               `json:"backup_keep"`
+	DefaultHeaders       map[string]string `json:"default_headers"`
+	// SecretsKeyFile unlocks secret variables on start when they were set
+	// up with a key file.
+	SecretsKeyFile string `json:"secrets_key_file"`
+	// DebugLogging also logs the headers and bodies of requests and
+	// responses.
+	DebugLogging bool `json:"debug_logging"`
+	// Redaction removes sensitive values from what is stored or leaves
+	// the app.
+	Redaction RedactionSettings `json:"redaction"`
+	UI        UISettings        `json:"ui"`
+}
+
+type TLSSettings struct {
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+	// CACertFile is a PEM file of certificates trusted in addition to the
+	// system ones.
+	CACertFile     string `json:"ca_cert_file"`
+	ClientCertFile string `json:"client_cert_file"`
+	ClientKeyFile  string `json:"client_key_file"`
+}
+
+// RedactionSettings tell which values are replaced by [REDACTED] and
+// where. Headers and JSON keys are matched case insensitively, JSON keys
+// also match query and form fields, and Patterns are regular expressions
+// matched anywhere.
+type RedactionSettings struct {
+	Headers  []string `json:"headers"`
+	JsonKeys []string `json:"json_keys"`
+	Patterns []string `json:"patterns"`
+	// History redacts history entries when they are stored, Logs the log
+	// records and Exports exported collections, HAR files and reports.
+	History bool `json:"history"`
+	Logs    bool `json:"logs"`
+	Exports bool `json:"exports"`
+}
+
+// UISettings are only stored for the frontend, the backend does not use
+// them.
+type UISettings struct {
+	Theme        string `json:"theme"`
+	FontSize     int    `json:"font_size"`
+	WrapResponse bool   `json:"wrap_response"`
+}
+
+// SettingsInfo is what SettingsApi reports: the settings in effect, where
+// they are stored and which ones environment variables override.
+type SettingsInfo struct {
+	Settings Settings `json:"settings"`
+	Path     string   `json:"path"`
+	// Overrides maps the field of each overridden setting to its
+	// environment variable.
+	Overrides map[string]string `json:"overrides"`
+	// Problems is what was wrong with the settings when they were loaded,
+	// e.g. a certificate file that was moved. Those settings are at their
+	// defaults until valid ones are saved.
+	Problems []SettingsProblem `json:"problems"`
+}
+
+type SettingsProblem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
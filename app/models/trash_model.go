@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// TrashItem is a collection, folder or request in the trash. Folders are
+// listed once, the requests trashed with them are restored along with them.
+type TrashItem struct {
+	// Kind is "collection" or "file"
+	Kind           string    `json:"kind"`
+	Id             int64     `json:"id"`
+	Name           string    `json:"name"`
+	IsFolder       bool      `json:"is_folder"`
+	CollectionId   int64     `json:"collection_id"`
+	CollectionName string    `json:"collection_name"`
+	ParentId       *int64    `json:"parent_id"`
+	ParentName     *string   `json:"parent_name"`
+	DeletedAt      time.Time `json:"deleted_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Workspace is a separate set of collections, environments and history,
+// stored in its own database.
+type Workspace struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	DBPath    string    `json:"db_path"`
+	IsCurrent bool      `json:"is_current"`
+	CreatedAt time.Time `json:"created_at"`
+}
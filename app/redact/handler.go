@@ -0,0 +1,78 @@
+package redact
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Handler redacts log records with the Logs policy before passing them to
+// the wrapped handler: attributes named like a sensitive header or field
+// are replaced by Marker, and the patterns are applied to the message and
+// string values.
+type Handler struct {
+	handler slog.Handler
+}
+
+func NewHandler(handler slog.Handler) *Handler {
+	return &Handler{handler: handler}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *Handler) Handle(ctx context.Context, record slog.Record) error {
+	policy := Logs()
+	if policy == nil {
+		return h.handler.Handle(ctx, record)
+	}
+	redacted := slog.NewRecord(record.Time, record.Level, policy.Text(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(policy, attr))
+		return true
+	})
+	return h.handler.Handle(ctx, redacted)
+}
+
+// WithAttrs redacts attrs with the policy in effect now, since the wrapped
+// handler may format them right away.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	policy := Logs()
+	redacted := []slog.Attr{}
+	for _, attr := range attrs {
+		redacted = append(redacted, redactAttr(policy, attr))
+	}
+	return &Handler{handler: h.handler.WithAttrs(redacted)}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{handler: h.handler.WithGroup(name)}
+}
+
+func redactAttr(policy *Policy, attr slog.Attr) slog.Attr {
+	if policy == nil {
+		return attr
+	}
+	value := attr.Value.Resolve()
+	switch {
+	case value.Kind() == slog.KindGroup:
+		attrs := []any{}
+		for _, member := range value.Group() {
+			attrs = append(attrs, redactAttr(policy, member))
+		}
+		return slog.Group(attr.Key, attrs...)
+	case policy.IsHeader(attr.Key) || policy.IsKey(attr.Key):
+		return slog.String(attr.Key, Marker)
+	case value.Kind() == slog.KindString:
+		return slog.String(attr.Key, policy.Body(value.String()))
+	case value.Kind() == slog.KindAny:
+		switch v := value.Any().(type) {
+		case map[string]string:
+			return slog.Any(attr.Key, policy.Headers(v))
+		case error:
+			// errors may quote URLs
+			return slog.String(attr.Key, policy.Url(v.Error()))
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
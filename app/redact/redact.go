@@ -0,0 +1,233 @@
+package redact
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Marker replaces every removed value.
+const Marker = "[REDACTED]"
+
+// Policy removes sensitive values from headers, URLs and bodies. A nil
+// Policy removes nothing.
+type Policy struct {
+	headers map[string]bool
+	keys    map[string]bool
+	// jsonKeys matches "key": <scalar> and queryKeys key=value pairs, for
+	// keys; both are nil without keys.
+	jsonKeys  *regexp.Regexp
+	queryKeys *regexp.Regexp
+	patterns  []*regexp.Regexp
+}
+
+// NewPolicy builds a policy removing the values of the headers, of the
+// JSON, query and form fields named keys (both case insensitive) and the
+// matches of patterns anywhere.
+func NewPolicy(headers []string, keys []string, patterns []string) (*Policy, error) {
+	p := &Policy{headers: map[string]bool{}, keys: map[string]bool{}}
+	for _, header := range headers {
+		p.headers[http.CanonicalHeaderKey(strings.TrimSpace(header))] = true
+	}
+
+	quoted := []string{}
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		p.keys[strings.ToLower(key)] = true
+		quoted = append(quoted, regexp.QuoteMeta(key))
+	}
+	if len(quoted) > 0 {
+		names := strings.Join(quoted, "|")
+		p.jsonKeys = regexp.MustCompile(`(?i)("(?:` + names + `)"\s*:\s*)("(?:[^"\\]|\\.)*"|-?[0-9][0-9.eE+-]*|true|false)`)
+		p.queryKeys = regexp.MustCompile(`(?i)((?:^|[?&;])(?:` + names + `)=)([^&;#\s"]*)`)
+	}
+
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		p.patterns = append(p.patterns, re)
+	}
+	return p, nil
+}
+
+// IsHeader reports whether the value of a header is removed.
+func (p *Policy) IsHeader(name string) bool {
+	return p != nil && p.headers[http.CanonicalHeaderKey(name)]
+}
+
+// IsKey reports whether the value of a field is removed.
+func (p *Policy) IsKey(name string) bool {
+	return p != nil && p.keys[strings.ToLower(name)]
+}
+
+// Header returns the value of a header with sensitive parts removed.
+func (p *Policy) Header(name string, value string) string {
+	if p.IsHeader(name) && value != "" && !IsReference(value) {
+		return Marker
+	}
+	return p.Text(value)
+}
+
+var (
+	references = regexp.MustCompile(`\{\{[^{}]*\}\}`)
+	authScheme = regexp.MustCompile(`^[A-Za-z-]*$`)
+)
+
+// IsReference reports whether value only refers to variables, e.g.
+// "{{token}}" or "Bearer {{token}}", and so holds no secret itself. Stored
+// requests are kept readable this way, sent ones have no references left.
+func IsReference(value string) bool {
+	if !references.MatchString(value) {
+		return false
+	}
+	rest := strings.TrimSpace(references.ReplaceAllString(value, ""))
+	return authScheme.MatchString(rest)
+}
+
+// Headers returns a copy of headers with sensitive values removed.
+func (p *Policy) Headers(headers map[string]string) map[string]string {
+	if p == nil || headers == nil {
+		return headers
+	}
+	redacted := map[string]string{}
+	for name, value := range headers {
+		redacted[name] = p.Header(name, value)
+	}
+	return redacted
+}
+
+// Url removes the values of sensitive query parameters and the matches of
+// the patterns.
+func (p *Policy) Url(url string) string {
+	if p == nil {
+		return url
+	}
+	if p.queryKeys != nil {
+		url = replaceValues(p.queryKeys, url, Marker)
+	}
+	return p.Text(url)
+}
+
+// Body removes the values of sensitive fields from a JSON or form encoded
+// body, and the matches of the patterns. Only scalar JSON values are
+// removed, formatting is kept.
+func (p *Policy) Body(body string) string {
+	if p == nil || body == "" {
+		return body
+	}
+	if p.jsonKeys != nil {
+		body = replaceValues(p.jsonKeys, body, `"`+Marker+`"`)
+		trimmed := strings.TrimSpace(body)
+		if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+			body = replaceValues(p.queryKeys, body, Marker)
+		}
+	}
+	return p.Text(body)
+}
+
+// Message removes sensitive values from an HTTP message as written on the
+// wire: the URL of the request line, the header fields and the body.
+func (p *Policy) Message(message string) string {
+	if p == nil || message == "" {
+		return message
+	}
+	head, body, hasBody := strings.Cut(message, "\r\n\r\n")
+	lines := strings.Split(head, "\r\n")
+	for i, line := range lines {
+		name, value, isField := strings.Cut(line, ": ")
+		switch {
+		case i == 0:
+			lines[i] = p.Url(line)
+		case !isField:
+			lines[i] = p.Text(line)
+		case strings.HasPrefix(name, ":"):
+			// HTTP/2 pseudo header such as :path
+			lines[i] = name + ": " + p.Url(value)
+		default:
+			lines[i] = name + ": " + p.Header(name, value)
+		}
+	}
+	redacted := strings.Join(lines, "\r\n")
+	if hasBody {
+		redacted += "\r\n\r\n" + p.Body(body)
+	}
+	return redacted
+}
+
+// replaceValues replaces the value, the second group of re, of every match
+// that is not a reference.
+func replaceValues(re *regexp.Regexp, text string, replacement string) string {
+	return re.ReplaceAllStringFunc(text, func(match string) string {
+		groups := re.FindStringSubmatch(match)
+		if IsReference(strings.Trim(groups[2], `"`)) {
+			return match
+		}
+		return groups[1] + replacement
+	})
+}
+
+// Text replaces the matches of the patterns.
+func (p *Policy) Text(text string) string {
+	if p == nil {
+		return text
+	}
+	for _, pattern := range p.patterns {
+		text = pattern.ReplaceAllString(text, Marker)
+	}
+	return text
+}
+
+// The policy in effect and where it applies, see Set.
+var (
+	mu      sync.RWMutex
+	current *Policy
+	scopes  Scopes
+)
+
+// Scopes tells where the policy in effect applies.
+type Scopes struct {
+	History bool
+	Logs    bool
+	Exports bool
+}
+
+// Set makes policy the one in effect for scopes.
+func Set(policy *Policy, s Scopes) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = policy
+	scopes = s
+}
+
+func get(enabled func(Scopes) bool) *Policy {
+	mu.RLock()
+	defer mu.RUnlock()
+	if !enabled(scopes) {
+		return nil
+	}
+	return current
+}
+
+// History returns the policy applied to history entries when they are
+// stored, nil when they are stored as is.
+func History() *Policy {
+	return get(func(s Scopes) bool { return s.History })
+}
+
+// Logs returns the policy applied to log records.
+func Logs() *Policy {
+	return get(func(s Scopes) bool { return s.Logs })
+}
+
+// Exports returns the policy applied to exported collections, HAR files
+// and run reports.
+func Exports() *Policy {
+	return get(func(s Scopes) bool { return s.Exports })
+}
@@ -0,0 +1,129 @@
+package redact
+
+import "testing"
+
+func testPolicy(t *testing.T) *Policy {
+	t.Helper()
+	policy, err := NewPolicy(
+		[]string{"Authorization", "x-api-key"},
+		[]string{"password", "token"},
+		[]string{`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`},
+	)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	return policy
+}
+
+func TestPolicyHeader(t *testing.T) {
+	policy := testPolicy(t)
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"Authorization", "Bearer abc", Marker},
+		{"authorization", "Basic dXNlcjpwYXNz", Marker},
+		{"X-Api-Key", "k-123", Marker},
+		{"Authorization", "Bearer {{token}}", "Bearer {{token}}"},
+		{"X-Api-Key", "{{key}}", "{{key}}"},
+		{"Authorization", "", ""},
+		{"Accept", "application/json", "application/json"},
+		{"X-Forwarded-Token", "eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.c2ln", Marker},
+	}
+	for _, tt := range tests {
+		if got := policy.Header(tt.name, tt.value); got != tt.want {
+			t.Errorf("Header(%q, %q) = %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyUrl(t *testing.T) {
+	policy := testPolicy(t)
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://api.test/users?id=1", "https://api.test/users?id=1"},
+		{"https://api.test/login?token=abc&id=1", "https://api.test/login?token=[REDACTED]&id=1"},
+		{"https://api.test/login?id=1&Password=p%40ss#top", "https://api.test/login?id=1&Password=[REDACTED]#top"},
+		{"https://api.test/login?token={{token}}", "https://api.test/login?token={{token}}"},
+		{"https://api.test/login?mytoken=abc", "https://api.test/login?mytoken=abc"},
+		{`Get "https://api.test/?token=abc": EOF`, `Get "https://api.test/?token=[REDACTED]": EOF`},
+	}
+	for _, tt := range tests {
+		if got := policy.Url(tt.url); got != tt.want {
+			t.Errorf("Url(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyBody(t *testing.T) {
+	policy := testPolicy(t)
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"empty", "", ""},
+		{"whitespace", "  \n", "  \n"},
+		{"json string", `{"user":"a","password":"p"}`, `{"user":"a","password":"[REDACTED]"}`},
+		{"json number and spacing", `{"Token" : 123, "id": 1}`, `{"Token" : "[REDACTED]", "id": 1}`},
+		{"json escaped quote", `{"password":"p\"q","id":1}`, `{"password":"[REDACTED]","id":1}`},
+		{"json nested", "{\n  \"auth\": {\"token\": \"abc\"}\n}", "{\n  \"auth\": {\"token\": \"[REDACTED]\"}\n}"},
+		{"json object value kept", `{"token":{"id":1}}`, `{"token":{"id":1}}`},
+		{"json reference", `{"password":"{{password}}"}`, `{"password":"{{password}}"}`},
+		{"form", "user=a&password=p&x=1", "user=a&password=[REDACTED]&x=1"},
+		{"pattern", "jwt eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.c2ln here", "jwt [REDACTED] here"},
+	}
+	for _, tt := range tests {
+		if got := policy.Body(tt.body); got != tt.want {
+			t.Errorf("%s: Body(%q) = %q, want %q", tt.name, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyMessage(t *testing.T) {
+	policy := testPolicy(t)
+	message := "POST /login?token=abc HTTP/1.1\r\nHost: api.test\r\nAuthorization: Bearer abc\r\n:path: /login?token=abc\r\n\r\n{\"password\":\"p\"}"
+	want := "POST /login?token=[REDACTED] HTTP/1.1\r\nHost: api.test\r\nAuthorization: [REDACTED]\r\n:path: /login?token=[REDACTED]\r\n\r\n{\"password\":\"[REDACTED]\"}"
+	if got := policy.Message(message); got != want {
+		t.Errorf("Message() = %q, want %q", got, want)
+	}
+}
+
+func TestNilPolicy(t *testing.T) {
+	var policy *Policy
+	headers := map[string]string{"Authorization": "Bearer abc"}
+	if got := policy.Headers(headers); got["Authorization"] != "Bearer abc" {
+		t.Errorf("Headers() = %v, want the headers unchanged", got)
+	}
+	if got := policy.Url("https://api.test/?token=abc"); got != "https://api.test/?token=abc" {
+		t.Errorf("Url() = %q, want it unchanged", got)
+	}
+	if got := policy.Body(`{"password":"p"}`); got != `{"password":"p"}` {
+		t.Errorf("Body() = %q, want it unchanged", got)
+	}
+	if policy.IsHeader("Authorization") || policy.IsKey("password") {
+		t.Error("nil policy reports sensitive names")
+	}
+}
+
+func TestNewPolicyInvalidPattern(t *testing.T) {
+	if _, err := NewPolicy(nil, nil, []string{"("}); err == nil {
+		t.Error("NewPolicy with an invalid pattern did not fail")
+	}
+}
+
+func TestScopes(t *testing.T) {
+	policy := testPolicy(t)
+	Set(policy, Scopes{History: true, Exports: true})
+	t.Cleanup(func() { Set(nil, Scopes{}) })
+
+	if History() != policy || Exports() != policy {
+		t.Error("History() and Exports() do not return the policy set")
+	}
+	if Logs() != nil {
+		t.Error("Logs() returns a policy while its scope is off")
+	}
+}
@@ -16,9 +16,8 @@ func NewCollectionRepo(DB *sql.DB) *CollectionRepo {
 
 func (c *CollectionRepo) SelectAllCollections() ([]models.Collection, error) {
 	rows, err := c.DB.Query(`
-		SELECT 
-		* 
-		FROM collection ORDER BY name ASC`,
+		SELECT pk_collection_id,name,description,created_at,updated_at
+		FROM collection WHERE deleted_at IS NULL ORDER BY name ASC`,
 	)
 	if err != nil {
 		return nil, err
@@ -27,7 +26,7 @@ func (c *CollectionRepo) SelectAllCollections() ([]models.Collection, error) {
 	collections := []models.Collection{}
 	for rows.Next() {
 		var collection models.Collection
-		if err := rows.Scan(&collection.PkCollectionId, &collection.Name, &collection.CreatedAt, &collection.UpdatedAt); err != nil {
+		if err := rows.Scan(&collection.PkCollectionId, &collection.Name, &collection.Description, &collection.CreatedAt, &collection.UpdatedAt); err != nil {
 			return nil, err
 		}
 		collections = append(collections, collection)
@@ -35,6 +34,24 @@ func (c *CollectionRepo) SelectAllCollections() ([]models.Collection, error) {
 	return collections, nil
 }
 
+func (c *CollectionRepo) SelectCollectionById(id int) (models.Collection, error) {
+	var collection models.Collection
+	err := c.DB.QueryRow(`
+		SELECT pk_collection_id,name,description,created_at,updated_at
+		FROM collection WHERE pk_collection_id = $1 AND deleted_at IS NULL`, id,
+	).Scan(&collection.PkCollectionId, &collection.Name, &collection.Description, &collection.CreatedAt, &collection.UpdatedAt)
+	return collection, err
+}
+
+func (c *CollectionRepo) SelectCollectionByName(name string) (models.Collection, error) {
+	var collection models.Collection
+	err := c.DB.QueryRow(`
+		SELECT pk_collection_id,name,description,created_at,updated_at
+		FROM collection WHERE name = $1 AND deleted_at IS NULL ORDER BY pk_collection_id ASC LIMIT 1`, name,
+	).Scan(&collection.PkCollectionId, &collection.Name, &collection.Description, &collection.CreatedAt, &collection.UpdatedAt)
+	return collection, err
+}
+
 type FileJoinType struct {
 	FileId       *int           `json:"file_id"`
 	Name         string         `json:"name"`
@@ -88,7 +105,8 @@ func (c *CollectionRepo) SelectAllCollectionsWithFilesNested() ([]CollectionJoin
         	)  
             END
         from collection as c
-        left join file as f on c.pk_collection_id=f.collection_id
+        left join file as f on c.pk_collection_id=f.collection_id and f.deleted_at is null
+        where c.deleted_at is null
         group by c.pk_collection_id, c.name
         order by c.name asc, f.is_folder desc, f.name asc;
 	`,
@@ -144,7 +162,8 @@ func (c *CollectionRepo) SelectAllCollectionJoinFiles() ([]CollectionJoinFileTyp
         file.is_folder,
         file.parent_id
      FROM collection
-    left join file on collection.pk_collection_id = file.collection_id
+    left join file on collection.pk_collection_id = file.collection_id and file.deleted_at is null
+    where collection.deleted_at is null
 	order by collection.name
 	`)
 	if err != nil {
@@ -173,16 +192,16 @@ func (c *CollectionRepo) InsertCollection(name string) (int, error) {
 	return id, nil
 }
 
-func (c *CollectionRepo) DeleteCollection(id int) error {
-	_, err := c.DB.Exec("DELETE FROM collection WHERE pk_collection_id = ?", id)
+func (c *CollectionRepo) UpdateCollection(id int, name string) error {
+	_, err := c.DB.Exec("UPDATE collection SET name = ? WHERE pk_collection_id = ?", name, id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (c *CollectionRepo) UpdateCollection(id int, name string) error {
-	_, err := c.DB.Exec("UPDATE collection SET name = ? WHERE pk_collection_id = ?", name, id)
+func (c *CollectionRepo) UpdateCollectionDescription(id int, description string) error {
+	_, err := c.DB.Exec("UPDATE collection SET description = ?, updated_at = CURRENT_TIMESTAMP WHERE pk_collection_id = ?", description, id)
 	if err != nil {
 		return err
 	}
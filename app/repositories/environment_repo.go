@@ -0,0 +1,138 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"posto/app/models"
+)
+
+type EnvironmentRepo struct {
+	DB *sql.DB
+}
+
+func NewEnvironmentRepo(DB *sql.DB) *EnvironmentRepo {
+	return &EnvironmentRepo{DB: DB}
+}
+
+func scanEnvironment(row rowScanner) (models.Environment, error) {
+	var environment models.Environment
+	var variables string
+	err := row.Scan(
+		&environment.PkEnvironmentId, &environment.Name, &variables,
+		&environment.IsActive, &environment.CreatedAt, &environment.UpdatedAt,
+	)
+	if err != nil {
+		return environment, err
+	}
+
+	environment.Variables = []models.Variable{}
+	if variables != "" {
+		if err := json.Unmarshal([]byte(variables), &environment.Variables); err != nil {
+			return environment, err
+		}
+	}
+	return environment, nil
+}
+
+func (e *EnvironmentRepo) SelectAllEnvironments() ([]models.Environment, error) {
+	rows, err := e.DB.Query(`
+		SELECT pk_environment_id,name,variables,is_active,created_at,updated_at
+		FROM environment ORDER BY name ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	environments := []models.Environment{}
+	for rows.Next() {
+		environment, err := scanEnvironment(rows)
+		if err != nil {
+			return nil, err
+		}
+		environments = append(environments, environment)
+	}
+	return environments, rows.Err()
+}
+
+func (e *EnvironmentRepo) SelectEnvironmentById(id int) (models.Environment, error) {
+	row := e.DB.QueryRow(`
+		SELECT pk_environment_id,name,variables,is_active,created_at,updated_at
+		FROM environment WHERE pk_environment_id = $1
+	`, id)
+	return scanEnvironment(row)
+}
+
+func (e *EnvironmentRepo) SelectEnvironmentByName(name string) (models.Environment, error) {
+	row := e.DB.QueryRow(`
+		SELECT pk_environment_id,name,variables,is_active,created_at,updated_at
+		FROM environment WHERE name = $1
+	`, name)
+	return scanEnvironment(row)
+}
+
+// SelectActiveEnvironment returns the environment used by the GUI when
+// sending requests, or nil when none is active.
+func (e *EnvironmentRepo) SelectActiveEnvironment() (*models.Environment, error) {
+	row := e.DB.QueryRow(`
+		SELECT pk_environment_id,name,variables,is_active,created_at,updated_at
+		FROM environment WHERE is_active = TRUE LIMIT 1
+	`)
+	environment, err := scanEnvironment(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &environment, nil
+}
+
+func (e *EnvironmentRepo) InsertEnvironment(name string, variables []models.Variable) (int, error) {
+	if variables == nil {
+		variables = []models.Variable{}
+	}
+	variablesJson, err := json.Marshal(variables)
+	if err != nil {
+		return -1, err
+	}
+
+	var id int
+	err = e.DB.QueryRow(`
+		INSERT INTO environment(name,variables) VALUES($1,$2) RETURNING pk_environment_id
+	`, name, string(variablesJson)).Scan(&id)
+	if err != nil {
+		return -1, err
+	}
+	return id, nil
+}
+
+func (e *EnvironmentRepo) UpdateEnvironment(id int, name string, variables []models.Variable) error {
+	if variables == nil {
+		variables = []models.Variable{}
+	}
+	variablesJson, err := json.Marshal(variables)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.DB.Exec(`
+		UPDATE environment SET name = $1, variables = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE pk_environment_id = $3
+	`, name, string(variablesJson), id)
+	return err
+}
+
+func (e *EnvironmentRepo) DeleteEnvironment(id int) error {
+	_, err := e.DB.Exec("DELETE FROM environment WHERE pk_environment_id = ?", id)
+	return err
+}
+
+// SetActiveEnvironment marks the given environment as active and clears the
+// flag on every other one. A nil id deactivates all environments.
+func (e *EnvironmentRepo) SetActiveEnvironment(id *int) error {
+	_, err := e.DB.Exec(`
+		UPDATE environment SET is_active = (pk_environment_id IS $1)
+	`, id)
+	return err
+}
@@ -0,0 +1,135 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"posto/app/models"
+)
+
+type ExampleRepo struct {
+	DB *sql.DB
+}
+
+func NewExampleRepo(DB *sql.DB) *ExampleRepo {
+	return &ExampleRepo{DB: DB}
+}
+
+func scanExample(row rowScanner) (models.Example, error) {
+	var example models.Example
+	var headers string
+	err := row.Scan(
+		&example.PkExampleId, &example.FileId, &example.Name, &example.StatusCode,
+		&example.ContentType, &headers, &example.Body, &example.IsBinary,
+		&example.CreatedAt, &example.UpdatedAt,
+	)
+	if err != nil {
+		return example, err
+	}
+
+	example.Headers = map[string]string{}
+	if headers != "" {
+		if err := json.Unmarshal([]byte(headers), &example.Headers); err != nil {
+			return example, err
+		}
+	}
+	return example, nil
+}
+
+func (e *ExampleRepo) SelectExamplesByFile(fileId int) ([]models.Example, error) {
+	return e.selectExamples(`
+		SELECT pk_example_id,file_id,name,status_code,content_type,headers,body,is_binary,created_at,updated_at
+		FROM example WHERE file_id = $1 ORDER BY pk_example_id ASC
+	`, fileId)
+}
+
+// SelectExamplesByCollection returns the examples of every request of a
+// collection grouped by file id.
+func (e *ExampleRepo) SelectExamplesByCollection(collectionId int) (map[int64][]models.Example, error) {
+	examples, err := e.selectExamples(`
+		SELECT e.pk_example_id,e.file_id,e.name,e.status_code,e.content_type,e.headers,e.body,e.is_binary,e.created_at,e.updated_at
+		FROM example AS e
+		JOIN file AS f ON f.pk_file_id = e.file_id
+		WHERE f.collection_id = $1 AND f.deleted_at IS NULL ORDER BY e.pk_example_id ASC
+	`, collectionId)
+	if err != nil {
+		return nil, err
+	}
+
+	byFile := map[int64][]models.Example{}
+	for _, example := range examples {
+		byFile[example.FileId] = append(byFile[example.FileId], example)
+	}
+	return byFile, nil
+}
+
+func (e *ExampleRepo) selectExamples(query string, args ...any) ([]models.Example, error) {
+	rows, err := e.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	examples := []models.Example{}
+	for rows.Next() {
+		example, err := scanExample(rows)
+		if err != nil {
+			return nil, err
+		}
+		examples = append(examples, example)
+	}
+	return examples, rows.Err()
+}
+
+func (e *ExampleRepo) SelectExampleById(id int) (models.Example, error) {
+	row := e.DB.QueryRow(`
+		SELECT pk_example_id,file_id,name,status_code,content_type,headers,body,is_binary,created_at,updated_at
+		FROM example WHERE pk_example_id = $1
+	`, id)
+	return scanExample(row)
+}
+
+func (e *ExampleRepo) InsertExample(example models.Example) (int, error) {
+	headers, err := marshalHeaders(example.Headers)
+	if err != nil {
+		return -1, err
+	}
+
+	var id int
+	err = e.DB.QueryRow(`
+		INSERT INTO example(file_id,name,status_code,content_type,headers,body,is_binary)
+		VALUES($1,$2,$3,$4,$5,$6,$7)
+		RETURNING pk_example_id
+	`, example.FileId, example.Name, example.StatusCode, example.ContentType, headers, example.Body, example.IsBinary).Scan(&id)
+	if err != nil {
+		return -1, err
+	}
+	return id, nil
+}
+
+func (e *ExampleRepo) UpdateExample(id int, example models.Example) error {
+	headers, err := marshalHeaders(example.Headers)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.DB.Exec(`
+		UPDATE example
+		SET name = $1, status_code = $2, content_type = $3, headers = $4, body = $5, is_binary = $6,
+		updated_at = CURRENT_TIMESTAMP
+		WHERE pk_example_id = $7
+	`, example.Name, example.StatusCode, example.ContentType, headers, example.Body, example.IsBinary, id)
+	return err
+}
+
+func (e *ExampleRepo) DeleteExample(id int) error {
+	_, err := e.DB.Exec("DELETE FROM example WHERE pk_example_id = ?", id)
+	return err
+}
+
+func marshalHeaders(headers map[string]string) (string, error) {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	encoded, err := json.Marshal(headers)
+	return string(encoded), err
+}
@@ -3,6 +3,7 @@ package repositories
 import (
 	"database/sql"
 	"fmt"
+	"posto/app/models"
 	"strings"
 )
 
@@ -43,17 +44,36 @@ type FileRequestData struct {
 	Url     *string `json:"url,omitempty"`
 	Headers *string `json:"headers,omitempty"`
 	Body    *string `json:"body,omitempty"`
+	// Assertions is a JSON array of models.Assertion
+	Assertions *string `json:"assertions,omitempty"`
+	// Mock is a JSON models.MockResponse served by the mock server
+	Mock *string `json:"mock,omitempty"`
+	// Description is Markdown and can also be set on folders
+	Description *string `json:"description,omitempty"`
 }
 
+// IsEmpty reports whether no field would be written by UpdateFile.
+func (r FileRequestData) IsEmpty() bool {
+	return r.Name == nil && r.Method == nil && r.Url == nil && r.Headers == nil &&
+		r.Body == nil && r.Assertions == nil && r.Mock == nil && r.Description == nil
+}
+
+// fileNotTrashed is true for files that are neither in the trash nor in a
+// collection that is: trashing a collection leaves deleted_at of its files
+// as it is, so that restoring it brings them back as they were.
+const fileNotTrashed = `deleted_at IS NULL
+	AND collection_id IN (SELECT pk_collection_id FROM collection WHERE deleted_at IS NULL)`
+
 func (f *FileRepo) GetRequestData(fileId int) (FileRequestData, error) {
 	rows := f.DB.QueryRow(`
-		SELECT is_folder,method,url,headers,body FROM file WHERE pk_file_id = $1
-	`, fileId)
+		SELECT is_folder,method,url,headers,body,assertions,mock,description FROM file
+		WHERE pk_file_id = $1 AND `+fileNotTrashed, fileId)
 
 	fileRequestData := FileRequestData{}
 	var is_folder bool
-	var method, url, headers, body *string
-	err := rows.Scan(&is_folder, &method, &url, &headers, &body)
+	var method, url, headers, body, assertions, mock *string
+	var description string
+	err := rows.Scan(&is_folder, &method, &url, &headers, &body, &assertions, &mock, &description)
 	if err != nil {
 		return fileRequestData, err
 	}
@@ -61,6 +81,9 @@ func (f *FileRepo) GetRequestData(fileId int) (FileRequestData, error) {
 	fileRequestData.Url = url
 	fileRequestData.Headers = headers
 	fileRequestData.Body = body
+	fileRequestData.Assertions = assertions
+	fileRequestData.Mock = mock
+	fileRequestData.Description = &description
 
 	if is_folder {
 		return fileRequestData, fmt.Errorf("Cannot fetch api data for folders")
@@ -108,8 +131,29 @@ func (f *FileRepo) UpdateFile(fileId int, requestData FileRequestData) error {
 		params = append(params, *requestData.Body)
 	}
 
+	if requestData.Assertions != nil {
+		queryIdx++
+		query := fmt.Sprintf("assertions = $%v", queryIdx)
+		queryString = append(queryString, query)
+		params = append(params, *requestData.Assertions)
+	}
+
+	if requestData.Mock != nil {
+		queryIdx++
+		query := fmt.Sprintf("mock = $%v", queryIdx)
+		queryString = append(queryString, query)
+		params = append(params, *requestData.Mock)
+	}
+
+	if requestData.Description != nil {
+		queryIdx++
+		query := fmt.Sprintf("description = $%v", queryIdx)
+		queryString = append(queryString, query)
+		params = append(params, *requestData.Description)
+	}
+
 	if queryIdx == 0 {
-		return fmt.Errorf("No params provided, url/method/body/headers is missing")
+		return fmt.Errorf("No params provided, url/method/body/headers/assertions/mock/description is missing")
 	}
 
 	setQuery := strings.Join(queryString, ",")
@@ -123,3 +167,100 @@ func (f *FileRepo) UpdateFile(fileId int, requestData FileRequestData) error {
 
 	return nil
 }
+
+// NewRequest is a request created by InsertRequests, with the examples
+// saved along.
+type NewRequest struct {
+	Name        string
+	Method      string
+	Url         string
+	Headers     string
+	Body        *string
+	Description string
+	Examples    []models.Example
+}
+
+// InsertRequests creates requests below parentId, nil being the collection
+// root, in one transaction: either all of them are stored or none. It
+// returns the ids of the new files.
+func (f *FileRepo) InsertRequests(collectionId int, parentId *int, requests []NewRequest) ([]int, error) {
+	tx, err := f.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	fileIds := []int{}
+	for _, request := range requests {
+		var fileId int
+		err := tx.QueryRow(`
+			INSERT INTO file(collection_id,parent_id,is_folder,name,method,url,headers,body,description)
+			VALUES($1,$2,FALSE,$3,$4,$5,$6,$7,$8)
+			RETURNING pk_file_id
+		`, collectionId, parentId, request.Name, request.Method, request.Url, request.Headers, request.Body, request.Description).Scan(&fileId)
+		if err != nil {
+			return nil, fmt.Errorf("error creating request %q: %v", request.Name, err)
+		}
+		for _, example := range request.Examples {
+			headers, err := marshalHeaders(example.Headers)
+			if err != nil {
+				return nil, err
+			}
+			_, err = tx.Exec(`
+				INSERT INTO example(file_id,name,status_code,content_type,headers,body,is_binary)
+				VALUES($1,$2,$3,$4,$5,$6,$7)
+			`, fileId, example.Name, example.StatusCode, example.ContentType, headers, example.Body, example.IsBinary)
+			if err != nil {
+				return nil, fmt.Errorf("error saving example of %q: %v", request.Name, err)
+			}
+		}
+		fileIds = append(fileIds, fileId)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return fileIds, nil
+}
+
+// SelectFilesByCollection returns every file and folder of a collection with
+// its request data, folders first and then ordered by name. Trashed files
+// are left out, and so are all of them while the collection is trashed.
+func (f *FileRepo) SelectFilesByCollection(collectionId int) ([]models.File, error) {
+	rows, err := f.DB.Query(`
+		SELECT
+		pk_file_id,name,collection_id,is_folder,parent_id,created_at,updated_at,
+		method,url,headers,body,assertions,mock,description
+		FROM file WHERE collection_id = $1 AND `+fileNotTrashed+`
+		ORDER BY is_folder DESC, name ASC
+	`, collectionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []models.File{}
+	for rows.Next() {
+		var file models.File
+		err := rows.Scan(
+			&file.PkFileId, &file.Name, &file.CollectionId, &file.IsFolder, &file.ParentId,
+			&file.CreatedAt, &file.UpdatedAt,
+			&file.Method, &file.Url, &file.Headers, &file.Body, &file.Assertions, &file.Mock,
+			&file.Description,
+		)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// MoveFile renames a file or folder and moves it below parentId, nil being
+// the collection root.
+func (f *FileRepo) MoveFile(fileId int, parentId *int, name string) error {
+	_, err := f.DB.Exec(`
+		UPDATE file SET parent_id = $1, name = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE pk_file_id = $3
+	`, parentId, name, fileId)
+	return err
+}
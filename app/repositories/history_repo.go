@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"posto/app/models"
+	"time"
+)
+
+type HistoryRepo struct {
+	DB *sql.DB
+}
+
+func NewHistoryRepo(DB *sql.DB) *HistoryRepo {
+	return &HistoryRepo{DB: DB}
+}
+
+func scanHistoryEntry(row rowScanner) (models.HistoryEntry, error) {
+	var entry models.HistoryEntry
+	var requestHeaders, responseHeaders string
+	err := row.Scan(
+		&entry.PkHistoryId, &entry.FileId, &entry.Method, &entry.Url,
+		&requestHeaders, &entry.RequestBody, &entry.StatusCode, &entry.ContentType,
+		&responseHeaders, &entry.ResponseBody, &entry.IsBinary, &entry.Truncated, &entry.DurationMs,
+		&entry.Error, &entry.CreatedAt,
+	)
+	if err != nil {
+		return entry, err
+	}
+
+	entry.RequestHeaders = map[string]string{}
+	entry.ResponseHeaders = map[string]string{}
+	if requestHeaders != "" {
+		if err := json.Unmarshal([]byte(requestHeaders), &entry.RequestHeaders); err != nil {
+			return entry, err
+		}
+	}
+	if responseHeaders != "" {
+		if err := json.Unmarshal([]byte(responseHeaders), &entry.ResponseHeaders); err != nil {
+			return entry, err
+		}
+	}
+	return entry, nil
+}
+
+// SelectHistory returns the newest entries first. A limit <= 0 returns all.
+func (h *HistoryRepo) SelectHistory(limit int) ([]models.HistoryEntry, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := h.DB.Query(`
+		SELECT pk_history_id,file_id,method,url,request_headers,request_body,status_code,content_type,
+		response_headers,response_body,is_binary,truncated,duration_ms,error,created_at
+		FROM history ORDER BY pk_history_id DESC LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.HistoryEntry{}
+	for rows.Next() {
+		entry, err := scanHistoryEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (h *HistoryRepo) InsertHistory(entry models.HistoryEntry) (int, error) {
+	requestHeaders, err := marshalHeaders(entry.RequestHeaders)
+	if err != nil {
+		return -1, err
+	}
+	responseHeaders, err := marshalHeaders(entry.ResponseHeaders)
+	if err != nil {
+		return -1, err
+	}
+
+	var id int
+	err = h.DB.QueryRow(`
+		INSERT INTO history(file_id,method,url,request_headers,request_body,status_code,content_type,
+		response_headers,response_body,is_binary,truncated,duration_ms,error)
+		VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)
+		RETURNING pk_history_id
+	`, entry.FileId, entry.Method, entry.Url, requestHeaders, entry.RequestBody, entry.StatusCode, entry.ContentType,
+		responseHeaders, entry.ResponseBody, entry.IsBinary, entry.Truncated, entry.DurationMs, entry.Error,
+	).Scan(&id)
+	if err != nil {
+		return -1, err
+	}
+	return id, nil
+}
+
+func (h *HistoryRepo) DeleteAllHistory() error {
+	_, err := h.DB.Exec("DELETE FROM history")
+	return err
+}
+
+// PruneHistory deletes the entries older than olderThan.
+func (h *HistoryRepo) PruneHistory(olderThan time.Duration) error {
+	_, err := h.DB.Exec("DELETE FROM history WHERE created_at < datetime('now',$1)", sqliteModifier(olderThan))
+	return err
+}
@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"database/sql"
+	"posto/app/models"
+)
+
+type MirrorRepo struct {
+	DB *sql.DB
+}
+
+func NewMirrorRepo(DB *sql.DB) *MirrorRepo {
+	return &MirrorRepo{DB: DB}
+}
+
+func scanMirror(row rowScanner) (models.Mirror, error) {
+	var mirror models.Mirror
+	err := row.Scan(&mirror.PkMirrorId, &mirror.CollectionId, &mirror.Path, &mirror.CreatedAt, &mirror.UpdatedAt)
+	return mirror, err
+}
+
+// SelectAllMirrors leaves out the mirrors of trashed collections.
+func (m *MirrorRepo) SelectAllMirrors() ([]models.Mirror, error) {
+	rows, err := m.DB.Query(`
+		SELECT m.pk_mirror_id,m.collection_id,m.path,m.created_at,m.updated_at
+		FROM mirror m
+		JOIN collection c ON c.pk_collection_id = m.collection_id
+		WHERE c.deleted_at IS NULL ORDER BY m.pk_mirror_id ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mirrors := []models.Mirror{}
+	for rows.Next() {
+		mirror, err := scanMirror(rows)
+		if err != nil {
+			return nil, err
+		}
+		mirrors = append(mirrors, mirror)
+	}
+	return mirrors, rows.Err()
+}
+
+func (m *MirrorRepo) SelectMirrorByCollection(collectionId int) (models.Mirror, error) {
+	return scanMirror(m.DB.QueryRow(`
+		SELECT pk_mirror_id,collection_id,path,created_at,updated_at
+		FROM mirror WHERE collection_id = $1
+	`, collectionId))
+}
+
+func (m *MirrorRepo) InsertMirror(collectionId int, path string) (int64, error) {
+	var id int64
+	err := m.DB.QueryRow(`
+		INSERT INTO mirror(collection_id,path) VALUES($1,$2)
+		RETURNING pk_mirror_id
+	`, collectionId, path).Scan(&id)
+	return id, err
+}
+
+func (m *MirrorRepo) DeleteMirror(mirrorId int64) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM mirror_entry WHERE mirror_id = $1`, mirrorId); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM mirror WHERE pk_mirror_id = $1`, mirrorId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *MirrorRepo) SelectMirrorEntries(mirrorId int64) ([]models.MirrorEntry, error) {
+	rows, err := m.DB.Query(`
+		SELECT file_id,path,hash,synced_at
+		FROM mirror_entry WHERE mirror_id = $1 ORDER BY path ASC
+	`, mirrorId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.MirrorEntry{}
+	for rows.Next() {
+		var entry models.MirrorEntry
+		if err := rows.Scan(&entry.FileId, &entry.Path, &entry.Hash, &entry.SyncedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// ReplaceMirrorEntries stores the state of a finished sync.
+func (m *MirrorRepo) ReplaceMirrorEntries(mirrorId int64, entries []models.MirrorEntry) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM mirror_entry WHERE mirror_id = $1`, mirrorId); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		_, err := tx.Exec(`
+			INSERT INTO mirror_entry(mirror_id,file_id,path,hash) VALUES($1,$2,$3,$4)
+		`, mirrorId, entry.FileId, entry.Path, entry.Hash)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE mirror SET updated_at = CURRENT_TIMESTAMP WHERE pk_mirror_id = $1`, mirrorId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -1,15 +1,61 @@
 package repositories
 
-import "database/sql"
+import (
+	"database/sql"
+	"sync/atomic"
+)
 
 type Repositories struct {
-	Collection *CollectionRepo
-	File       *FileRepo
+	Collection  *CollectionRepo
+	File        *FileRepo
+	Environment *EnvironmentRepo
+	Example     *ExampleRepo
+	History     *HistoryRepo
+	Mirror      *MirrorRepo
+	Search      *SearchRepo
+	Revision    *RevisionRepo
+	Trash       *TrashRepo
+	Vault       *VaultRepo
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
 func NewRepositories(DB *sql.DB) *Repositories {
 	return &Repositories{
-		Collection: NewCollectionRepo(DB),
-		File:       NewFileRepo(DB),
+		Collection:  NewCollectionRepo(DB),
+		File:        NewFileRepo(DB),
+		Environment: NewEnvironmentRepo(DB),
+		Example:     NewExampleRepo(DB),
+		History:     NewHistoryRepo(DB),
+		Mirror:      NewMirrorRepo(DB),
+		Search:      NewSearchRepo(DB),
+		Revision:    NewRevisionRepo(DB),
+		Trash:       NewTrashRepo(DB),
+		Vault:       NewVaultRepo(DB),
 	}
 }
+
+// Active holds the repositories of the open workspace. Opening another
+// workspace swaps them as a whole: callers Load them once per operation and
+// keep using that set, so that an operation never mixes two databases.
+type Active struct {
+	current atomic.Pointer[Repositories]
+}
+
+func NewActive(repos *Repositories) *Active {
+	active := &Active{}
+	active.current.Store(repos)
+	return active
+}
+
+func (a *Active) Load() *Repositories {
+	return a.current.Load()
+}
+
+// Swap makes repos the active repositories and returns the previous ones.
+func (a *Active) Swap(repos *Repositories) *Repositories {
+	return a.current.Swap(repos)
+}
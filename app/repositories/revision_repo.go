@@ -0,0 +1,146 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"posto/app/models"
+	"time"
+)
+
+type RevisionRepo struct {
+	DB *sql.DB
+}
+
+func NewRevisionRepo(DB *sql.DB) *RevisionRepo {
+	return &RevisionRepo{DB: DB}
+}
+
+// revisionSnapshot selects the revisioned fields of a request from file.
+const revisionSnapshot = `
+	SELECT COALESCE(name,''),COALESCE(method,''),COALESCE(url,''),COALESCE(headers,'{}'),COALESCE(body,'')
+	FROM file WHERE pk_file_id = $1 AND NOT is_folder
+`
+
+func scanRevision(row rowScanner) (models.Revision, error) {
+	var revision models.Revision
+	err := row.Scan(
+		&revision.PkRevisionId, &revision.FileId, &revision.Name, &revision.Method, &revision.Url,
+		&revision.Headers, &revision.Body, &revision.IsBaseline, &revision.CreatedAt, &revision.UpdatedAt,
+	)
+	return revision, err
+}
+
+// SelectRevisionsByFile returns the revisions of a request, newest first.
+func (r *RevisionRepo) SelectRevisionsByFile(fileId int) ([]models.Revision, error) {
+	rows, err := r.DB.Query(`
+		SELECT pk_revision_id,file_id,name,method,url,headers,body,is_baseline,created_at,updated_at
+		FROM revision WHERE file_id = $1 ORDER BY pk_revision_id DESC
+	`, fileId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []models.Revision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+func (r *RevisionRepo) SelectRevisionById(id int) (models.Revision, error) {
+	row := r.DB.QueryRow(`
+		SELECT pk_revision_id,file_id,name,method,url,headers,body,is_baseline,created_at,updated_at
+		FROM revision WHERE pk_revision_id = $1
+	`, id)
+	return scanRevision(row)
+}
+
+// InsertBaselineRevision stores the current state of a request that has no
+// revisions yet, dated with its last update, so that the state before the
+// first tracked save can be restored. RecordRevision never coalesces into
+// it, however recent it is.
+func (r *RevisionRepo) InsertBaselineRevision(fileId int) error {
+	_, err := r.DB.Exec(`
+		INSERT INTO revision(file_id,name,method,url,headers,body,is_baseline,created_at,updated_at)
+		SELECT $1,COALESCE(name,''),COALESCE(method,''),COALESCE(url,''),COALESCE(headers,'{}'),COALESCE(body,''),TRUE,
+		COALESCE(updated_at,created_at,CURRENT_TIMESTAMP),COALESCE(updated_at,created_at,CURRENT_TIMESTAMP)
+		FROM file
+		WHERE pk_file_id = $1 AND NOT is_folder
+		AND NOT EXISTS (SELECT 1 FROM revision WHERE file_id = $1)
+	`, fileId)
+	return err
+}
+
+// RecordRevision stores the current state of a request. When the latest
+// revision was saved less than window ago and started less than span ago
+// it is updated instead of adding a new one, unless it is the baseline. Nothing is stored when the
+// state equals the latest revision. A zero window always adds a revision.
+func (r *RevisionRepo) RecordRevision(fileId int, window time.Duration, span time.Duration) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var name, method, url, headers, body string
+	err = tx.QueryRow(revisionSnapshot, fileId).Scan(&name, &method, &url, &headers, &body)
+	if err == sql.ErrNoRows {
+		// folders have no revisions
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var latestId int
+	var unchanged, recent bool
+	err = tx.QueryRow(`
+		SELECT pk_revision_id,
+		name = $1 AND method = $2 AND url = $3 AND headers = $4 AND body = $5,
+		NOT is_baseline AND updated_at >= datetime('now',$6) AND created_at >= datetime('now',$7)
+		FROM revision WHERE file_id = $8 ORDER BY pk_revision_id DESC LIMIT 1
+	`, name, method, url, headers, body, sqliteModifier(window), sqliteModifier(span), fileId).Scan(&latestId, &unchanged, &recent)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	switch {
+	case err == nil && unchanged:
+		return nil
+	case err == nil && recent && window > 0:
+		_, err = tx.Exec(`
+			UPDATE revision
+			SET name = $1, method = $2, url = $3, headers = $4, body = $5, updated_at = CURRENT_TIMESTAMP
+			WHERE pk_revision_id = $6
+		`, name, method, url, headers, body, latestId)
+	default:
+		_, err = tx.Exec(`
+			INSERT INTO revision(file_id,name,method,url,headers,body)
+			VALUES($1,$2,$3,$4,$5,$6)
+		`, fileId, name, method, url, headers, body)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PruneRevisions deletes all but the keep newest revisions of a request.
+func (r *RevisionRepo) PruneRevisions(fileId int, keep int) error {
+	_, err := r.DB.Exec(`
+		DELETE FROM revision WHERE file_id = $1 AND pk_revision_id NOT IN (
+			SELECT pk_revision_id FROM revision WHERE file_id = $1 ORDER BY pk_revision_id DESC LIMIT $2
+		)
+	`, fileId, keep)
+	return err
+}
+
+// sqliteModifier formats d as a negative datetime() modifier.
+func sqliteModifier(d time.Duration) string {
+	return fmt.Sprintf("-%d seconds", int(d.Seconds()))
+}
@@ -0,0 +1,368 @@
+package repositories
+
+import (
+	"database/sql"
+	"html"
+	"posto/app/models"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The search index is an external content FTS5 table over the file table,
+// kept in sync by triggers. It is created at startup rather than in a
+// migration because FTS5 is only available when the binary is built with
+// the sqlite_fts5 tag; without it search falls back to LIKE queries.
+const (
+	searchSnippetTokens = 12
+	searchDefaultLimit  = 50
+	// searchMarkStart and searchMarkEnd delimit matches in snippets until
+	// the text has been escaped and they are replaced with <mark>.
+	searchMarkStart = "\x01"
+	searchMarkEnd   = "\x02"
+)
+
+var searchTriggers = map[string]string{
+	"file_search_ai": `
+		CREATE TRIGGER IF NOT EXISTS file_search_ai AFTER INSERT ON file BEGIN
+			INSERT INTO file_search(rowid,name,url,headers,body,description)
+			VALUES(new.pk_file_id,new.name,new.url,new.headers,new.body,new.description);
+		END`,
+	"file_search_ad": `
+		CREATE TRIGGER IF NOT EXISTS file_search_ad AFTER DELETE ON file BEGIN
+			INSERT INTO file_search(file_search,rowid,name,url,headers,body,description)
+			VALUES('delete',old.pk_file_id,old.name,old.url,old.headers,old.body,old.description);
+		END`,
+	"file_search_au": `
+		CREATE TRIGGER IF NOT EXISTS file_search_au AFTER UPDATE OF name,url,headers,body,description ON file BEGIN
+			INSERT INTO file_search(file_search,rowid,name,url,headers,body,description)
+			VALUES('delete',old.pk_file_id,old.name,old.url,old.headers,old.body,old.description);
+			INSERT INTO file_search(rowid,name,url,headers,body,description)
+			VALUES(new.pk_file_id,new.name,new.url,new.headers,new.body,new.description);
+		END`,
+}
+
+type SearchRepo struct {
+	DB *sql.DB
+	// fts is set by EnsureSearchIndex when FTS5 is available
+	fts bool
+}
+
+func NewSearchRepo(DB *sql.DB) *SearchRepo {
+	return &SearchRepo{DB: DB}
+}
+
+// EnsureSearchIndex creates the search index and its triggers and rebuilds
+// the index when the triggers were missing, e.g. on the first start, after
+// running a build without FTS5 or after migrating, which drops the index.
+// It must be called after migrations.
+func (s *SearchRepo) EnsureSearchIndex() error {
+	var available bool
+	if err := s.DB.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&available); err != nil {
+		return err
+	}
+	if !available {
+		// the triggers would make every write to file fail without FTS5
+		s.fts = false
+		for name := range searchTriggers {
+			if _, err := s.DB.Exec(`DROP TRIGGER IF EXISTS ` + name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS file_search USING fts5(
+			name, url, headers, body, description,
+			content='file', content_rowid='pk_file_id',
+			tokenize='unicode61 remove_diacritics 2', prefix='2 3'
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	var existing int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM sqlite_master
+		WHERE type='trigger' AND name IN ('file_search_ai','file_search_ad','file_search_au')
+	`).Scan(&existing)
+	if err != nil {
+		return err
+	}
+	if existing < len(searchTriggers) {
+		for _, statement := range searchTriggers {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`INSERT INTO file_search(file_search) VALUES('rebuild')`); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.fts = true
+	return nil
+}
+
+// searchTerms splits a query on white space.
+func searchTerms(query string) []string {
+	return strings.Fields(query)
+}
+
+// ftsQuery turns user input into an FTS5 query matching every term as a
+// prefix, so that operators and punctuation in the input are taken
+// literally.
+func ftsQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Search returns the files matching every term of query, best match first.
+// A nil collectionId searches all collections. A limit <= 0 returns at most
+// 50 hits.
+func (s *SearchRepo) Search(query string, collectionId *int, limit int) ([]models.SearchHit, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []models.SearchHit{}, nil
+	}
+	if limit <= 0 {
+		limit = searchDefaultLimit
+	}
+
+	var hits []models.SearchHit
+	var err error
+	if s.fts {
+		hits, err = s.searchIndex(terms, collectionId, limit)
+	} else {
+		hits, err = s.searchLike(terms, collectionId, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range hits {
+		hits[i].Breadcrumbs, err = s.breadcrumbs(hits[i].FileId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hits, nil
+}
+
+func (s *SearchRepo) searchIndex(terms []string, collectionId *int, limit int) ([]models.SearchHit, error) {
+	// bm25 is lower for better matches; names weigh most, then URLs
+	rows, err := s.DB.Query(`
+		SELECT f.pk_file_id,f.collection_id,c.name,f.name,f.is_folder,f.method,f.url,
+		snippet(file_search,-1,$1,$2,'…',$3),-bm25(file_search,10.0,5.0,1.0,1.0,2.0) AS rank
+		FROM file_search
+		JOIN file f ON f.pk_file_id = file_search.rowid
+		JOIN collection c ON c.pk_collection_id = f.collection_id
+		WHERE file_search MATCH $4 AND ($5 IS NULL OR f.collection_id = $5)
+		AND f.deleted_at IS NULL AND c.deleted_at IS NULL
+		ORDER BY rank DESC LIMIT $6
+	`, searchMarkStart, searchMarkEnd, searchSnippetTokens, ftsQuery(terms), collectionId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := []models.SearchHit{}
+	for rows.Next() {
+		var hit models.SearchHit
+		err := rows.Scan(
+			&hit.FileId, &hit.CollectionId, &hit.CollectionName, &hit.Name, &hit.IsFolder,
+			&hit.Method, &hit.Url, &hit.Snippet, &hit.Rank,
+		)
+		if err != nil {
+			return nil, err
+		}
+		hit.Snippet = highlightMarked(hit.Snippet)
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// highlightMarked escapes a snippet and turns the match markers into <mark>.
+func highlightMarked(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, searchMarkStart, "<mark>")
+	return strings.ReplaceAll(escaped, searchMarkEnd, "</mark>")
+}
+
+// searchField is a searchable column with the weight used for ranking in
+// the LIKE fallback, in the order snippets are taken from.
+type searchField struct {
+	value  *string
+	weight float64
+}
+
+func (s *SearchRepo) searchLike(terms []string, collectionId *int, limit int) ([]models.SearchHit, error) {
+	conditions := []string{`($1 IS NULL OR f.collection_id = $1)`, `f.deleted_at IS NULL`, `c.deleted_at IS NULL`}
+	args := []any{collectionId}
+	for _, term := range terms {
+		args = append(args, "%"+escapeLike(term)+"%")
+		n := "$" + strconv.Itoa(len(args))
+		conditions = append(conditions, `(f.name LIKE `+n+` ESCAPE '\' OR f.url LIKE `+n+` ESCAPE '\' OR f.headers LIKE `+n+
+			` ESCAPE '\' OR f.body LIKE `+n+` ESCAPE '\' OR f.description LIKE `+n+` ESCAPE '\')`)
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT f.pk_file_id,f.collection_id,c.name,f.name,f.is_folder,f.method,f.url,f.headers,f.body,f.description
+		FROM file f
+		JOIN collection c ON c.pk_collection_id = f.collection_id
+		WHERE `+strings.Join(conditions, " AND "), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := []models.SearchHit{}
+	for rows.Next() {
+		var hit models.SearchHit
+		var headers, body *string
+		var description string
+		err := rows.Scan(
+			&hit.FileId, &hit.CollectionId, &hit.CollectionName, &hit.Name, &hit.IsFolder,
+			&hit.Method, &hit.Url, &headers, &body, &description,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		fields := []searchField{{&hit.Name, 10}, {hit.Url, 5}, {&description, 2}, {body, 1}, {headers, 1}}
+		for _, field := range fields {
+			if field.value == nil {
+				continue
+			}
+			lower := strings.ToLower(*field.value)
+			for _, term := range terms {
+				hit.Rank += field.weight * float64(strings.Count(lower, strings.ToLower(term)))
+			}
+			if hit.Snippet == "" {
+				hit.Snippet = likeSnippet(*field.value, terms)
+			}
+		}
+		hits = append(hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Rank > hits[j].Rank })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
+
+// likeSnippet cuts about 60 bytes around the first term found in value and
+// marks every term in it. It returns "" when no term occurs.
+func likeSnippet(value string, terms []string) string {
+	lower := strings.ToLower(value)
+	if len(lower) != len(value) {
+		// lower casing changed the byte offsets, match case sensitively
+		lower = value
+	}
+
+	first := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, strings.ToLower(term)); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+
+	start, end := max(first-30, 0), min(first+30, len(value))
+	for start > 0 && !utf8.RuneStart(value[start]) {
+		start--
+	}
+	for end < len(value) && !utf8.RuneStart(value[end]) {
+		end++
+	}
+
+	marked := make([]bool, end-start+1)
+	for _, term := range terms {
+		term = strings.ToLower(term)
+		for offset := start; ; {
+			i := strings.Index(lower[offset:end], term)
+			if i < 0 {
+				break
+			}
+			for j := offset + i; j < offset+i+len(term); j++ {
+				marked[j-start] = true
+			}
+			offset += i + len(term)
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		if marked[i-start] && (i == start || !marked[i-start-1]) {
+			b.WriteString("<mark>")
+		}
+		_, size := utf8.DecodeRuneInString(value[i:])
+		b.WriteString(html.EscapeString(value[i : i+size]))
+		i += size
+		if marked[i-start-1] && !marked[i-start] {
+			b.WriteString("</mark>")
+		}
+	}
+	if end < len(value) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// breadcrumbs returns the names of the folders enclosing fileId, outermost
+// first.
+func (s *SearchRepo) breadcrumbs(fileId int64) ([]string, error) {
+	rows, err := s.DB.Query(`
+		WITH RECURSIVE ancestor(pk_file_id,parent_id,name,depth) AS (
+			SELECT p.pk_file_id,p.parent_id,p.name,1 FROM file f
+			JOIN file p ON p.pk_file_id = f.parent_id
+			WHERE f.pk_file_id = $1
+			UNION ALL
+			SELECT p.pk_file_id,p.parent_id,p.name,a.depth+1 FROM ancestor a
+			JOIN file p ON p.pk_file_id = a.parent_id
+		)
+		SELECT name FROM ancestor ORDER BY depth DESC
+	`, fileId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,204 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"posto/app/models"
+	"sort"
+	"time"
+)
+
+const (
+	TrashKindCollection = "collection"
+	TrashKindFile       = "file"
+)
+
+// trashNow has millisecond precision so that items trashed one after the
+// other are told apart when restoring.
+const trashNow = `strftime('%Y-%m-%d %H:%M:%f','now')`
+
+// trashSubtree selects $1 and every file below it.
+const trashSubtree = `
+	WITH RECURSIVE subtree(id) AS (
+		SELECT $1
+		UNION ALL
+		SELECT file.pk_file_id FROM file JOIN subtree ON file.parent_id = subtree.id
+	)
+`
+
+// TrashRepo soft deletes collections and files by setting deleted_at. A
+// folder is trashed with everything below it, all with the same deleted_at,
+// and restoring it brings back exactly those rows; requests trashed on their
+// own before stay in the trash.
+type TrashRepo struct {
+	DB *sql.DB
+}
+
+func NewTrashRepo(DB *sql.DB) *TrashRepo {
+	return &TrashRepo{DB: DB}
+}
+
+func (t *TrashRepo) TrashCollection(id int) error {
+	result, err := t.DB.Exec(`
+		UPDATE collection SET deleted_at = `+trashNow+`
+		WHERE pk_collection_id = $1 AND deleted_at IS NULL
+	`, id)
+	return expectRow(result, err, "collection is not found or already in the trash")
+}
+
+func (t *TrashRepo) TrashFile(fileId int) error {
+	result, err := t.DB.Exec(trashSubtree+`
+		UPDATE file SET deleted_at = `+trashNow+`
+		WHERE pk_file_id IN (SELECT id FROM subtree) AND deleted_at IS NULL
+	`, fileId)
+	return expectRow(result, err, "file is not found or already in the trash")
+}
+
+// SelectTrash lists the trashed items that can be restored, that is the
+// ones whose collection and parent folder are not in the trash themselves,
+// most recently deleted first.
+func (t *TrashRepo) SelectTrash() ([]models.TrashItem, error) {
+	items := []models.TrashItem{}
+
+	rows, err := t.DB.Query(`
+		SELECT pk_collection_id,name,deleted_at FROM collection WHERE deleted_at IS NOT NULL
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item := models.TrashItem{Kind: TrashKindCollection}
+		if err := rows.Scan(&item.Id, &item.Name, &item.DeletedAt); err != nil {
+			return nil, err
+		}
+		item.CollectionId = item.Id
+		item.CollectionName = item.Name
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	fileRows, err := t.DB.Query(`
+		SELECT f.pk_file_id,f.name,f.is_folder,f.collection_id,c.name,f.parent_id,p.name,f.deleted_at
+		FROM file f
+		JOIN collection c ON c.pk_collection_id = f.collection_id
+		LEFT JOIN file p ON p.pk_file_id = f.parent_id
+		WHERE f.deleted_at IS NOT NULL AND c.deleted_at IS NULL AND p.deleted_at IS NULL
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer fileRows.Close()
+	for fileRows.Next() {
+		item := models.TrashItem{Kind: TrashKindFile}
+		err := fileRows.Scan(
+			&item.Id, &item.Name, &item.IsFolder, &item.CollectionId, &item.CollectionName,
+			&item.ParentId, &item.ParentName, &item.DeletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := fileRows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+	return items, nil
+}
+
+func (t *TrashRepo) RestoreCollection(id int) error {
+	result, err := t.DB.Exec(`
+		UPDATE collection SET deleted_at = NULL WHERE pk_collection_id = $1 AND deleted_at IS NOT NULL
+	`, id)
+	return expectRow(result, err, "collection is not in the trash")
+}
+
+// RestoreFile puts a file, and the files trashed with it, back in its
+// folder. It fails while the folder or collection is in the trash.
+func (t *TrashRepo) RestoreFile(fileId int) error {
+	var parentTrashed, collectionTrashed bool
+	err := t.DB.QueryRow(`
+		SELECT p.deleted_at IS NOT NULL, c.deleted_at IS NOT NULL
+		FROM file f
+		JOIN collection c ON c.pk_collection_id = f.collection_id
+		LEFT JOIN file p ON p.pk_file_id = f.parent_id
+		WHERE f.pk_file_id = $1 AND f.deleted_at IS NOT NULL
+	`, fileId).Scan(&parentTrashed, &collectionTrashed)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("file is not in the trash")
+	}
+	if err != nil {
+		return err
+	}
+	if collectionTrashed {
+		return fmt.Errorf("the collection is in the trash, restore it first")
+	}
+	if parentTrashed {
+		return fmt.Errorf("the parent folder is in the trash, restore it first")
+	}
+
+	_, err = t.DB.Exec(trashSubtree+`
+		UPDATE file SET deleted_at = NULL
+		WHERE pk_file_id IN (SELECT id FROM subtree)
+		AND deleted_at = (SELECT deleted_at FROM file WHERE pk_file_id = $1)
+	`, fileId)
+	return err
+}
+
+// PurgeTrash permanently deletes what was trashed more than olderThan ago,
+// including the examples and revisions of the deleted requests. History
+// entries are kept. A zero olderThan empties the trash.
+func (t *TrashRepo) PurgeTrash(olderThan time.Duration) error {
+	tx, err := t.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// files of purged collections go with them, whether trashed or not
+	purged := `
+		WITH purged(id) AS (
+			SELECT f.pk_file_id FROM file f
+			JOIN collection c ON c.pk_collection_id = f.collection_id
+			WHERE f.deleted_at < strftime('%Y-%m-%d %H:%M:%f','now',$1)
+			OR c.deleted_at < strftime('%Y-%m-%d %H:%M:%f','now',$1)
+		)
+	`
+	collections := `
+		SELECT pk_collection_id FROM collection WHERE deleted_at < strftime('%Y-%m-%d %H:%M:%f','now',$1)
+	`
+	statements := []string{
+		purged + `DELETE FROM example WHERE file_id IN (SELECT id FROM purged)`,
+		purged + `DELETE FROM revision WHERE file_id IN (SELECT id FROM purged)`,
+		purged + `UPDATE history SET file_id = NULL WHERE file_id IN (SELECT id FROM purged)`,
+		purged + `DELETE FROM file WHERE pk_file_id IN (SELECT id FROM purged)`,
+		`DELETE FROM mirror_entry WHERE mirror_id IN (SELECT pk_mirror_id FROM mirror WHERE collection_id IN (` + collections + `))`,
+		`DELETE FROM mirror WHERE collection_id IN (` + collections + `)`,
+		`DELETE FROM collection WHERE pk_collection_id IN (` + collections + `)`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, sqliteModifier(olderThan)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// expectRow turns an update that matched no row into an error.
+func expectRow(result sql.Result, err error, message string) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s", message)
+	}
+	return nil
+}
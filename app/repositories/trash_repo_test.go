@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"posto/app/db"
+	"testing"
+)
+
+func TestTrashedCollectionHidesFiles(t *testing.T) {
+	conn, err := db.OpenDB(":memory:")
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.MigrateDB(conn); err != nil {
+		t.Fatalf("MigrateDB: %v", err)
+	}
+	repos := NewRepositories(conn)
+
+	collectionId, err := repos.Collection.InsertCollection("Trashed")
+	if err != nil {
+		t.Fatalf("InsertCollection: %v", err)
+	}
+	fileId, err := repos.File.CreateFileOrFolder(FileCreationParam{CollectionId: collectionId, Name: "Get user"})
+	if err != nil {
+		t.Fatalf("CreateFileOrFolder: %v", err)
+	}
+
+	visible := func() bool {
+		t.Helper()
+		_, err := repos.File.GetRequestData(*fileId)
+		files, listErr := repos.File.SelectFilesByCollection(collectionId)
+		if listErr != nil {
+			t.Fatalf("SelectFilesByCollection: %v", listErr)
+		}
+		if (err == nil) != (len(files) == 1) {
+			t.Fatalf("GetRequestData error %v but %d files listed", err, len(files))
+		}
+		return err == nil
+	}
+
+	if !visible() {
+		t.Fatal("request is hidden before trashing its collection")
+	}
+	if err := repos.Trash.TrashCollection(collectionId); err != nil {
+		t.Fatalf("TrashCollection: %v", err)
+	}
+	if visible() {
+		t.Error("request of a trashed collection can still be loaded")
+	}
+	if err := repos.Trash.RestoreCollection(collectionId); err != nil {
+		t.Fatalf("RestoreCollection: %v", err)
+	}
+	if !visible() {
+		t.Error("request is hidden after restoring its collection")
+	}
+}
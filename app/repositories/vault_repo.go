@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	"database/sql"
+	"posto/app/models"
+)
+
+type VaultRepo struct {
+	DB *sql.DB
+}
+
+func NewVaultRepo(DB *sql.DB) *VaultRepo {
+	return &VaultRepo{DB: DB}
+}
+
+// SelectVault returns the vault of the database, nil when secrets have not
+// been set up.
+func (v *VaultRepo) SelectVault() (*models.Vault, error) {
+	var vault models.Vault
+	err := v.DB.QueryRow(`
+		SELECT method,salt,iterations,check_value,created_at FROM vault WHERE pk_vault_id = 1
+	`).Scan(&vault.Method, &vault.Salt, &vault.Iterations, &vault.CheckValue, &vault.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &vault, nil
+}
+
+func (v *VaultRepo) InsertVault(vault models.Vault) error {
+	_, err := v.DB.Exec(`
+		INSERT INTO vault(pk_vault_id,method,salt,iterations,check_value) VALUES(1,$1,$2,$3,$4)
+	`, vault.Method, vault.Salt, vault.Iterations, vault.CheckValue)
+	return err
+}
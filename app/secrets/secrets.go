@@ -0,0 +1,139 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Sealed values are AES-256-GCM encrypted, base64 encoded with their nonce
+// and prefixed so that they are told apart from plain text.
+const sealedPrefix = "posto-sealed:v1:"
+
+const KeySize = 32
+
+var ErrLocked = errors.New("secret variables are locked, unlock them with the master password or key file")
+
+// key is the key of the open database's secrets, only ever kept in memory.
+var (
+	mu  sync.RWMutex
+	key []byte
+)
+
+// Unlock makes Seal and Open use k.
+func Unlock(k []byte) {
+	mu.Lock()
+	defer mu.Unlock()
+	key = k
+}
+
+// Lock forgets the key.
+func Lock() {
+	mu.Lock()
+	defer mu.Unlock()
+	key = nil
+}
+
+func Unlocked() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return key != nil
+}
+
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+// Seal encrypts plain with the unlocked key.
+func Seal(plain string) (string, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if key == nil {
+		return "", ErrLocked
+	}
+	return SealWith(key, plain)
+}
+
+// Open decrypts a value returned by Seal.
+func Open(sealed string) (string, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if key == nil {
+		return "", ErrLocked
+	}
+	return OpenWith(key, sealed)
+}
+
+func SealWith(k []byte, plain string) (string, error) {
+	gcm, err := newGCM(k)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func OpenWith(k []byte, sealed string) (string, error) {
+	encoded, ok := strings.CutPrefix(sealed, sealedPrefix)
+	if !ok {
+		return "", fmt.Errorf("value is not sealed")
+	}
+	content, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("sealed value is corrupt: %v", err)
+	}
+	gcm, err := newGCM(k)
+	if err != nil {
+		return "", err
+	}
+	if len(content) < gcm.NonceSize() {
+		return "", fmt.Errorf("sealed value is corrupt")
+	}
+	plain, err := gcm.Open(nil, content[:gcm.NonceSize()], content[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("sealed value cannot be decrypted with this key")
+	}
+	return string(plain), nil
+}
+
+func newGCM(k []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// RandomBytes returns n bytes from the system's secure random source.
+func RandomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	return b, err
+}
+
+// PasswordKey derives a key from a master password with PBKDF2-HMAC-SHA256
+// (RFC 8018).
+func PasswordKey(password string, salt []byte, iterations int) []byte {
+	return pbkdf2.Key([]byte(password), salt, iterations, KeySize, sha256.New)
+}
+
+// KeyFileKey derives a key from the content of a key file, which is random
+// already and needs no stretching.
+func KeyFileKey(content []byte, salt []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(content)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,52 @@
+package secrets
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestPasswordKey(t *testing.T) {
+	// PBKDF2-HMAC-SHA256 test vectors of RFC 7914 section 11, cut to KeySize.
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(PasswordKey(tt.password, []byte(tt.salt), tt.iterations))
+		if got != tt.want {
+			t.Errorf("PasswordKey(%q, %q, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	key := PasswordKey("master", []byte("salt"), 1)
+	other := PasswordKey("other", []byte("salt"), 1)
+
+	tests := []string{"", "secret", "ünïcode ✓", "posto-sealed:v1:not really"}
+	for _, plain := range tests {
+		sealed, err := SealWith(key, plain)
+		if err != nil {
+			t.Fatalf("SealWith(%q): %v", plain, err)
+		}
+		if !IsSealed(sealed) {
+			t.Errorf("SealWith(%q) = %q, not sealed", plain, sealed)
+		}
+		opened, err := OpenWith(key, sealed)
+		if err != nil || opened != plain {
+			t.Errorf("OpenWith(SealWith(%q)) = %q, %v", plain, opened, err)
+		}
+		if _, err := OpenWith(other, sealed); err == nil {
+			t.Errorf("OpenWith with another key opened %q", plain)
+		}
+	}
+
+	if _, err := OpenWith(key, "plain"); err == nil {
+		t.Error("OpenWith of a plain value did not fail")
+	}
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"posto/app/models"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseAssertions decodes the JSON array stored in file.assertions.
+func ParseAssertions(raw *string) ([]models.Assertion, error) {
+	assertions := []models.Assertion{}
+	if raw == nil || strings.TrimSpace(*raw) == "" {
+		return assertions, nil
+	}
+	if err := json.Unmarshal([]byte(*raw), &assertions); err != nil {
+		return nil, fmt.Errorf("invalid assertions: %v", err)
+	}
+	return assertions, nil
+}
+
+// EvaluateAssertions checks every assertion against the response.
+func EvaluateAssertions(assertions []models.Assertion, resp models.HttpResponse) []models.AssertionResult {
+	results := []models.AssertionResult{}
+	for _, assertion := range assertions {
+		results = append(results, evaluateAssertion(assertion, resp))
+	}
+	return results
+}
+
+func evaluateAssertion(assertion models.Assertion, resp models.HttpResponse) models.AssertionResult {
+	result := models.AssertionResult{Assertion: assertion}
+
+	actual, found, err := assertionActual(assertion, resp)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	result.Actual = actual
+
+	operator := assertion.Operator
+	if operator == "" {
+		operator = "eq"
+	}
+
+	switch operator {
+	case "exists":
+		result.Passed = found
+	case "eq":
+		result.Passed = found && actual == assertion.Expected
+	case "neq":
+		result.Passed = !found || actual != assertion.Expected
+	case "contains":
+		result.Passed = found && strings.Contains(actual, assertion.Expected)
+	case "not_contains":
+		result.Passed = !found || !strings.Contains(actual, assertion.Expected)
+	case "gt", "lt":
+		actualNum, errA := strconv.ParseFloat(actual, 64)
+		expectedNum, errE := strconv.ParseFloat(assertion.Expected, 64)
+		if !found || errA != nil || errE != nil {
+			result.Message = fmt.Sprintf("cannot compare %q with %q numerically", actual, assertion.Expected)
+			return result
+		}
+		if operator == "gt" {
+			result.Passed = actualNum > expectedNum
+		} else {
+			result.Passed = actualNum < expectedNum
+		}
+	case "matches":
+		re, err := regexp.Compile(assertion.Expected)
+		if err != nil {
+			result.Message = fmt.Sprintf("invalid pattern: %v", err)
+			return result
+		}
+		result.Passed = found && re.MatchString(actual)
+	default:
+		result.Message = fmt.Sprintf("unknown operator %q", assertion.Operator)
+		return result
+	}
+
+	if !result.Passed {
+		result.Message = fmt.Sprintf("expected %s %s %q, got %q", assertionSubject(assertion), operator, assertion.Expected, actual)
+		if !found {
+			result.Message = fmt.Sprintf("expected %s %s %q, but it was not found", assertionSubject(assertion), operator, assertion.Expected)
+		}
+	}
+	return result
+}
+
+func assertionSubject(assertion models.Assertion) string {
+	if assertion.Property == "" {
+		return assertion.Source
+	}
+	return assertion.Source + " " + assertion.Property
+}
+
+// errTruncatedBody fails body assertions on a response of which only the
+// start was kept, see models.HttpResponse.Truncated.
+var errTruncatedBody = fmt.Errorf("response body exceeded the memory limit, raise response_memory_limit_mb to assert on it")
+
+// assertionActual extracts the value an assertion is checked against and
+// whether it was present in the response at all.
+func assertionActual(assertion models.Assertion, resp models.HttpResponse) (string, bool, error) {
+	switch assertion.Source {
+	case "status":
+		return strconv.Itoa(resp.StatusCode), true, nil
+	case "duration":
+		return strconv.FormatInt(resp.DurationMs, 10), true, nil
+	case "header":
+		name := http.CanonicalHeaderKey(assertion.Property)
+		for k, v := range resp.Headers {
+			if http.CanonicalHeaderKey(k) == name {
+				return v, true, nil
+			}
+		}
+		return "", false, nil
+	case "body":
+		if resp.Truncated {
+			return "", false, errTruncatedBody
+		}
+		return resp.Body, true, nil
+	case "json":
+		if resp.Truncated {
+			return "", false, errTruncatedBody
+		}
+		if resp.IsBinary {
+			return "", false, fmt.Errorf("response body is not JSON")
+		}
+		var doc any
+		if err := json.Unmarshal([]byte(resp.Body), &doc); err != nil {
+			return "", false, fmt.Errorf("response body is not JSON: %v", err)
+		}
+		value, found := LookupJSONPath(doc, assertion.Property)
+		if !found {
+			return "", false, nil
+		}
+		return jsonValueString(value), true, nil
+	default:
+		return "", false, fmt.Errorf("unknown assertion source %q", assertion.Source)
+	}
+}
+
+// LookupJSONPath walks a decoded JSON document using a dotted path such as
+// data.items.0.id. A leading "$." is accepted and ignored.
+func LookupJSONPath(doc any, path string) (any, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return doc, true
+	}
+
+	current := doc
+	for _, part := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]any:
+			value, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []any:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, false
+			}
+			current = node[idx]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func jsonValueString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return "null"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"fmt"
+	"posto/app/db"
+	"posto/app/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// backupCheckInterval is how often the scheduler checks whether an
+	// automatic backup is due, so that short sessions are covered too.
+	backupCheckInterval = 10 * time.Minute
+	backupLabelAuto     = "auto"
+	backupLabelManual   = "manual"
+)
+
+// BackupScheduler backs up the database every interval and keeps the keep
+// newest automatic and manual backups. The newest automatic backup on disk decides when the next
+// one is due, so restarting the app does not reset the schedule.
+type BackupScheduler struct {
+	mu       sync.Mutex
+	interval time.Duration
+	keep     int
+	stop     chan struct{}
+}
+
+func NewBackupScheduler(interval time.Duration, keep int) *BackupScheduler {
+	return &BackupScheduler{interval: interval, keep: keep}
+}
+
+// Start runs a backup right away when one is due and then checks
+// periodically until Stop is called. A zero interval disables automatic
+// backups.
+func (b *BackupScheduler) Start() {
+	b.Stop()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	interval := b.interval
+	if interval <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	b.stop = stop
+
+	go func() {
+		ticker := time.NewTicker(min(backupCheckInterval, interval))
+		defer ticker.Stop()
+		b.backupIfDue(interval)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				b.backupIfDue(interval)
+			}
+		}
+	}()
+}
+
+func (b *BackupScheduler) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+}
+
+// SetSchedule changes the interval and number of kept backups and restarts
+// the scheduler with them.
+func (b *BackupScheduler) SetSchedule(interval time.Duration, keep int) {
+	b.Stop()
+	b.mu.Lock()
+	b.interval = interval
+	b.keep = keep
+	b.mu.Unlock()
+	b.Start()
+}
+
+// BackupNow backs up the database and rotates old backups.
+func (b *BackupScheduler) BackupNow() (models.Backup, error) {
+	return b.backup(backupLabelManual)
+}
+
+func (b *BackupScheduler) backup(label string) (models.Backup, error) {
+	// a corrupt database must not push the good backups out of the rotation
+	if err := db.CheckIntegrity(); err != nil {
+		return models.Backup{}, err
+	}
+	backup, err := db.Backup(label)
+	if err != nil {
+		return models.Backup{}, fmt.Errorf("error backing up database: %v", err)
+	}
+	b.mu.Lock()
+	keep := b.keep
+	b.mu.Unlock()
+	if err := db.RotateBackups(keep, backupLabelAuto, backupLabelManual); err != nil {
+		return backup, fmt.Errorf("error deleting old backups: %v", err)
+	}
+	return backup, nil
+}
+
+func (b *BackupScheduler) backupIfDue(interval time.Duration) {
+	backups, err := db.SelectBackups()
+	if err != nil {
+		return
+	}
+	for _, backup := range backups {
+		if strings.Contains(backup.Name, "-"+backupLabelAuto+"-") {
+			if time.Since(backup.CreatedAt) < interval {
+				return
+			}
+			break
+		}
+	}
+	b.backup(backupLabelAuto)
+}
@@ -0,0 +1,448 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"posto/app/models"
+	"posto/app/redact"
+	"posto/app/repositories"
+)
+
+const (
+	BundleFormat = "posto-collection"
+	// BundleVersion is the schema version written by WriteCollectionBundle.
+	// Older bundles are upgraded when read, see bundleUpgrades.
+	BundleVersion = 2
+)
+
+// CollectionBundle is the portable JSON representation of a collection used
+// for export/import and for running collections from a file with the CLI.
+// It holds everything stored for the collection: the folder tree, requests
+// with their headers (including auth headers), bodies, assertions, mock
+// responses and examples, and optionally the environments with their
+// variables.
+type CollectionBundle struct {
+	Format       string               `json:"format,omitempty"`
+	Version      int                  `json:"version,omitempty"`
+	Name         string               `json:"name"`
+	Description  string               `json:"description,omitempty"`
+	Items        []BundleItem         `json:"items"`
+	Environments []models.Environment `json:"environments,omitempty"`
+}
+
+// BundleItem is a folder or a request. Request fields hold the raw values
+// stored in the file table; in the JSON encoding headers, assertions and
+// mock are embedded as JSON values, see MarshalJSON.
+type BundleItem struct {
+	Name       string           `json:"name"`
+	IsFolder   bool             `json:"is_folder"`
+	Method     *string          `json:"method,omitempty"`
+	Url        *string          `json:"url,omitempty"`
+	Headers    *string          `json:"headers,omitempty"`
+	Body       *string          `json:"body,omitempty"`
+	Assertions *string          `json:"assertions,omitempty"`
+	Mock       *string          `json:"mock,omitempty"`
+	Examples   []models.Example `json:"examples,omitempty"`
+	Items      []BundleItem     `json:"items,omitempty"`
+	// Description is Markdown, for folders and requests.
+	Description string `json:"description,omitempty"`
+}
+
+// ExportCollectionBundle builds the bundle of a collection. Secret
+// variables of the environments are exported empty and requests and
+// examples are redacted with the exports policy, unless includeSecrets is
+// set, which needs unlocked secrets.
+func ExportCollectionBundle(repos *repositories.Repositories, collectionId int, includeEnvironments bool, includeSecrets bool) (CollectionBundle, error) {
+	bundle := CollectionBundle{Items: []BundleItem{}}
+
+	collection, err := repos.Collection.SelectCollectionById(collectionId)
+	if err != nil {
+		return bundle, fmt.Errorf("error loading collection: %v", err)
+	}
+	bundle.Name = collection.Name
+	bundle.Description = collection.Description
+
+	files, err := repos.File.SelectFilesByCollection(collectionId)
+	if err != nil {
+		return bundle, fmt.Errorf("error loading files: %v", err)
+	}
+	examples, err := repos.Example.SelectExamplesByCollection(collectionId)
+	if err != nil {
+		return bundle, fmt.Errorf("error loading examples: %v", err)
+	}
+	policy := redact.Exports()
+	if includeSecrets {
+		policy = nil
+	}
+	bundle.Items = bundleItems(BuildFileTree(files), examples, policy)
+
+	if includeEnvironments {
+		environments, err := repos.Environment.SelectAllEnvironments()
+		if err != nil {
+			return bundle, fmt.Errorf("error loading environments: %v", err)
+		}
+		for i := range environments {
+			environments[i].Variables, err = exportVariables(environments[i].Variables, includeSecrets)
+			if err != nil {
+				return bundle, fmt.Errorf("error exporting environment %q: %v", environments[i].Name, err)
+			}
+		}
+		bundle.Environments = environments
+	}
+
+	return bundle, nil
+}
+
+func bundleItems(nodes []*FileNode, examples map[int64][]models.Example, policy *redact.Policy) []BundleItem {
+	items := []BundleItem{}
+	for _, node := range nodes {
+		item := BundleItem{Name: node.File.Name, IsFolder: node.File.IsFolder, Description: node.File.Description}
+		if node.File.IsFolder {
+			item.Items = bundleItems(node.Children, examples, policy)
+		} else {
+			item.Method = node.File.Method
+			item.Url = node.File.Url
+			item.Headers = node.File.Headers
+			item.Body = node.File.Body
+			item.Assertions = node.File.Assertions
+			item.Mock = node.File.Mock
+			item.Examples = examples[node.File.PkFileId]
+			if policy != nil {
+				redactBundleItem(policy, &item)
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// redactBundleItem redacts the url, headers and body of a request and its
+// examples. Headers that are not a JSON object are left as is.
+func redactBundleItem(policy *redact.Policy, item *BundleItem) {
+	redactString := func(value *string, apply func(string) string) *string {
+		if value == nil {
+			return nil
+		}
+		redacted := apply(*value)
+		return &redacted
+	}
+	item.Url = redactString(item.Url, policy.Url)
+	item.Body = redactString(item.Body, policy.Body)
+	item.Headers = redactString(item.Headers, func(value string) string {
+		var headers map[string]string
+		if err := json.Unmarshal([]byte(value), &headers); err != nil || headers == nil {
+			return value
+		}
+		redacted := policy.Headers(headers)
+		if maps.Equal(headers, redacted) {
+			// keep the stored formatting
+			return value
+		}
+		content, err := json.Marshal(redacted)
+		if err != nil {
+			return value
+		}
+		return string(content)
+	})
+
+	redacted := []models.Example{}
+	for _, example := range item.Examples {
+		example.Headers = policy.Headers(example.Headers)
+		if !example.IsBinary {
+			example.Body = policy.Body(example.Body)
+		}
+		redacted = append(redacted, example)
+	}
+	if item.Examples != nil {
+		item.Examples = redacted
+	}
+}
+
+// ImportCollectionBundle creates a new collection from the bundle and returns
+// its id. Environments that do not exist yet by name are created as well.
+func ImportCollectionBundle(repos *repositories.Repositories, bundle CollectionBundle) (int, error) {
+	return importCollectionBundle(repos, bundle, &ImportReport{})
+}
+
+// importCollectionBundle is ImportCollectionBundle counting what was created
+// into report.
+func importCollectionBundle(repos *repositories.Repositories, bundle CollectionBundle, report *ImportReport) (int, error) {
+	if bundle.Name == "" {
+		return -1, fmt.Errorf("collection name is missing")
+	}
+
+	collectionId, err := repos.Collection.InsertCollection(bundle.Name)
+	if err != nil {
+		return -1, fmt.Errorf("error creating collection: %v", err)
+	}
+	if bundle.Description != "" {
+		if err := repos.Collection.UpdateCollectionDescription(collectionId, bundle.Description); err != nil {
+			return collectionId, fmt.Errorf("error saving collection description: %v", err)
+		}
+	}
+
+	if err := importBundleItems(repos, collectionId, nil, bundle.Items, report); err != nil {
+		return collectionId, err
+	}
+
+	for _, environment := range bundle.Environments {
+		_, err := repos.Environment.SelectEnvironmentByName(environment.Name)
+		if err == nil {
+			report.Warn("environment %q already exists and was not imported", environment.Name)
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return collectionId, fmt.Errorf("error loading environment: %v", err)
+		}
+		variables, err := importVariables(environment.Name, environment.Variables, report)
+		if err != nil {
+			return collectionId, fmt.Errorf("error importing environment %q: %v", environment.Name, err)
+		}
+		if _, err := repos.Environment.InsertEnvironment(environment.Name, variables); err != nil {
+			return collectionId, fmt.Errorf("error creating environment %q: %v", environment.Name, err)
+		}
+		report.Environments++
+	}
+
+	return collectionId, nil
+}
+
+func importBundleItems(repos *repositories.Repositories, collectionId int, parentId *int, items []BundleItem, report *ImportReport) error {
+	for _, item := range items {
+		fileId, err := repos.File.CreateFileOrFolder(repositories.FileCreationParam{
+			CollectionId: collectionId,
+			ParentId:     parentId,
+			IsFolder:     item.IsFolder,
+			Name:         item.Name,
+		})
+		if err != nil {
+			return fmt.Errorf("error creating %q: %v", item.Name, err)
+		}
+
+		if item.IsFolder {
+			report.Folders++
+			if item.Description != "" {
+				if err := repos.File.UpdateFile(*fileId, repositories.FileRequestData{Description: &item.Description}); err != nil {
+					return fmt.Errorf("error saving folder %q: %v", item.Name, err)
+				}
+			}
+			if err := importBundleItems(repos, collectionId, fileId, item.Items, report); err != nil {
+				return err
+			}
+			continue
+		}
+		report.Requests++
+
+		requestData := repositories.FileRequestData{
+			Method:     item.Method,
+			Url:        item.Url,
+			Headers:    item.Headers,
+			Body:       item.Body,
+			Assertions: item.Assertions,
+			Mock:       item.Mock,
+		}
+		if item.Description != "" {
+			requestData.Description = &item.Description
+		}
+		if !requestData.IsEmpty() {
+			if err := repos.File.UpdateFile(*fileId, requestData); err != nil {
+				return fmt.Errorf("error saving request %q: %v", item.Name, err)
+			}
+		}
+
+		for _, example := range item.Examples {
+			example.FileId = int64(*fileId)
+			if _, err := repos.Example.InsertExample(example); err != nil {
+				return fmt.Errorf("error saving example %q of %q: %v", example.Name, item.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// bundleItemJSON is the encoding of a BundleItem since version 2. Headers,
+// assertions and mock are JSON values instead of strings holding JSON.
+type bundleItemJSON struct {
+	Name        string           `json:"name"`
+	IsFolder    bool             `json:"is_folder"`
+	Method      *string          `json:"method,omitempty"`
+	Url         *string          `json:"url,omitempty"`
+	Headers     json.RawMessage  `json:"headers,omitempty"`
+	Body        *string          `json:"body,omitempty"`
+	Assertions  json.RawMessage  `json:"assertions,omitempty"`
+	Mock        json.RawMessage  `json:"mock,omitempty"`
+	Examples    []models.Example `json:"examples,omitempty"`
+	Items       []BundleItem     `json:"items,omitempty"`
+	Description string           `json:"description,omitempty"`
+}
+
+func (i BundleItem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bundleItemJSON{
+		Name:        i.Name,
+		IsFolder:    i.IsFolder,
+		Method:      i.Method,
+		Url:         i.Url,
+		Headers:     embedJSON(i.Headers),
+		Body:        i.Body,
+		Assertions:  embedJSON(i.Assertions),
+		Mock:        embedJSON(i.Mock),
+		Examples:    i.Examples,
+		Items:       i.Items,
+		Description: i.Description,
+	})
+}
+
+func (i *BundleItem) UnmarshalJSON(data []byte) error {
+	var item bundleItemJSON
+	if err := json.Unmarshal(data, &item); err != nil {
+		return err
+	}
+	*i = BundleItem{
+		Name:        item.Name,
+		IsFolder:    item.IsFolder,
+		Method:      item.Method,
+		Url:         item.Url,
+		Body:        item.Body,
+		Examples:    item.Examples,
+		Items:       item.Items,
+		Description: item.Description,
+	}
+	var err error
+	if i.Headers, err = extractJSON(item.Headers); err != nil {
+		return fmt.Errorf("%q: invalid headers: %v", item.Name, err)
+	}
+	if i.Assertions, err = extractJSON(item.Assertions); err != nil {
+		return fmt.Errorf("%q: invalid assertions: %v", item.Name, err)
+	}
+	if i.Mock, err = extractJSON(item.Mock); err != nil {
+		return fmt.Errorf("%q: invalid mock: %v", item.Name, err)
+	}
+	return nil
+}
+
+// embedJSON embeds a stored JSON column as is. Values that are not valid
+// JSON are kept as a JSON string so that nothing is lost.
+func embedJSON(value *string) json.RawMessage {
+	if value == nil {
+		return nil
+	}
+	if json.Valid([]byte(*value)) {
+		return json.RawMessage(*value)
+	}
+	encoded, _ := json.Marshal(*value)
+	return encoded
+}
+
+// extractJSON reverses embedJSON.
+func extractJSON(raw json.RawMessage) (*string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		return &value, nil
+	}
+	value := string(raw)
+	return &value, nil
+}
+
+// bundleUpgrades[v] upgrades the decoded JSON of a version v bundle to
+// version v+1. Bundles without a version are version 1.
+var bundleUpgrades = map[int]func(bundle map[string]any) error{
+	1: upgradeBundleV1,
+}
+
+// upgradeBundleV1 replaces the JSON strings of headers, assertions and mock
+// with the JSON values they hold.
+func upgradeBundleV1(bundle map[string]any) error {
+	var upgradeItems func(items any) error
+	upgradeItems = func(items any) error {
+		list, _ := items.([]any)
+		for _, value := range list {
+			item, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("invalid item %v", value)
+			}
+			for _, key := range []string{"headers", "assertions", "mock"} {
+				text, ok := item[key].(string)
+				if !ok || !json.Valid([]byte(text)) {
+					continue
+				}
+				var decoded any
+				json.Unmarshal([]byte(text), &decoded)
+				item[key] = decoded
+			}
+			if err := upgradeItems(item["items"]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return upgradeItems(bundle["items"])
+}
+
+// ParseCollectionBundle decodes a bundle of any known version, upgrading it
+// to BundleVersion first.
+func ParseCollectionBundle(content []byte) (CollectionBundle, error) {
+	var bundle CollectionBundle
+
+	var document map[string]any
+	if err := json.Unmarshal(content, &document); err != nil {
+		return bundle, fmt.Errorf("error parsing bundle: %v", err)
+	}
+	if format, ok := document["format"].(string); ok && format != BundleFormat {
+		return bundle, fmt.Errorf("unexpected bundle format %q", format)
+	}
+
+	version := 1
+	if value, ok := document["version"].(float64); ok {
+		version = int(value)
+	}
+	if version > BundleVersion {
+		return bundle, fmt.Errorf("bundle version %d was written by a newer version of Posto, version %d is supported", version, BundleVersion)
+	}
+	for ; version < BundleVersion; version++ {
+		if err := bundleUpgrades[version](document); err != nil {
+			return bundle, fmt.Errorf("error upgrading bundle from version %d: %v", version, err)
+		}
+	}
+	document["format"] = BundleFormat
+	document["version"] = BundleVersion
+
+	upgraded, err := json.Marshal(document)
+	if err != nil {
+		return bundle, err
+	}
+	if err := json.Unmarshal(upgraded, &bundle); err != nil {
+		return bundle, fmt.Errorf("error parsing bundle: %v", err)
+	}
+	return bundle, nil
+}
+
+func ReadCollectionBundle(path string) (CollectionBundle, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return CollectionBundle{}, fmt.Errorf("error reading bundle: %v", err)
+	}
+	return ParseCollectionBundle(content)
+}
+
+// WriteCollectionBundle writes the bundle as the current BundleVersion.
+func WriteCollectionBundle(path string, bundle CollectionBundle) error {
+	bundle.Format = BundleFormat
+	bundle.Version = BundleVersion
+	content, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("error writing bundle: %v", err)
+	}
+	return nil
+}
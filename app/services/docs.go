@@ -0,0 +1,396 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"posto/app/models"
+	"posto/app/redact"
+	"posto/app/repositories"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CollectionDocs is the documentation of a collection, rendered as a static
+// HTML page by RenderDocsHTML and as Markdown by RenderDocsMarkdown.
+type CollectionDocs struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	GeneratedAt time.Time     `json:"generated_at"`
+	Sections    []*DocSection `json:"sections"`
+}
+
+// DocSection documents a folder or a request. Depth is 1 for top level
+// items.
+type DocSection struct {
+	Anchor       string        `json:"anchor"`
+	Name         string        `json:"name"`
+	Path         []string      `json:"path"`
+	Depth        int           `json:"depth"`
+	IsFolder     bool          `json:"is_folder"`
+	Description  string        `json:"description,omitempty"`
+	Method       string        `json:"method,omitempty"`
+	Url          string        `json:"url,omitempty"`
+	Headers      []DocHeader   `json:"headers,omitempty"`
+	Body         string        `json:"body,omitempty"`
+	BodyLanguage string        `json:"body_language,omitempty"`
+	Examples     []DocExample  `json:"examples,omitempty"`
+	Children     []*DocSection `json:"children,omitempty"`
+}
+
+type DocHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type DocExample struct {
+	Name         string      `json:"name"`
+	StatusCode   int         `json:"status_code"`
+	StatusText   string      `json:"status_text"`
+	ContentType  string      `json:"content_type"`
+	Headers      []DocHeader `json:"headers,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyLanguage string      `json:"body_language,omitempty"`
+	IsBinary     bool        `json:"is_binary"`
+}
+
+// BuildCollectionDocs collects the folders, requests and saved examples of
+// a collection in tree order. Values are redacted with the exports policy.
+func BuildCollectionDocs(repos *repositories.Repositories, collectionId int) (CollectionDocs, error) {
+	docs := CollectionDocs{GeneratedAt: time.Now(), Sections: []*DocSection{}}
+
+	collection, err := repos.Collection.SelectCollectionById(collectionId)
+	if err != nil {
+		return docs, fmt.Errorf("error loading collection: %v", err)
+	}
+	docs.Name = collection.Name
+	docs.Description = collection.Description
+
+	files, err := repos.File.SelectFilesByCollection(collectionId)
+	if err != nil {
+		return docs, fmt.Errorf("error loading files: %v", err)
+	}
+	examples, err := repos.Example.SelectExamplesByCollection(collectionId)
+	if err != nil {
+		return docs, fmt.Errorf("error loading examples: %v", err)
+	}
+
+	anchors := map[string]bool{}
+	docs.Sections = docSections(BuildFileTree(files), examples, anchors, redact.Exports())
+	return docs, nil
+}
+
+func docSections(nodes []*FileNode, examples map[int64][]models.Example, anchors map[string]bool, policy *redact.Policy) []*DocSection {
+	sections := []*DocSection{}
+	for _, node := range nodes {
+		section := &DocSection{
+			Anchor:      docAnchor(append(append([]string{}, node.Path...), node.File.Name), anchors),
+			Name:        node.File.Name,
+			Path:        node.Path,
+			Depth:       len(node.Path) + 1,
+			IsFolder:    node.File.IsFolder,
+			Description: strings.TrimSpace(node.File.Description),
+		}
+		if node.File.IsFolder {
+			section.Children = docSections(node.Children, examples, anchors, policy)
+			sections = append(sections, section)
+			continue
+		}
+
+		request := mirrorRequestFromFile(node.File)
+		section.Method = strings.ToUpper(request.Method)
+		section.Url = policy.Url(request.Url)
+		section.Headers = docHeaders(policy.Headers(request.Headers))
+		if section.Method != http.MethodGet {
+			section.Body, section.BodyLanguage = docBody(policy.Body(request.Body), request.Headers["Content-Type"])
+		}
+		for _, example := range examples[node.File.PkFileId] {
+			docExample := DocExample{
+				Name:        example.Name,
+				StatusCode:  example.StatusCode,
+				StatusText:  http.StatusText(example.StatusCode),
+				ContentType: example.ContentType,
+				Headers:     docHeaders(policy.Headers(example.Headers)),
+				IsBinary:    example.IsBinary,
+			}
+			if !example.IsBinary {
+				docExample.Body, docExample.BodyLanguage = docBody(policy.Body(example.Body), example.ContentType)
+			}
+			section.Examples = append(section.Examples, docExample)
+		}
+		sections = append(sections, section)
+	}
+	return sections
+}
+
+var docAnchorInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+
+// docAnchor derives a unique html id from the folder path and name.
+func docAnchor(path []string, used map[string]bool) string {
+	base := strings.Trim(docAnchorInvalid.ReplaceAllString(strings.ToLower(strings.Join(path, "-")), "-"), "-")
+	if base == "" {
+		base = "section"
+	}
+	anchor := base
+	for i := 2; used[anchor]; i++ {
+		anchor = fmt.Sprintf("%s-%d", base, i)
+	}
+	used[anchor] = true
+	return anchor
+}
+
+func docHeaders(headers map[string]string) []DocHeader {
+	list := []DocHeader{}
+	for name, value := range headers {
+		list = append(list, DocHeader{Name: name, Value: value})
+	}
+	sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name) })
+	return list
+}
+
+// docBody pretty prints JSON bodies and guesses the language used for
+// syntax highlighting in Markdown.
+func docBody(body string, contentType string) (string, string) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", ""
+	}
+	if json.Valid([]byte(body)) {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, []byte(body), "", "  "); err == nil {
+			return indented.String(), "json"
+		}
+	}
+	contentType = strings.ToLower(contentType)
+	switch {
+	case strings.Contains(contentType, "xml"):
+		return body, "xml"
+	case strings.Contains(contentType, "html"):
+		return body, "html"
+	case strings.Contains(contentType, "graphql"):
+		return body, "graphql"
+	}
+	return body, "text"
+}
+
+// ExportCollectionDocs writes index.html and README.md documenting the
+// collection to dir.
+func ExportCollectionDocs(repos *repositories.Repositories, collectionId int, dir string) error {
+	docs, err := BuildCollectionDocs(repos, collectionId)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating docs directory: %v", err)
+	}
+
+	outputs := []struct {
+		name   string
+		render func(io.Writer, CollectionDocs) error
+	}{
+		{"index.html", RenderDocsHTML},
+		{"README.md", RenderDocsMarkdown},
+	}
+	for _, output := range outputs {
+		var content bytes.Buffer
+		if err := output.render(&content, docs); err != nil {
+			return fmt.Errorf("error rendering %s: %v", output.name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, output.name), content.Bytes(), 0644); err != nil {
+			return fmt.Errorf("error writing %s: %v", output.name, err)
+		}
+	}
+	return nil
+}
+
+func RenderDocsMarkdown(w io.Writer, docs CollectionDocs) error {
+	var out strings.Builder
+	fmt.Fprintf(&out, "# %s\n\n", docs.Name)
+	fmt.Fprintf(&out, "_Generated by Posto on %s._\n\n", docs.GeneratedAt.Format("2006-01-02 15:04"))
+	if description := strings.TrimSpace(docs.Description); description != "" {
+		fmt.Fprintf(&out, "%s\n\n", description)
+	}
+
+	if len(docs.Sections) > 0 {
+		out.WriteString("## Contents\n\n")
+		writeMarkdownContents(&out, docs.Sections)
+		out.WriteString("\n")
+	}
+	for _, section := range docs.Sections {
+		writeMarkdownSection(&out, section)
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func writeMarkdownContents(out *strings.Builder, sections []*DocSection) {
+	for _, section := range sections {
+		indent := strings.Repeat("  ", section.Depth-1)
+		fmt.Fprintf(out, "%s- [%s](#%s)\n", indent, markdownEscape(sectionTitle(section)), section.Anchor)
+		writeMarkdownContents(out, section.Children)
+	}
+}
+
+func writeMarkdownSection(out *strings.Builder, section *DocSection) {
+	level := min(section.Depth+1, 6)
+	fmt.Fprintf(out, "<a id=\"%s\"></a>\n\n%s %s\n\n", section.Anchor, strings.Repeat("#", level), markdownEscape(sectionTitle(section)))
+	// descriptions are Markdown already and written as they are
+	if section.Description != "" {
+		fmt.Fprintf(out, "%s\n\n", section.Description)
+	}
+
+	if section.IsFolder {
+		for _, child := range section.Children {
+			writeMarkdownSection(out, child)
+		}
+		return
+	}
+
+	fmt.Fprintf(out, "```\n%s %s\n```\n\n", section.Method, section.Url)
+	writeMarkdownHeaders(out, section.Headers)
+	if section.Body != "" {
+		out.WriteString("**Body**\n\n")
+		writeMarkdownCode(out, section.Body, section.BodyLanguage)
+	}
+	if len(section.Examples) > 0 {
+		out.WriteString("**Examples**\n\n")
+		for _, example := range section.Examples {
+			fmt.Fprintf(out, "_%s_ &mdash; `%d %s`", markdownEscape(example.Name), example.StatusCode, example.StatusText)
+			if example.ContentType != "" {
+				fmt.Fprintf(out, " `%s`", example.ContentType)
+			}
+			out.WriteString("\n\n")
+			writeMarkdownHeaders(out, example.Headers)
+			if example.IsBinary {
+				out.WriteString("Binary response body.\n\n")
+			} else if example.Body != "" {
+				writeMarkdownCode(out, example.Body, example.BodyLanguage)
+			}
+		}
+	}
+}
+
+func writeMarkdownHeaders(out *strings.Builder, headers []DocHeader) {
+	if len(headers) == 0 {
+		return
+	}
+	out.WriteString("| Header | Value |\n| --- | --- |\n")
+	for _, header := range headers {
+		fmt.Fprintf(out, "| %s | %s |\n", markdownCell(header.Name), markdownCell(header.Value))
+	}
+	out.WriteString("\n")
+}
+
+// writeMarkdownCode writes a fenced code block whose fence is longer than
+// any backtick run in the code.
+func writeMarkdownCode(out *strings.Builder, code string, language string) {
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(out, "%s%s\n%s\n%s\n\n", fence, language, code, fence)
+}
+
+func sectionTitle(section *DocSection) string {
+	if section.IsFolder {
+		return section.Name
+	}
+	return section.Method + " " + section.Name
+}
+
+var markdownSpecial = regexp.MustCompile("([\\\\`*_\\[\\]<>#|])")
+
+func markdownEscape(text string) string {
+	return markdownSpecial.ReplaceAllString(text, `\$1`)
+}
+
+func markdownCell(text string) string {
+	text = strings.ReplaceAll(text, "\n", " ")
+	return "`" + strings.ReplaceAll(text, "|", `\|`) + "`"
+}
+
+func RenderDocsHTML(w io.Writer, docs CollectionDocs) error {
+	return htmlDocsTemplate.Execute(w, docs)
+}
+
+var htmlDocsTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{
+	"title":       sectionTitle,
+	"methodClass": func(method string) string { return strings.ToLower(method) },
+}).Parse(`{{define "nav"}}<ul>{{range .}}
+<li>{{if .IsFolder}}<a class="folder" href="#{{.Anchor}}">{{.Name}}</a>{{template "nav" .Children}}{{else}}<a href="#{{.Anchor}}"><span class="method {{methodClass .Method}}">{{.Method}}</span> {{.Name}}</a>{{end}}</li>{{end}}
+</ul>{{end}}
+{{define "headers"}}{{if .}}<table>
+<tr><th>Header</th><th>Value</th></tr>
+{{range .}}<tr><td><code>{{.Name}}</code></td><td><code>{{.Value}}</code></td></tr>
+{{end}}</table>{{end}}{{end}}
+{{define "section"}}{{if .IsFolder}}<section class="folder" id="{{.Anchor}}">
+<h2>{{.Name}}</h2>
+{{if .Description}}<div class="description">{{.Description}}</div>{{end}}
+{{range .Children}}{{template "section" .}}{{end}}
+</section>{{else}}<section class="request" id="{{.Anchor}}">
+<h3><span class="method {{methodClass .Method}}">{{.Method}}</span> {{.Name}}</h3>
+{{if .Path}}<div class="meta">{{range $i, $p := .Path}}{{if $i}} / {{end}}{{$p}}{{end}}</div>{{end}}
+{{if .Description}}<div class="description">{{.Description}}</div>{{end}}
+<pre class="url">{{.Method}} {{.Url}}</pre>
+{{template "headers" .Headers}}
+{{if .Body}}<h4>Body</h4>
+<pre>{{.Body}}</pre>{{end}}
+{{if .Examples}}<h4>Examples</h4>
+{{range .Examples}}<div class="example">
+<div><strong>{{.Name}}</strong> <span class="status s{{.StatusCode}}">{{.StatusCode}} {{.StatusText}}</span> <span class="meta">{{.ContentType}}</span></div>
+{{template "headers" .Headers}}
+{{if .IsBinary}}<div class="meta">Binary response body.</div>{{else if .Body}}<pre>{{.Body}}</pre>{{end}}
+</div>{{end}}{{end}}
+</section>{{end}}{{end}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} - API documentation</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Roboto, sans-serif; margin: 0; background: #1b2636; color: #e6e6e6; display: flex; }
+nav { width: 280px; flex-shrink: 0; height: 100vh; overflow-y: auto; position: sticky; top: 0; border-right: 1px solid #334; padding: 1rem; box-sizing: border-box; font-size: .85rem; }
+nav ul { list-style: none; padding-left: .75rem; margin: 0; }
+nav > ul { padding-left: 0; }
+nav li { margin: .2rem 0; }
+nav a { color: #e6e6e6; text-decoration: none; }
+nav a.folder { font-weight: bold; }
+main { flex: 1; padding: 2rem; max-width: 960px; }
+h1 { font-size: 1.6rem; margin-top: 0; }
+h2 { font-size: 1.3rem; border-bottom: 1px solid #334; padding-bottom: .25rem; margin-top: 2rem; }
+h3 { font-size: 1.1rem; }
+h4 { font-size: .9rem; color: #aab; margin-bottom: .25rem; }
+.request { border: 1px solid #334; border-radius: 6px; margin: 1rem 0; padding: .75rem 1rem; }
+.example { border-left: 3px solid #334; padding-left: .75rem; margin: .75rem 0; }
+.meta { color: #aab; font-size: .85rem; }
+.description { white-space: pre-wrap; margin: .5rem 0; line-height: 1.4; }
+.method { font-weight: bold; font-size: .8em; display: inline-block; min-width: 3.5rem; }
+.get { color: #3fb950; } .post { color: #d29922; } .put { color: #58a6ff; } .patch { color: #a371f7; } .delete { color: #f85149; }
+.status { font-size: .85rem; padding: 0 .4rem; border-radius: 4px; background: #334; }
+pre { background: #111a26; padding: .75rem; border-radius: 4px; overflow-x: auto; font-size: .85rem; }
+pre.url { white-space: pre-wrap; word-break: break-all; }
+table { border-collapse: collapse; font-size: .85rem; margin: .5rem 0; }
+td, th { text-align: left; padding: .2rem .75rem .2rem 0; vertical-align: top; }
+</style>
+</head>
+<body>
+<nav>
+<strong>{{.Name}}</strong>
+{{template "nav" .Sections}}
+</nav>
+<main>
+<h1>{{.Name}}</h1>
+<div class="meta">Generated by Posto on {{.GeneratedAt.Format "2006-01-02 15:04"}}</div>
+{{if .Description}}<div class="description">{{.Description}}</div>{{end}}
+{{range .Sections}}{{template "section" .}}{{end}}
+</main>
+</body>
+</html>
+`))
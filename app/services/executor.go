@@ -0,0 +1,339 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"posto/app/config"
+	"posto/app/models"
+	"posto/app/repositories"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RequestError describes at which stage executing a request failed. Message
+// is meant for the user, Err carries the underlying cause if any.
+type RequestError struct {
+	Message string
+	Err     error
+}
+
+func (e *RequestError) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Executor sends stored requests over HTTP. It is shared by the GUI, the
+// collection runner and the CLI so every entry point behaves the same.
+type Executor struct {
+	mu     sync.RWMutex
+	Client *http.Client
+	// DefaultHeaders are sent with every request that does not set them.
+	DefaultHeaders map[string]string
+	// MemoryLimit is the size above which response bodies are written to
+	// one of Bodies.
+	MemoryLimit int64
+	Bodies      *ResponseBodies
+}
+
+func NewExecutor(timeout time.Duration) *Executor {
+	return &Executor{
+		Client:      &http.Client{Timeout: timeout},
+		MemoryLimit: config.DefaultResponseMemoryLimit,
+		Bodies:      NewResponseBodies(),
+	}
+}
+
+// Configure applies the timeout, proxy, TLS, default headers and response
+// memory limit of settings to the requests sent from now on.
+func (e *Executor) Configure(settings models.Settings) error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if settings.Proxy != "" {
+		proxy, err := url.Parse(settings.Proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: settings.TLS.InsecureSkipVerify}
+	if settings.TLS.CACertFile != "" {
+		content, err := os.ReadFile(config.ExpandPath(settings.TLS.CACertFile))
+		if err != nil {
+			return fmt.Errorf("error reading CA certificates: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(content) {
+			return fmt.Errorf("no certificate found in %s", settings.TLS.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if settings.TLS.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.ExpandPath(settings.TLS.ClientCertFile), config.ExpandPath(settings.TLS.ClientKeyFile))
+		if err != nil {
+			return fmt.Errorf("error loading client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Client = &http.Client{
+		Timeout:   time.Duration(settings.RequestTimeoutSeconds) * time.Second,
+		Transport: transport,
+	}
+	e.DefaultHeaders = settings.DefaultHeaders
+	e.MemoryLimit = int64(settings.ResponseMemoryLimitMB) << 20
+	return nil
+}
+
+// SetTimeout overrides the timeout of the settings, down to the
+// millisecond, until Configure is called again.
+func (e *Executor) SetTimeout(timeout time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	client := *e.Client
+	client.Timeout = timeout
+	e.Client = &client
+}
+
+// client returns the client and default headers, which Configure may
+// replace while requests are sent.
+func (e *Executor) client() (*http.Client, map[string]string) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.Client, e.DefaultHeaders
+}
+
+func (e *Executor) memoryLimit() int64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.MemoryLimit
+}
+
+// BuildRequest turns stored request data into an *http.Request, resolving
+// {{variables}} in the url, headers and body.
+func BuildRequest(data repositories.FileRequestData, vars map[string]string) (*http.Request, error) {
+	url := ""
+	if data.Url != nil {
+		url = ResolveVariables(strings.TrimSpace(*data.Url), vars)
+	}
+	if url == "" {
+		return nil, &RequestError{Message: "URL is empty"}
+	}
+
+	method := "GET"
+	if data.Method != nil && *data.Method != "" {
+		method = strings.ToUpper(*data.Method)
+	}
+
+	// Build the request body (for non-GET requests).
+	var bodyReader io.Reader
+	if method != "GET" && data.Body != nil && *data.Body != "" {
+		bodyReader = strings.NewReader(ResolveVariables(*data.Body, vars))
+	}
+
+	req, err := http.NewRequest(method, url, bodyReader)
+	if err != nil {
+		return nil, &RequestError{Message: "Failed to build HTTP request", Err: err}
+	}
+
+	// Apply stored headers.
+	req.Header.Set("Content-Type", "application/json")
+	if data.Headers != nil && *data.Headers != "" {
+		var headers map[string]string
+		if jsonErr := json.Unmarshal([]byte(*data.Headers), &headers); jsonErr == nil {
+			for k, v := range headers {
+				req.Header.Set(ResolveVariables(k, vars), ResolveVariables(v, vars))
+			}
+		}
+	}
+
+	return req, nil
+}
+
+// SentRequest describes a request as it was handed to the HTTP client,
+// after variables were resolved.
+type SentRequest struct {
+	Method  string            `json:"method"`
+	Url     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+func describeRequest(req *http.Request) SentRequest {
+	sent := SentRequest{
+		Method:  req.Method,
+		Url:     req.URL.String(),
+		Headers: flattenHeaders(req.Header),
+	}
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			content, _ := io.ReadAll(body)
+			sent.Body = string(content)
+		}
+	}
+	return sent
+}
+
+// Execute builds and sends the request and reads the full response.
+func (e *Executor) Execute(data repositories.FileRequestData, vars map[string]string) (models.HttpResponse, error) {
+	_, resp, err := e.Send(data, vars)
+	return resp, err
+}
+
+// Send is Execute that also reports the request that was sent, which is
+// zero valued when the request could not be built.
+func (e *Executor) Send(data repositories.FileRequestData, vars map[string]string) (SentRequest, models.HttpResponse, error) {
+	return e.SendWith(data, vars, SendOptions{})
+}
+
+type SendOptions struct {
+	// Secrets are the values of the secret variables in vars. They are
+	// replaced by SecretMask in the request reported, the wire exchanges,
+	// the error and the log, so that they are never stored in clear.
+	Secrets []string
+	// Progress is called while the response body is received.
+	Progress ProgressFunc
+}
+
+// SendWith is Send with options.
+func (e *Executor) SendWith(data repositories.FileRequestData, vars map[string]string, options SendOptions) (SentRequest, models.HttpResponse, error) {
+	req, err := BuildRequest(data, vars)
+	if err != nil {
+		return SentRequest{}, models.HttpResponse{}, err
+	}
+	_, defaultHeaders := e.client()
+	for k, v := range defaultHeaders {
+		if req.Header.Get(k) == "" {
+			req.Header.Set(k, ResolveVariables(v, vars))
+		}
+	}
+	sent := maskSentRequest(describeRequest(req), options.Secrets)
+	resp, err := e.Do(req, options.Progress)
+	resp.Wire = maskWire(resp.Wire, options.Secrets)
+	err = maskError(err, options.Secrets)
+	logRequest(sent, resp, err)
+	return sent, resp, err
+}
+
+// maxLoggedBody is the number of bytes of a body written in debug records.
+const maxLoggedBody = 16 << 10
+
+// logRequest writes a debug record of a request and its response.
+func logRequest(sent SentRequest, resp models.HttpResponse, err error) {
+	if !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	request := slog.Group("request", "headers", sent.Headers, "body", loggedBody(sent.Body))
+	if err != nil {
+		slog.Debug("Request failed", "method", sent.Method, "url", sent.Url, request, "error", err)
+		return
+	}
+	body := loggedBody(resp.Body)
+	if resp.IsBinary {
+		body = fmt.Sprintf("(%d bytes of binary data)", resp.Size)
+	}
+	slog.Debug("Request sent", "method", sent.Method, "url", sent.Url,
+		"status", resp.StatusCode, "duration_ms", resp.DurationMs, request,
+		slog.Group("response", "headers", resp.Headers, "body", body))
+}
+
+func loggedBody(body string) string {
+	if len(body) <= maxLoggedBody {
+		return body
+	}
+	return fmt.Sprintf("%s… (%d bytes)", body[:maxLoggedBody], len(body))
+}
+
+// Do sends an already built request and converts the response into an
+// HttpResponse. The wire exchanges are returned even when it fails. A body
+// larger than the memory limit is streamed to a file and truncated, see
+// HttpResponse.Truncated. progress may be nil.
+func (e *Executor) Do(req *http.Request, progress ProgressFunc) (models.HttpResponse, error) {
+	configured, _ := e.client()
+	wire := newWireTransport(configured.Transport)
+	client := *configured
+	client.Transport = wire
+
+	start := time.Now()
+	httpResp, err := client.Do(req)
+	if err != nil {
+		return models.HttpResponse{Wire: wire.Exchanges()}, &RequestError{Message: "HTTP request failed", Err: err}
+	}
+	defer httpResp.Body.Close()
+
+	bodyBytes, size, bodyId, err := readBody(httpResp, e.memoryLimit(), e.Bodies, progress)
+	if err != nil {
+		return models.HttpResponse{Wire: wire.Exchanges()}, &RequestError{Message: "Failed to read response body", Err: err}
+	}
+
+	contentType := httpResp.Header.Get("Content-Type")
+
+	httpResult := models.HttpResponse{
+		StatusCode:  httpResp.StatusCode,
+		ContentType: contentType,
+		Headers:     flattenHeaders(httpResp.Header),
+		DurationMs:  time.Since(start).Milliseconds(),
+		Size:        size,
+		Truncated:   bodyId != "",
+		BodyId:      bodyId,
+		Wire:        wire.Exchanges(),
+	}
+
+	// Treat JSON and text responses as plain strings; everything else as base64.
+	isText := IsTextContentType(contentType)
+	if httpResult.Truncated && isText {
+		bodyBytes, isText = textPreview(bodyBytes)
+	}
+	if isText {
+		httpResult.Body = string(bodyBytes)
+		httpResult.IsBinary = false
+	} else {
+		httpResult.Body = base64.StdEncoding.EncodeToString(bodyBytes)
+		httpResult.IsBinary = true
+	}
+
+	return httpResult, nil
+}
+
+func IsTextContentType(contentType string) bool {
+	return strings.Contains(contentType, "application/json") || strings.Contains(contentType, "text/")
+}
+
+// flattenHeaders joins repeated header values with ", " as allowed by RFC 9110.
+func flattenHeaders(header http.Header) map[string]string {
+	headers := map[string]string{}
+	for k, v := range header {
+		headers[k] = strings.Join(v, ", ")
+	}
+	return headers
+}
+
+// marshalStringMap encodes headers the way they are stored on the file row.
+func marshalStringMap(m map[string]string) (string, error) {
+	if m == nil {
+		m = map[string]string{}
+	}
+	encoded, err := json.Marshal(m)
+	return string(encoded), err
+}
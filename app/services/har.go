@@ -0,0 +1,406 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"posto/app/models"
+	"posto/app/redact"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HAR 1.2, see http://www.softwareishard.com/blog/har-12-spec/
+
+type Har struct {
+	Log HarLog `json:"log"`
+}
+
+type HarLog struct {
+	Version string     `json:"version"`
+	Creator HarCreator `json:"creator"`
+	Entries []HarEntry `json:"entries"`
+}
+
+type HarCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HarEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HarRequest  `json:"request"`
+	Response        HarResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HarTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type HarRequest struct {
+	Method      string         `json:"method"`
+	Url         string         `json:"url"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []HarCookie    `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	QueryString []HarNameValue `json:"queryString"`
+	PostData    *HarPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HarResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []HarCookie    `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	Content     HarContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HarNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HarCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HarPostData struct {
+	MimeType string         `json:"mimeType"`
+	Text     string         `json:"text"`
+	Params   []HarNameValue `json:"params,omitempty"`
+}
+
+type HarContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type HarTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+func ReadHar(path string) (Har, error) {
+	var har Har
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return har, fmt.Errorf("error reading HAR file: %v", err)
+	}
+	// devtools exports may start with a BOM
+	content = []byte(strings.TrimPrefix(string(content), "\ufeff"))
+	if err := json.Unmarshal(content, &har); err != nil {
+		return har, fmt.Errorf("error parsing HAR file: %v", err)
+	}
+	return har, nil
+}
+
+func WriteHar(path string, har Har) error {
+	content, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("error writing HAR file: %v", err)
+	}
+	return nil
+}
+
+func newHar(entries []HarEntry) Har {
+	return Har{Log: HarLog{
+		Version: "1.2",
+		Creator: HarCreator{Name: "Posto", Version: "1.0.0"},
+		Entries: entries,
+	}}
+}
+
+// HarImporter turns every HAR entry into a request.
+type HarImporter struct {
+	CollectionName string `json:"collection_name"`
+	// GroupByHost puts the requests of every host into their own folder.
+	GroupByHost bool `json:"group_by_host"`
+	// SaveResponses keeps recorded responses as examples of the requests.
+	SaveResponses bool `json:"save_responses"`
+}
+
+func (h *HarImporter) Format() string {
+	return "har"
+}
+
+func (h *HarImporter) Parse(path string, report *ImportReport) ([]CollectionBundle, error) {
+	har, err := ReadHar(path)
+	if err != nil {
+		return nil, err
+	}
+
+	name := h.CollectionName
+	if name == "" {
+		name = "HAR import " + time.Now().Format("2006-01-02 15:04")
+	}
+	bundle := CollectionBundle{Name: name, Items: []BundleItem{}}
+
+	folders := map[string]int{}
+	for i, entry := range har.Log.Entries {
+		parsed, err := url.Parse(entry.Request.Url)
+		if err != nil {
+			report.Warn("entry %d skipped, invalid url %q", i, entry.Request.Url)
+			continue
+		}
+
+		item := h.requestItem(entry, parsed, report)
+		if !h.GroupByHost {
+			bundle.Items = append(bundle.Items, item)
+			continue
+		}
+
+		idx, ok := folders[parsed.Host]
+		if !ok {
+			idx = len(bundle.Items)
+			folders[parsed.Host] = idx
+			bundle.Items = append(bundle.Items, BundleItem{Name: parsed.Host, IsFolder: true, Items: []BundleItem{}})
+		}
+		bundle.Items[idx].Items = append(bundle.Items[idx].Items, item)
+	}
+
+	return []CollectionBundle{bundle}, nil
+}
+
+func (h *HarImporter) requestItem(entry HarEntry, parsed *url.URL, report *ImportReport) BundleItem {
+	name := entry.Request.Method + " " + parsed.Path
+	if !h.GroupByHost {
+		name = entry.Request.Method + " " + parsed.Host + parsed.Path
+	}
+
+	headers := map[string]string{}
+	for _, header := range entry.Request.Headers {
+		switch {
+		case strings.HasPrefix(header.Name, ":"):
+			// HTTP/2 pseudo headers
+			continue
+		case http.CanonicalHeaderKey(header.Name) == "Content-Length", http.CanonicalHeaderKey(header.Name) == "Host":
+			continue
+		}
+		if existing, ok := headers[header.Name]; ok {
+			headers[header.Name] = existing + ", " + header.Value
+		} else {
+			headers[header.Name] = header.Value
+		}
+	}
+	headersJson, _ := marshalStringMap(headers)
+
+	method, rawUrl := entry.Request.Method, entry.Request.Url
+	item := BundleItem{Name: name, Method: &method, Url: &rawUrl, Headers: &headersJson}
+	if entry.Request.PostData != nil {
+		body := entry.Request.PostData.Text
+		if body == "" && len(entry.Request.PostData.Params) > 0 {
+			values := url.Values{}
+			for _, param := range entry.Request.PostData.Params {
+				values.Add(param.Name, param.Value)
+			}
+			body = values.Encode()
+			report.Warn("%q: form params were converted to an urlencoded body", name)
+		}
+		if body != "" {
+			item.Body = &body
+		}
+	}
+
+	if h.SaveResponses && entry.Response.Status > 0 {
+		item.Examples = []models.Example{harResponseExample(entry.Response)}
+	}
+	return item
+}
+
+func harResponseExample(response HarResponse) models.Example {
+	headers := map[string]string{}
+	for _, header := range response.Headers {
+		if http.CanonicalHeaderKey(header.Name) == "Content-Encoding" {
+			// HAR content is always stored decoded
+			continue
+		}
+		headers[header.Name] = header.Value
+	}
+
+	example := models.Example{
+		Name:        fmt.Sprintf("%d %s", response.Status, response.StatusText),
+		StatusCode:  response.Status,
+		ContentType: response.Content.MimeType,
+		Headers:     headers,
+		Body:        response.Content.Text,
+	}
+	if response.Content.Encoding == "base64" {
+		if IsTextContentType(response.Content.MimeType) {
+			decoded, err := base64.StdEncoding.DecodeString(response.Content.Text)
+			if err == nil {
+				example.Body = string(decoded)
+			}
+		} else {
+			example.IsBinary = true
+		}
+	}
+	return example
+}
+
+// HistoryToHar converts history rows, oldest first, into a HAR document.
+func HistoryToHar(entries []models.HistoryEntry) Har {
+	sorted := append([]models.HistoryEntry{}, entries...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].PkHistoryId < sorted[j].PkHistoryId
+	})
+
+	harEntries := []HarEntry{}
+	for _, entry := range sorted {
+		resp := models.HttpResponse{
+			StatusCode:  entry.StatusCode,
+			ContentType: entry.ContentType,
+			Headers:     entry.ResponseHeaders,
+			Body:        entry.ResponseBody,
+			IsBinary:    entry.IsBinary,
+			Truncated:   entry.Truncated,
+			DurationMs:  entry.DurationMs,
+		}
+		sent := SentRequest{Method: entry.Method, Url: entry.Url, Headers: entry.RequestHeaders, Body: entry.RequestBody}
+		harEntry := newHarEntry(entry.CreatedAt, sent, resp)
+		harEntry.Comment = redact.Exports().Url(entry.Error)
+		harEntries = append(harEntries, harEntry)
+	}
+	return newHar(harEntries)
+}
+
+// RunResultToHar converts the requests of a collection run into a HAR
+// document. Requests that could not be built are left out.
+func RunResultToHar(result RunResult) Har {
+	harEntries := []HarEntry{}
+	for _, request := range result.Requests {
+		if request.Request == nil {
+			continue
+		}
+		resp := models.HttpResponse{DurationMs: request.DurationMs}
+		if request.Response != nil {
+			resp = *request.Response
+		}
+		harEntry := newHarEntry(request.StartedAt, *request.Request, resp)
+		harEntry.Comment = request.FullName()
+		if request.Error != "" {
+			harEntry.Comment += ": " + redact.Exports().Url(request.Error)
+		}
+		harEntries = append(harEntries, harEntry)
+	}
+	return newHar(harEntries)
+}
+
+// newHarEntry redacts with the exports policy, HAR files are only written
+// to leave the app.
+func newHarEntry(startedAt time.Time, sent SentRequest, resp models.HttpResponse) HarEntry {
+	policy := redact.Exports()
+	sent = redactSentRequest(policy, sent)
+	resp = redactResponse(policy, resp)
+	request := HarRequest{
+		Method:      sent.Method,
+		Url:         sent.Url,
+		HttpVersion: "HTTP/1.1",
+		Cookies:     []HarCookie{},
+		Headers:     harHeaders(sent.Headers),
+		QueryString: []HarNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(sent.Body),
+	}
+	if parsed, err := url.Parse(sent.Url); err == nil {
+		for name, values := range parsed.Query() {
+			for _, value := range values {
+				request.QueryString = append(request.QueryString, HarNameValue{Name: name, Value: value})
+			}
+		}
+		sort.Slice(request.QueryString, func(i, j int) bool {
+			return request.QueryString[i].Name < request.QueryString[j].Name
+		})
+	}
+	if sent.Body != "" {
+		mimeType := ""
+		for k, v := range sent.Headers {
+			if http.CanonicalHeaderKey(k) == "Content-Type" {
+				mimeType = v
+			}
+		}
+		request.PostData = &HarPostData{MimeType: mimeType, Text: sent.Body}
+	}
+
+	response := HarResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HttpVersion: "HTTP/1.1",
+		Cookies:     []HarCookie{},
+		Headers:     harHeaders(resp.Headers),
+		Content: HarContent{
+			Size:     int(resp.Size),
+			MimeType: resp.ContentType,
+			Text:     resp.Body,
+		},
+		HeadersSize: -1,
+		BodySize:    int(resp.Size),
+	}
+	if resp.IsBinary {
+		response.Content.Encoding = "base64"
+	}
+	if resp.Truncated {
+		response.Content.Comment = harTruncatedComment
+	}
+	if response.Content.Size == 0 && resp.Body != "" && !resp.IsBinary {
+		response.Content.Size = len(resp.Body)
+		response.BodySize = len(resp.Body)
+	}
+	for k, v := range resp.Headers {
+		if http.CanonicalHeaderKey(k) == "Location" {
+			response.RedirectURL = v
+		}
+	}
+
+	// only the total duration is measured, it is reported as waiting time
+	return HarEntry{
+		StartedDateTime: startedAt.Format(time.RFC3339Nano),
+		Time:            float64(resp.DurationMs),
+		Request:         request,
+		Response:        response,
+		Timings: HarTimings{
+			Blocked: -1,
+			DNS:     -1,
+			Connect: -1,
+			Send:    0,
+			Wait:    float64(resp.DurationMs),
+			Receive: 0,
+			SSL:     -1,
+		},
+	}
+}
+
+// harTruncatedComment marks content of which only the start was kept.
+const harTruncatedComment = "truncated, the body exceeded the response memory limit"
+
+func harHeaders(headers map[string]string) []HarNameValue {
+	values := []HarNameValue{}
+	for k, v := range headers {
+		values = append(values, HarNameValue{Name: k, Value: v})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Name < values[j].Name
+	})
+	return values
+}
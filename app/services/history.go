@@ -0,0 +1,47 @@
+package services
+
+import (
+	"errors"
+	"posto/app/models"
+	"posto/app/redact"
+)
+
+// NewHistoryEntry builds the history row of a request sent from the app.
+// sent may be zero valued when the request could not be built. Sensitive
+// values are redacted when the history redaction scope is on.
+func NewHistoryEntry(fileId *int64, sent SentRequest, resp models.HttpResponse, err error) models.HistoryEntry {
+	entry := models.HistoryEntry{
+		FileId:          fileId,
+		Method:          sent.Method,
+		Url:             sent.Url,
+		RequestHeaders:  sent.Headers,
+		RequestBody:     sent.Body,
+		StatusCode:      resp.StatusCode,
+		ContentType:     resp.ContentType,
+		ResponseHeaders: resp.Headers,
+		ResponseBody:    resp.Body,
+		IsBinary:        resp.IsBinary,
+		Truncated:       resp.Truncated,
+		DurationMs:      resp.DurationMs,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		var reqErr *RequestError
+		if errors.As(err, &reqErr) && reqErr.Err != nil {
+			entry.Error = reqErr.Err.Error()
+		}
+	}
+
+	if policy := redact.History(); policy != nil {
+		entry.Url = policy.Url(entry.Url)
+		entry.RequestHeaders = policy.Headers(entry.RequestHeaders)
+		entry.RequestBody = policy.Body(entry.RequestBody)
+		entry.ResponseHeaders = policy.Headers(entry.ResponseHeaders)
+		if !entry.IsBinary {
+			entry.ResponseBody = policy.Body(entry.ResponseBody)
+		}
+		// errors may quote the URL
+		entry.Error = policy.Url(entry.Error)
+	}
+	return entry
+}
@@ -0,0 +1,390 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"posto/app/models"
+	"posto/app/redact"
+	"posto/app/repositories"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// HttpFileImporter reads .http / .rest files as used by VS Code's REST
+// Client. File level @variables become an environment named after the file.
+type HttpFileImporter struct{}
+
+func (h *HttpFileImporter) Format() string {
+	return "http"
+}
+
+var (
+	httpFileVariablePattern   = regexp.MustCompile(`^@([A-Za-z0-9_\-]+)\s*=\s*(.*)$`)
+	httpFileAnnotationPattern = regexp.MustCompile(`^(?:#|//)\s*@([A-Za-z\-]+)\s*(.*)$`)
+	httpFileRequestLine       = regexp.MustCompile(`(?i)^(GET|POST|PUT|PATCH|DELETE|HEAD|OPTIONS|CONNECT|TRACE)\s+(.+?)(?:\s+HTTP/[0-9.]+)?$`)
+	httpFileRequestVariable   = regexp.MustCompile(`\{\{\s*[A-Za-z0-9_\-]+\.(?:request|response)\.[^}]*\}\}`)
+	httpFileSystemVariable    = regexp.MustCompile(`\{\{\s*\$[^}]*\}\}`)
+)
+
+func (h *HttpFileImporter) Parse(path string, report *ImportReport) ([]CollectionBundle, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	items, variables := ParseHttpFile(string(content), filepath.Dir(path), report)
+
+	bundle := CollectionBundle{Name: name, Items: items}
+	if len(variables) > 0 {
+		bundle.Environments = []models.Environment{{Name: name, Variables: variables}}
+	}
+	return []CollectionBundle{bundle}, nil
+}
+
+// ParseHttpFile parses the requests of a .http file. dir is used to resolve
+// `< ./body.json` file references. The ### title names the request, a
+// "Folder/Request" title puts it in folders the way ExportHttpFile writes
+// them, with "/" in names escaped as "\/". Without a title the request is
+// named by its @name. Body lines starting with ### are escaped with a
+// backslash, see escapeHttpFileBody.
+func ParseHttpFile(content string, dir string, report *ImportReport) ([]BundleItem, []models.Variable) {
+	items := []BundleItem{}
+	variables := []models.Variable{}
+
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	sections := [][]string{}
+	separatorNames := []string{}
+	current := []string{}
+	currentName := ""
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "###") {
+			sections = append(sections, current)
+			separatorNames = append(separatorNames, currentName)
+			current = []string{}
+			currentName = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "###"))
+			continue
+		}
+		current = append(current, line)
+	}
+	sections = append(sections, current)
+	separatorNames = append(separatorNames, currentName)
+
+	count := 0
+	for i, section := range sections {
+		folders, title := httpFileTitle(separatorNames[i])
+		item, sectionVars, ok := parseHttpFileSection(section, title, dir, report)
+		variables = append(variables, sectionVars...)
+		if ok {
+			count++
+			if item.Name == "" {
+				item.Name = fmt.Sprintf("Request %d", count)
+			}
+			items = addHttpFileItem(items, folders, item)
+		}
+	}
+	return items, variables
+}
+
+// httpFileTitle splits a ### title into its folder names and the request
+// name on the "/" that are not escaped. Titles that look like a request
+// line, e.g. "GET /users", or have empty segments are kept whole.
+func httpFileTitle(title string) ([]string, string) {
+	segments := []string{}
+	var segment strings.Builder
+	for i := 0; i < len(title); i++ {
+		switch {
+		case title[i] == '\\' && i+1 < len(title) && (title[i+1] == '/' || title[i+1] == '\\'):
+			i++
+			segment.WriteByte(title[i])
+		case title[i] == '/':
+			segments = append(segments, strings.TrimSpace(segment.String()))
+			segment.Reset()
+		default:
+			segment.WriteByte(title[i])
+		}
+	}
+	segments = append(segments, strings.TrimSpace(segment.String()))
+
+	whole := httpFileTitleUnescaper.Replace(title)
+	if len(segments) == 1 || httpFileRequestLine.MatchString(title) {
+		return nil, whole
+	}
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, whole
+		}
+	}
+	return segments[:len(segments)-1], segments[len(segments)-1]
+}
+
+var (
+	httpFileTitleEscaper   = strings.NewReplacer(`\`, `\\`, "/", `\/`)
+	httpFileTitleUnescaper = strings.NewReplacer(`\\`, `\`, `\/`, "/")
+	// httpFileBodySeparator matches body lines that would be read as a ###
+	// separator, and those escaped with backslashes on export.
+	httpFileBodySeparator = regexp.MustCompile(`^(\s*)(\\*)###`)
+)
+
+// escapeHttpFileBody escapes body lines starting with ### with a backslash,
+// and adds one to those already starting with backslashes and ###, so that
+// unescapeHttpFileBodyLine gets them back.
+func escapeHttpFileBody(body string) string {
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		lines[i] = httpFileBodySeparator.ReplaceAllString(line, `${1}\${2}###`)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func unescapeHttpFileBodyLine(line string) string {
+	if match := httpFileBodySeparator.FindStringSubmatchIndex(line); match != nil && match[5] > match[4] {
+		return line[:match[4]] + line[match[4]+1:]
+	}
+	return line
+}
+
+// addHttpFileItem appends item to the folder named by folders, creating the
+// folders that are missing.
+func addHttpFileItem(items []BundleItem, folders []string, item BundleItem) []BundleItem {
+	if len(folders) == 0 {
+		return append(items, item)
+	}
+	for i := range items {
+		if items[i].IsFolder && items[i].Name == folders[0] {
+			items[i].Items = addHttpFileItem(items[i].Items, folders[1:], item)
+			return items
+		}
+	}
+	folder := BundleItem{Name: folders[0], IsFolder: true, Items: []BundleItem{}}
+	folder.Items = addHttpFileItem(folder.Items, folders[1:], item)
+	return append(items, folder)
+}
+
+func parseHttpFileSection(lines []string, separatorName string, dir string, report *ImportReport) (BundleItem, []models.Variable, bool) {
+	item := BundleItem{Name: separatorName}
+	variables := []models.Variable{}
+
+	// 0: before the request line, 1: headers, 2: body
+	state := 0
+	// plain comments above the request line become its description
+	comments := []string{}
+	method, rawUrl := "", ""
+	headers := map[string]string{}
+	bodyLines := []string{}
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch state {
+		case 0:
+			if trimmed == "" {
+				continue
+			}
+			if match := httpFileVariablePattern.FindStringSubmatch(trimmed); match != nil {
+				variables = append(variables, models.Variable{Key: match[1], Value: strings.TrimSpace(match[2]), Enabled: true})
+				continue
+			}
+			if match := httpFileAnnotationPattern.FindStringSubmatch(trimmed); match != nil {
+				switch match[1] {
+				case "name":
+					// the ### title wins, @name only identifies the
+					// request for request variables
+					if item.Name == "" {
+						item.Name = strings.TrimSpace(match[2])
+					}
+				case "prompt":
+					report.Warn("prompt variable %q is not supported", strings.TrimSpace(match[2]))
+				default:
+					report.Warn("annotation @%s is not supported", match[1])
+				}
+				continue
+			}
+			if strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "//") {
+				comment := strings.TrimPrefix(strings.TrimPrefix(trimmed, "#"), "//")
+				comments = append(comments, strings.TrimPrefix(comment, " "))
+				continue
+			}
+			if match := httpFileRequestLine.FindStringSubmatch(trimmed); match != nil {
+				method, rawUrl = strings.ToUpper(match[1]), strings.TrimSpace(match[2])
+			} else {
+				// a bare url is a GET request
+				method, rawUrl = "GET", strings.TrimSuffix(trimmed, " HTTP/1.1")
+			}
+			state = 1
+		case 1:
+			if trimmed == "" {
+				state = 2
+				continue
+			}
+			if strings.HasPrefix(trimmed, "?") || strings.HasPrefix(trimmed, "&") {
+				rawUrl += trimmed
+				continue
+			}
+			if strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "//") {
+				continue
+			}
+			key, value, ok := strings.Cut(trimmed, ":")
+			if !ok {
+				report.Warn("%q: invalid header line %q", item.Name, trimmed)
+				continue
+			}
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		case 2:
+			bodyLines = append(bodyLines, unescapeHttpFileBodyLine(line))
+		}
+	}
+
+	if method == "" {
+		return item, variables, false
+	}
+	if item.Name == "" {
+		item.Name = method + " " + rawUrl
+	}
+
+	body := strings.TrimSpace(strings.Join(bodyLines, "\n"))
+	if strings.HasPrefix(body, "> {%") || strings.Contains(body, "\n> {%") {
+		report.Warn("%q: response handler scripts are not supported and were removed", item.Name)
+		if idx := strings.Index(body, "> {%"); idx >= 0 {
+			body = strings.TrimSpace(body[:idx])
+		}
+	}
+	if strings.HasPrefix(body, "<") && !strings.Contains(body, "\n") {
+		reference := strings.TrimSpace(strings.TrimLeft(strings.TrimPrefix(body, "<"), "@"))
+		if !filepath.IsAbs(reference) {
+			reference = filepath.Join(dir, reference)
+		}
+		content, err := os.ReadFile(reference)
+		if err != nil {
+			report.Warn("%q: body file %s could not be read and was kept as reference", item.Name, reference)
+		} else {
+			body = string(content)
+		}
+	}
+
+	for _, s := range append([]string{rawUrl, body}, mapValues(headers)...) {
+		if httpFileRequestVariable.MatchString(s) {
+			report.Warn("%q: request variables like %s are not supported", item.Name, httpFileRequestVariable.FindString(s))
+		}
+		if httpFileSystemVariable.MatchString(s) {
+			report.Warn("%q: system variables like %s are not supported", item.Name, httpFileSystemVariable.FindString(s))
+		}
+	}
+
+	item.Description = strings.TrimSpace(strings.Join(comments, "\n"))
+	headersJson, _ := marshalStringMap(headers)
+	item.Method = &method
+	item.Url = &rawUrl
+	item.Headers = &headersJson
+	if body != "" {
+		item.Body = &body
+	}
+	return item, variables, true
+}
+
+func mapValues(m map[string]string) []string {
+	values := []string{}
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values
+}
+
+// ExportHttpFile renders every request of a collection as a .http file.
+// Folders are flattened, the folder path is kept in the ### separator. When
+// environment is given its enabled variables are written as @variables,
+// secret variables are left out. Values are redacted with the exports
+// policy.
+func ExportHttpFile(repos *repositories.Repositories, collectionId int, environment *models.Environment) (string, error) {
+	files, err := repos.File.SelectFilesByCollection(collectionId)
+	if err != nil {
+		return "", fmt.Errorf("error loading files: %v", err)
+	}
+
+	policy := redact.Exports()
+	var out strings.Builder
+	if environment != nil {
+		vars := environment.VariableMap()
+		keys := []string{}
+		for key := range vars {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := policy.Text(vars[key])
+			if policy.IsKey(key) && value != "" {
+				value = redact.Marker
+			}
+			fmt.Fprintf(&out, "@%s = %s\n", key, value)
+		}
+		if len(keys) > 0 {
+			out.WriteString("\n")
+		}
+	}
+
+	first := true
+	WalkRequests(BuildFileTree(files), func(node *FileNode) bool {
+		if !first {
+			out.WriteString("\n")
+		}
+		first = false
+		writeHttpFileRequest(&out, node, policy)
+		return true
+	})
+	return out.String(), nil
+}
+
+func writeHttpFileRequest(out *strings.Builder, node *FileNode, policy *redact.Policy) {
+	segments := []string{}
+	for _, name := range append(append([]string{}, node.Path...), node.File.Name) {
+		segments = append(segments, httpFileTitleEscaper.Replace(name))
+	}
+	fmt.Fprintf(out, "### %s\n", strings.Join(segments, "/"))
+	if description := strings.TrimSpace(node.File.Description); description != "" {
+		for _, line := range strings.Split(description, "\n") {
+			fmt.Fprintf(out, "# %s\n", strings.TrimRight(line, " \r"))
+		}
+	}
+	fmt.Fprintf(out, "# @name %s\n", httpFileRequestName(node.File.Name))
+
+	method := "GET"
+	if node.File.Method != nil && *node.File.Method != "" {
+		method = strings.ToUpper(*node.File.Method)
+	}
+	rawUrl := ""
+	if node.File.Url != nil {
+		rawUrl = *node.File.Url
+	}
+	fmt.Fprintf(out, "%s %s\n", method, policy.Url(rawUrl))
+
+	if node.File.Headers != nil && *node.File.Headers != "" {
+		var headers map[string]string
+		if err := json.Unmarshal([]byte(*node.File.Headers), &headers); err == nil {
+			keys := []string{}
+			for key := range headers {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Fprintf(out, "%s: %s\n", key, policy.Header(key, headers[key]))
+			}
+		}
+	}
+
+	if node.File.Body != nil && strings.TrimSpace(*node.File.Body) != "" {
+		fmt.Fprintf(out, "\n%s\n", escapeHttpFileBody(policy.Body(strings.TrimSpace(*node.File.Body))))
+	}
+}
+
+var httpFileNameInvalid = regexp.MustCompile(`[^A-Za-z0-9_\-]+`)
+
+// httpFileRequestName turns a request name into a valid @name identifier.
+func httpFileRequestName(name string) string {
+	cleaned := strings.Trim(httpFileNameInvalid.ReplaceAllString(name, "_"), "_")
+	if cleaned == "" {
+		return "request"
+	}
+	return cleaned
+}
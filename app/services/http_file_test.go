@@ -0,0 +1,212 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"posto/app/db"
+	"posto/app/repositories"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// openTestRepositories returns repositories on a new in memory database.
+func openTestRepositories(t *testing.T) *repositories.Repositories {
+	t.Helper()
+	conn, err := db.OpenDB(":memory:")
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.MigrateDB(conn); err != nil {
+		t.Fatalf("MigrateDB: %v", err)
+	}
+	return repositories.NewRepositories(conn)
+}
+
+// flattenHttpFileItems describes every request of items on one line, with
+// its folder path, so that trees are compared in order.
+func flattenHttpFileItems(t *testing.T, items []BundleItem, path string) []string {
+	t.Helper()
+	lines := []string{}
+	for _, item := range items {
+		if item.IsFolder {
+			lines = append(lines, flattenHttpFileItems(t, item.Items, path+item.Name+"/")...)
+			continue
+		}
+		headers := map[string]string{}
+		if item.Headers != nil && *item.Headers != "" {
+			if err := json.Unmarshal([]byte(*item.Headers), &headers); err != nil {
+				t.Fatalf("headers of %q: %v", item.Name, err)
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s%s | %s %s | %v | %q | %q",
+			path, item.Name, deref(item.Method), deref(item.Url), headers, deref(item.Body), item.Description))
+	}
+	return lines
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func httpFileRequest(name string, method string, url string, headers map[string]string, body string, description string) BundleItem {
+	headersJson, _ := marshalStringMap(headers)
+	item := BundleItem{Name: name, Method: &method, Url: &url, Headers: &headersJson, Description: description}
+	if body != "" {
+		item.Body = &body
+	}
+	return item
+}
+
+func TestParseHttpFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		want      []string
+		variables int
+		warnings  int
+	}{
+		{
+			name:    "title names the request",
+			content: "### Get user\n# @name getUser\nGET https://api.test/users/1\n",
+			want:    []string{`Get user | GET https://api.test/users/1 | map[] | "" | ""`},
+		},
+		{
+			name:    "@name without title",
+			content: "###\n# @name getUser\nGET https://api.test/users/1\n",
+			want:    []string{`getUser | GET https://api.test/users/1 | map[] | "" | ""`},
+		},
+		{
+			name:    "unnamed requests are named by their request line",
+			content: "GET https://api.test/a\n\n###\n\nhttps://api.test/b\n",
+			want: []string{
+				`GET https://api.test/a | GET https://api.test/a | map[] | "" | ""`,
+				`GET https://api.test/b | GET https://api.test/b | map[] | "" | ""`,
+			},
+		},
+		{
+			name:    "title with folders",
+			content: "### Users / Admin/Delete user\ndelete https://api.test/users/1 HTTP/1.1\n\n### Users/List\nget https://api.test/users\n",
+			want: []string{
+				`Users/Admin/Delete user | DELETE https://api.test/users/1 | map[] | "" | ""`,
+				`Users/List | GET https://api.test/users | map[] | "" | ""`,
+			},
+		},
+		{
+			name:    "request line title is not split",
+			content: "### GET /users/{id}\nGET https://api.test/users/1\n",
+			want:    []string{`GET /users/{id} | GET https://api.test/users/1 | map[] | "" | ""`},
+		},
+		{
+			name: "headers, query lines, body and description",
+			content: "@host = https://api.test\n\n### Create\n# Creates a user\n# in two lines\n" +
+				"Post {{host}}/users\n  ?notify=true\n  &dry=false\nContent-Type: application/json\n# comment\n\n" +
+				"{\n  \"name\": \"a\"\n}\n",
+			want: []string{
+				`Create | POST {{host}}/users?notify=true&dry=false | map[Content-Type:application/json] | "{\n  \"name\": \"a\"\n}" | "Creates a user\nin two lines"`,
+			},
+			variables: 1,
+		},
+		{
+			name:     "unsupported features are reported",
+			content:  "### Login\n# @prompt password\nPOST https://api.test/login\nbad header\n\n{\"id\":\"{{$uuid}}\"}\n\n> {% client.global.set(\"token\", response.body.token) %}\n",
+			want:     []string{`Login | POST https://api.test/login | map[] | "{\"id\":\"{{$uuid}}\"}" | ""`},
+			warnings: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := &ImportReport{}
+			items, variables := ParseHttpFile(tt.content, t.TempDir(), report)
+			if got := flattenHttpFileItems(t, items, ""); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requests:\n got %q\nwant %q", got, tt.want)
+			}
+			if len(variables) != tt.variables {
+				t.Errorf("got %d variables, want %d", len(variables), tt.variables)
+			}
+			if len(report.Warnings) != tt.warnings {
+				t.Errorf("got warnings %q, want %d", report.Warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestHttpFileRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []BundleItem
+	}{
+		{
+			name: "flat",
+			items: []BundleItem{
+				httpFileRequest("Get user", "GET", "{{base}}/users/{{id}}?expand=true", map[string]string{"Accept": "application/json"}, "", ""),
+				httpFileRequest("Login", "POST", "{{base}}/login", map[string]string{"Content-Type": "application/json"}, "{\n  \"user\": \"a\"\n}", "Signs in.\n\nReturns a token."),
+			},
+		},
+		{
+			name: "folders",
+			items: []BundleItem{
+				{Name: "Users", IsFolder: true, Items: []BundleItem{
+					{Name: "Admin", IsFolder: true, Items: []BundleItem{
+						httpFileRequest("Delete user", "DELETE", "https://api.test/users/1", map[string]string{}, "", ""),
+					}},
+					httpFileRequest("List users", "GET", "https://api.test/users", map[string]string{}, "", ""),
+				}},
+				httpFileRequest("Health", "HEAD", "https://api.test/health", map[string]string{}, "", ""),
+			},
+		},
+		{
+			name: "slash in names",
+			items: []BundleItem{
+				{Name: "v1/users", IsFolder: true, Items: []BundleItem{
+					httpFileRequest("Get a/b", "GET", "https://api.test/a/b", map[string]string{}, "", ""),
+				}},
+				httpFileRequest(`C:\temp\/`, "GET", "https://api.test/temp", map[string]string{}, "", ""),
+				httpFileRequest("GET /users/{id}", "GET", "https://api.test/users/1", map[string]string{}, "", ""),
+			},
+		},
+		{
+			name: "GET with a body",
+			items: []BundleItem{
+				httpFileRequest("Search", "GET", "https://api.test/search", map[string]string{"Content-Type": "application/json"}, `{"query":"a"}`, ""),
+			},
+		},
+		{
+			name: "separator lines in a body",
+			items: []BundleItem{
+				httpFileRequest("Notes", "POST", "https://api.test/notes", map[string]string{"Content-Type": "text/markdown"}, "### Heading\n  ### indented\n\\### escaped\ntext", ""),
+				httpFileRequest("Other", "GET", "https://api.test/other", map[string]string{}, "", ""),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repos := openTestRepositories(t)
+			collectionId, err := ImportCollectionBundle(repos, CollectionBundle{Name: "Round trip", Items: tt.items})
+			if err != nil {
+				t.Fatalf("ImportCollectionBundle: %v", err)
+			}
+			content, err := ExportHttpFile(repos, collectionId, nil)
+			if err != nil {
+				t.Fatalf("ExportHttpFile: %v", err)
+			}
+
+			report := &ImportReport{}
+			parsed, _ := ParseHttpFile(content, t.TempDir(), report)
+			want := flattenHttpFileItems(t, tt.items, "")
+			if got := flattenHttpFileItems(t, parsed, ""); !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip of\n%s\n got %q\nwant %q", content, got, want)
+			}
+			if len(report.Warnings) > 0 {
+				t.Errorf("unexpected warnings %q", report.Warnings)
+			}
+			if !strings.HasPrefix(content, "### ") {
+				t.Errorf("export does not start with a ### title:\n%s", content)
+			}
+		})
+	}
+}
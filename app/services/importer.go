@@ -0,0 +1,75 @@
+package services
+
+import (
+	"fmt"
+	"posto/app/repositories"
+	"strings"
+)
+
+// Importer converts a third party export into collection bundles, which are
+// then stored like native Posto bundles.
+type Importer interface {
+	// Format is the short name of the source format, e.g. "insomnia".
+	Format() string
+	// Parse reads the export at path. Everything that cannot be converted
+	// losslessly is added as a warning to report.
+	Parse(path string, report *ImportReport) ([]CollectionBundle, error)
+}
+
+// ImportReport summarises an import, including the lossy conversions.
+type ImportReport struct {
+	Format        string   `json:"format"`
+	CollectionIds []int    `json:"collection_ids"`
+	Folders       int      `json:"folders"`
+	Requests      int      `json:"requests"`
+	Environments  int      `json:"environments"`
+	Warnings      []string `json:"warnings"`
+}
+
+func (r *ImportReport) Warn(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Importers lists the importers usable by format name.
+func Importers() []Importer {
+	return []Importer{
+		&HarImporter{},
+		&InsomniaImporter{},
+		&BrunoImporter{},
+		&HttpFileImporter{},
+		&DirectoryImporter{},
+	}
+}
+
+func ImporterFor(format string) (Importer, error) {
+	names := []string{}
+	for _, importer := range Importers() {
+		if importer.Format() == format {
+			return importer, nil
+		}
+		names = append(names, importer.Format())
+	}
+	return nil, fmt.Errorf("unknown import format %q, expected one of %s", format, strings.Join(names, ", "))
+}
+
+// RunImport parses path with the importer and stores every resulting
+// collection. Collections stored before a failure are kept and reported.
+func RunImport(repos *repositories.Repositories, importer Importer, path string) (ImportReport, error) {
+	report := ImportReport{Format: importer.Format(), CollectionIds: []int{}, Warnings: []string{}}
+
+	bundles, err := importer.Parse(path, &report)
+	if err != nil {
+		return report, err
+	}
+
+	for _, bundle := range bundles {
+		collectionId, err := importCollectionBundle(repos, bundle, &report)
+		if collectionId > 0 {
+			report.CollectionIds = append(report.CollectionIds, collectionId)
+		}
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
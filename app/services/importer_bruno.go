@@ -0,0 +1,390 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"posto/app/models"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// BrunoImporter reads a Bruno collection directory: bruno.json, one .bru
+// file per request, sub directories as folders and environments/*.bru.
+type BrunoImporter struct{}
+
+func (b *BrunoImporter) Format() string {
+	return "bruno"
+}
+
+// bruBlock is a top level block of a .bru file such as `get { ... }`.
+type bruBlock struct {
+	name  string
+	lines []string
+}
+
+// dict returns the key: value pairs of a dictionary block, skipping the
+// ones disabled with a leading ~.
+func (b bruBlock) dict() [][2]string {
+	pairs := [][2]string{}
+	for _, line := range b.lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "~") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		pairs = append(pairs, [2]string{strings.TrimSpace(key), strings.TrimSpace(value)})
+	}
+	return pairs
+}
+
+func (b bruBlock) get(key string) string {
+	for _, pair := range b.dict() {
+		if pair[0] == key {
+			return pair[1]
+		}
+	}
+	return ""
+}
+
+// text returns the content of a text block with the indentation removed.
+func (b bruBlock) text() string {
+	lines := make([]string, len(b.lines))
+	for i, line := range b.lines {
+		lines[i] = strings.TrimPrefix(line, "  ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// parseBru splits a .bru file into its blocks. Blocks open with `name {` or
+// `name [` and close with `}` or `]` at the start of a line.
+func parseBru(content string) []bruBlock {
+	blocks := []bruBlock{}
+	var current *bruBlock
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if current == nil {
+			trimmed := strings.TrimSpace(line)
+			if strings.HasSuffix(trimmed, "{") || strings.HasSuffix(trimmed, "[") {
+				name := strings.TrimSpace(trimmed[:len(trimmed)-1])
+				current = &bruBlock{name: name, lines: []string{}}
+			}
+			continue
+		}
+		if line == "}" || line == "]" {
+			blocks = append(blocks, *current)
+			current = nil
+			continue
+		}
+		current.lines = append(current.lines, line)
+	}
+	return blocks
+}
+
+func (b *BrunoImporter) Parse(path string, report *ImportReport) ([]CollectionBundle, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading Bruno collection: %v", err)
+	}
+	if !info.IsDir() {
+		// bruno.json or any file inside the collection was picked
+		path = filepath.Dir(path)
+	}
+
+	bundle := CollectionBundle{Name: filepath.Base(path)}
+	if content, err := os.ReadFile(filepath.Join(path, "bruno.json")); err == nil {
+		var meta struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(content, &meta); err != nil {
+			return nil, fmt.Errorf("error parsing bruno.json: %v", err)
+		}
+		if meta.Name != "" {
+			bundle.Name = meta.Name
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading bruno.json: %v", err)
+	} else {
+		return nil, fmt.Errorf("%s is not a Bruno collection, bruno.json is missing", path)
+	}
+
+	items, description, err := b.directory(path, true, report)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Items = items
+	bundle.Description = description
+
+	bundle.Environments, err = b.environments(filepath.Join(path, "environments"), report)
+	if err != nil {
+		return nil, err
+	}
+	return []CollectionBundle{bundle}, nil
+}
+
+// directory returns the items of dir and the docs of its collection.bru or
+// folder.bru.
+func (b *BrunoImporter) directory(dir string, root bool, report *ImportReport) ([]BundleItem, string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading %s: %v", dir, err)
+	}
+
+	type seqItem struct {
+		seq  int
+		item BundleItem
+	}
+	folders, requests := []BundleItem{}, []seqItem{}
+	description := ""
+	for _, entry := range entries {
+		name := entry.Name()
+		full := filepath.Join(dir, name)
+		switch {
+		case entry.IsDir():
+			if strings.HasPrefix(name, ".") || name == "node_modules" || (root && name == "environments") {
+				continue
+			}
+			children, childDescription, err := b.directory(full, false, report)
+			if err != nil {
+				return nil, "", err
+			}
+			folders = append(folders, BundleItem{Name: name, IsFolder: true, Description: childDescription, Items: children})
+		case strings.HasSuffix(name, ".bru"):
+			content, err := os.ReadFile(full)
+			if err != nil {
+				return nil, "", fmt.Errorf("error reading %s: %v", full, err)
+			}
+			if name == "collection.bru" || name == "folder.bru" {
+				for _, block := range parseBru(string(content)) {
+					switch block.name {
+					case "docs":
+						description = block.text()
+					case "meta":
+					default:
+						report.Warn("%s: %s settings were not imported", full, block.name)
+					}
+				}
+				continue
+			}
+			item, seq, ok := b.request(strings.TrimSuffix(name, ".bru"), string(content), report)
+			if ok {
+				requests = append(requests, seqItem{seq: seq, item: item})
+			}
+		}
+	}
+
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].seq < requests[j].seq
+	})
+	items := folders
+	for _, request := range requests {
+		items = append(items, request.item)
+	}
+	return items, description, nil
+}
+
+var bruMethods = []string{"get", "post", "put", "patch", "delete", "options", "head", "connect", "trace"}
+
+func (b *BrunoImporter) request(fileName string, content string, report *ImportReport) (BundleItem, int, bool) {
+	blocks := parseBru(content)
+
+	name, seq := fileName, 0
+	headers := map[string]string{}
+	query := []string{}
+	var method, rawUrl, body, bodyMode, authMode, description string
+	assertions := []models.Assertion{}
+
+	for _, block := range blocks {
+		switch {
+		case block.name == "meta":
+			if value := block.get("name"); value != "" {
+				name = value
+			}
+			fmt.Sscanf(block.get("seq"), "%d", &seq)
+			if kind := block.get("type"); kind != "" && kind != "http" {
+				report.Warn("%q: %s requests are not supported and were skipped", name, kind)
+				return BundleItem{}, 0, false
+			}
+		case slices.Contains(bruMethods, block.name):
+			method = strings.ToUpper(block.name)
+			rawUrl = block.get("url")
+			bodyMode = block.get("body")
+			authMode = block.get("auth")
+		case block.name == "params:query":
+			for _, pair := range block.dict() {
+				query = append(query, url.QueryEscape(pair[0])+"="+url.QueryEscape(pair[1]))
+			}
+		case block.name == "params:path":
+			for _, pair := range block.dict() {
+				rawUrl = strings.ReplaceAll(rawUrl, ":"+pair[0], pair[1])
+			}
+		case block.name == "headers":
+			for _, pair := range block.dict() {
+				headers[pair[0]] = pair[1]
+			}
+		case strings.HasPrefix(block.name, "auth:") && authMode != "" && authMode != strings.TrimPrefix(block.name, "auth:"):
+			// settings of an auth mode that is not selected
+		case block.name == "auth:bearer":
+			headers["Authorization"] = "Bearer " + block.get("token")
+		case block.name == "auth:basic":
+			credentials := block.get("username") + ":" + block.get("password")
+			headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+			if strings.Contains(credentials, "{{") {
+				report.Warn("%q: basic auth uses variables, it was encoded without resolving them", name)
+			}
+		case block.name == "auth:apikey":
+			if block.get("placement") == "queryparams" {
+				query = append(query, url.QueryEscape(block.get("key"))+"="+url.QueryEscape(block.get("value")))
+			} else {
+				headers[block.get("key")] = block.get("value")
+			}
+		case strings.HasPrefix(block.name, "auth:"):
+			report.Warn("%q: %s authentication is not supported", name, strings.TrimPrefix(block.name, "auth:"))
+		case block.name == "body:json", block.name == "body:text", block.name == "body:xml", block.name == "body:graphql":
+			if strings.TrimPrefix(block.name, "body:") == bodyMode || bodyMode == "" {
+				body = block.text()
+			}
+			if block.name == "body:graphql" {
+				report.Warn("%q: GraphQL body was imported as plain text", name)
+			}
+		case block.name == "body:form-urlencoded":
+			values := []string{}
+			for _, pair := range block.dict() {
+				values = append(values, url.QueryEscape(pair[0])+"="+url.QueryEscape(pair[1]))
+			}
+			if bodyMode == "formUrlEncoded" || bodyMode == "" {
+				body = strings.Join(values, "&")
+				if _, ok := headers["Content-Type"]; !ok {
+					headers["Content-Type"] = "application/x-www-form-urlencoded"
+				}
+			}
+		case block.name == "body:multipart-form":
+			report.Warn("%q: multipart form body was not imported", name)
+		case block.name == "assert":
+			for _, pair := range block.dict() {
+				assertion, ok := bruAssertion(pair[0], pair[1])
+				if !ok {
+					report.Warn("%q: assertion %q was not imported", name, pair[0]+": "+pair[1])
+					continue
+				}
+				assertions = append(assertions, assertion)
+			}
+		case block.name == "docs":
+			description = block.text()
+		case strings.HasPrefix(block.name, "script:"), block.name == "tests":
+			report.Warn("%q: scripts and tests were not imported", name)
+		case strings.HasPrefix(block.name, "vars:"):
+			report.Warn("%q: request variables were not imported", name)
+		}
+	}
+
+	if method == "" {
+		report.Warn("%s.bru has no request block and was skipped", fileName)
+		return BundleItem{}, 0, false
+	}
+	if len(query) > 0 {
+		// Bruno keeps the query both in the url and in params:query
+		if idx := strings.Index(rawUrl, "?"); idx >= 0 {
+			rawUrl = rawUrl[:idx]
+		}
+		rawUrl += "?" + strings.Join(query, "&")
+	}
+
+	headersJson, _ := marshalStringMap(headers)
+	item := BundleItem{Name: name, Method: &method, Url: &rawUrl, Headers: &headersJson, Description: description}
+	if body != "" {
+		item.Body = &body
+	}
+	if len(assertions) > 0 {
+		encoded, _ := json.Marshal(assertions)
+		assertionsJson := string(encoded)
+		item.Assertions = &assertionsJson
+	}
+	return item, seq, true
+}
+
+// bruAssertion converts `res.status: eq 200` style assertions.
+func bruAssertion(subject string, expression string) (models.Assertion, bool) {
+	assertion := models.Assertion{}
+	switch {
+	case subject == "res.status":
+		assertion.Source = "status"
+	case subject == "res.responseTime":
+		assertion.Source = "duration"
+	case subject == "res.body":
+		assertion.Source = "body"
+	case strings.HasPrefix(subject, "res.body."):
+		assertion.Source = "json"
+		assertion.Property = strings.TrimPrefix(subject, "res.body.")
+	case strings.HasPrefix(subject, "res.headers."):
+		assertion.Source = "header"
+		assertion.Property = strings.TrimPrefix(subject, "res.headers.")
+	default:
+		return assertion, false
+	}
+
+	operator, expected, _ := strings.Cut(strings.TrimSpace(expression), " ")
+	expected = strings.Trim(strings.TrimSpace(expected), `"'`)
+	switch operator {
+	case "eq", "neq", "gt", "lt", "contains":
+		assertion.Operator = operator
+	case "notContains":
+		assertion.Operator = "not_contains"
+	case "isDefined":
+		assertion.Operator = "exists"
+	case "matches":
+		assertion.Operator = "matches"
+	default:
+		return assertion, false
+	}
+	assertion.Expected = expected
+	return assertion, true
+}
+
+func (b *BrunoImporter) environments(dir string, report *ImportReport) ([]models.Environment, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading environments: %v", err)
+	}
+
+	environments := []models.Environment{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".bru") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading environment %s: %v", entry.Name(), err)
+		}
+
+		environment := models.Environment{Name: strings.TrimSuffix(entry.Name(), ".bru"), Variables: []models.Variable{}}
+		for _, block := range parseBru(string(content)) {
+			switch block.name {
+			case "vars":
+				for _, pair := range block.dict() {
+					environment.Variables = append(environment.Variables, models.Variable{Key: pair[0], Value: pair[1], Enabled: true})
+				}
+			case "vars:secret":
+				for _, line := range block.lines {
+					key := strings.Trim(strings.TrimSpace(line), ",")
+					if key == "" || strings.HasPrefix(key, "~") {
+						continue
+					}
+					environment.Variables = append(environment.Variables, models.Variable{Key: key, Value: "", Enabled: true})
+					report.Warn("environment %q: secret %q has no value in the export and was left empty", environment.Name, key)
+				}
+			}
+		}
+		environments = append(environments, environment)
+	}
+	return environments, nil
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"posto/app/models"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// InsomniaImporter reads Insomnia v4 JSON exports. Every workspace becomes a
+// collection and request groups become folders.
+type InsomniaImporter struct{}
+
+func (i *InsomniaImporter) Format() string {
+	return "insomnia"
+}
+
+type insomniaExport struct {
+	Type         string             `json:"_type"`
+	ExportFormat int                `json:"__export_format"`
+	Resources    []insomniaResource `json:"resources"`
+}
+
+type insomniaResource struct {
+	Id             string         `json:"_id"`
+	Type           string         `json:"_type"`
+	ParentId       string         `json:"parentId"`
+	Name           string         `json:"name"`
+	Description    string         `json:"description"`
+	Method         string         `json:"method"`
+	Url            string         `json:"url"`
+	Body           insomniaBody   `json:"body"`
+	Headers        []insomniaPair `json:"headers"`
+	Parameters     []insomniaPair `json:"parameters"`
+	Authentication map[string]any `json:"authentication"`
+	Data           map[string]any `json:"data"`
+	MetaSortKey    float64        `json:"metaSortKey"`
+}
+
+type insomniaBody struct {
+	MimeType string         `json:"mimeType"`
+	Text     string         `json:"text"`
+	Params   []insomniaPair `json:"params"`
+}
+
+type insomniaPair struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Disabled bool   `json:"disabled"`
+	Type     string `json:"type"`
+}
+
+// insomniaVariablePattern matches Insomnia's nunjucks {{ _.name }} syntax.
+var insomniaVariablePattern = regexp.MustCompile(`\{\{\s*_\.([A-Za-z0-9_.\-]+)\s*\}\}`)
+
+var insomniaTagPattern = regexp.MustCompile(`\{%.*?%\}`)
+
+func (i *InsomniaImporter) Parse(path string, report *ImportReport) ([]CollectionBundle, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading Insomnia export: %v", err)
+	}
+	var export insomniaExport
+	if err := json.Unmarshal(content, &export); err != nil {
+		return nil, fmt.Errorf("error parsing Insomnia export: %v", err)
+	}
+	if export.Type != "export" || export.ExportFormat != 4 {
+		return nil, fmt.Errorf("not an Insomnia v4 export (format %d)", export.ExportFormat)
+	}
+
+	children := map[string][]insomniaResource{}
+	workspaces := []insomniaResource{}
+	for _, resource := range export.Resources {
+		switch resource.Type {
+		case "workspace":
+			workspaces = append(workspaces, resource)
+		case "request_group", "request", "environment":
+			children[resource.ParentId] = append(children[resource.ParentId], resource)
+		case "cookie_jar":
+			// cookies are not stored by Posto
+		default:
+			report.Warn("%s %q is not supported and was skipped", resource.Type, resource.Name)
+		}
+	}
+	for _, list := range children {
+		sort.SliceStable(list, func(a, b int) bool {
+			return list[a].MetaSortKey < list[b].MetaSortKey
+		})
+	}
+
+	bundles := []CollectionBundle{}
+	for _, workspace := range workspaces {
+		bundle := CollectionBundle{
+			Name:         workspace.Name,
+			Description:  workspace.Description,
+			Items:        i.items(workspace.Id, children, report),
+			Environments: i.environments(workspace, children, report),
+		}
+		bundles = append(bundles, bundle)
+	}
+	if len(bundles) == 0 {
+		return nil, fmt.Errorf("the export contains no workspace")
+	}
+	return bundles, nil
+}
+
+func (i *InsomniaImporter) items(parentId string, children map[string][]insomniaResource, report *ImportReport) []BundleItem {
+	items := []BundleItem{}
+	for _, resource := range children[parentId] {
+		switch resource.Type {
+		case "request_group":
+			items = append(items, BundleItem{
+				Name:        resource.Name,
+				IsFolder:    true,
+				Description: resource.Description,
+				Items:       i.items(resource.Id, children, report),
+			})
+		case "request":
+			items = append(items, i.request(resource, report))
+		}
+	}
+	return items
+}
+
+func (i *InsomniaImporter) request(resource insomniaResource, report *ImportReport) BundleItem {
+	method := strings.ToUpper(resource.Method)
+	if method == "" {
+		method = "GET"
+	}
+
+	rawUrl := convertInsomniaTemplate(resource.Url, resource.Name, report)
+	query := []string{}
+	for _, param := range resource.Parameters {
+		if param.Disabled {
+			continue
+		}
+		query = append(query, url.QueryEscape(convertInsomniaTemplate(param.Name, resource.Name, report))+"="+
+			url.QueryEscape(convertInsomniaTemplate(param.Value, resource.Name, report)))
+	}
+	if len(query) > 0 {
+		separator := "?"
+		if strings.Contains(rawUrl, "?") {
+			separator = "&"
+		}
+		rawUrl += separator + strings.Join(query, "&")
+	}
+
+	headers := map[string]string{}
+	for _, header := range resource.Headers {
+		if header.Disabled || header.Name == "" {
+			continue
+		}
+		headers[header.Name] = convertInsomniaTemplate(header.Value, resource.Name, report)
+	}
+	if resource.Body.MimeType != "" {
+		if _, ok := headers["Content-Type"]; !ok {
+			headers["Content-Type"] = resource.Body.MimeType
+		}
+	}
+	applyInsomniaAuth(resource, headers, report)
+	headersJson, _ := marshalStringMap(headers)
+
+	item := BundleItem{Name: resource.Name, Method: &method, Url: &rawUrl, Headers: &headersJson, Description: resource.Description}
+
+	body := ""
+	switch {
+	case resource.Body.Text != "":
+		body = convertInsomniaTemplate(resource.Body.Text, resource.Name, report)
+	case resource.Body.MimeType == "application/x-www-form-urlencoded":
+		values := []string{}
+		for _, param := range resource.Body.Params {
+			if !param.Disabled {
+				values = append(values, url.QueryEscape(param.Name)+"="+url.QueryEscape(convertInsomniaTemplate(param.Value, resource.Name, report)))
+			}
+		}
+		body = strings.Join(values, "&")
+	case len(resource.Body.Params) > 0:
+		report.Warn("%q: %s body was not imported", resource.Name, resource.Body.MimeType)
+	}
+	if body != "" {
+		item.Body = &body
+	}
+
+	return item
+}
+
+func applyInsomniaAuth(resource insomniaResource, headers map[string]string, report *ImportReport) {
+	if len(resource.Authentication) == 0 {
+		return
+	}
+	if disabled, _ := resource.Authentication["disabled"].(bool); disabled {
+		return
+	}
+	str := func(key string) string {
+		value, _ := resource.Authentication[key].(string)
+		return convertInsomniaTemplate(value, resource.Name, report)
+	}
+
+	switch authType, _ := resource.Authentication["type"].(string); authType {
+	case "bearer":
+		prefix := str("prefix")
+		if prefix == "" {
+			prefix = "Bearer"
+		}
+		headers["Authorization"] = prefix + " " + str("token")
+	case "basic":
+		credentials := str("username") + ":" + str("password")
+		if strings.Contains(credentials, "{{") {
+			report.Warn("%q: basic auth uses variables, it was stored as a plain header template", resource.Name)
+			headers["Authorization"] = "Basic " + credentials
+		} else {
+			headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+		}
+	case "apikey":
+		if str("addTo") == "queryParams" {
+			report.Warn("%q: api key in query params was not imported", resource.Name)
+			return
+		}
+		headers[str("key")] = str("value")
+	default:
+		report.Warn("%q: %s authentication is not supported", resource.Name, authType)
+	}
+}
+
+// environments merges the base environment of the workspace into each of
+// its sub environments. A workspace without sub environments keeps its base
+// environment under the workspace name.
+func (i *InsomniaImporter) environments(workspace insomniaResource, children map[string][]insomniaResource, report *ImportReport) []models.Environment {
+	environments := []models.Environment{}
+	for _, base := range children[workspace.Id] {
+		if base.Type != "environment" {
+			continue
+		}
+		baseVars := insomniaVariables(base, report)
+
+		subs := children[base.Id]
+		if len(subs) == 0 {
+			environments = append(environments, models.Environment{Name: workspace.Name, Variables: baseVars})
+			continue
+		}
+		for _, sub := range subs {
+			if sub.Type != "environment" {
+				continue
+			}
+			environments = append(environments, models.Environment{
+				Name:      sub.Name,
+				Variables: mergeVariableLists(baseVars, insomniaVariables(sub, report)),
+			})
+		}
+	}
+	return environments
+}
+
+func insomniaVariables(environment insomniaResource, report *ImportReport) []models.Variable {
+	keys := []string{}
+	for key := range environment.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	variables := []models.Variable{}
+	for _, key := range keys {
+		value := ""
+		switch v := environment.Data[key].(type) {
+		case string:
+			value = convertInsomniaTemplate(v, environment.Name, report)
+		case nil:
+		default:
+			encoded, _ := json.Marshal(v)
+			value = string(encoded)
+			report.Warn("environment %q: nested value %q was stored as JSON text", environment.Name, key)
+		}
+		variables = append(variables, models.Variable{Key: key, Value: value, Enabled: true})
+	}
+	return variables
+}
+
+func mergeVariableLists(base []models.Variable, overrides []models.Variable) []models.Variable {
+	merged := append([]models.Variable{}, base...)
+	for _, override := range overrides {
+		replaced := false
+		for i := range merged {
+			if merged[i].Key == override.Key {
+				merged[i] = override
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, override)
+		}
+	}
+	return merged
+}
+
+// convertInsomniaTemplate rewrites {{ _.name }} into {{name}}. Template tags
+// such as {% response %} cannot be evaluated by Posto and are reported.
+func convertInsomniaTemplate(s string, owner string, report *ImportReport) string {
+	s = insomniaVariablePattern.ReplaceAllString(s, "{{$1}}")
+	if insomniaTagPattern.MatchString(s) {
+		report.Warn("%q: template tags like %s are not supported and were kept as text", owner, insomniaTagPattern.FindString(s))
+	}
+	return s
+}
@@ -0,0 +1,633 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"posto/app/models"
+	"posto/app/repositories"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keep values for CollectionMirror.Resolve.
+const (
+	MirrorKeepApp  = "app"
+	MirrorKeepDisk = "disk"
+)
+
+// MirrorConflict is a request or folder changed both in the app and on disk
+// since the last sync. Neither side is touched until it is resolved.
+type MirrorConflict struct {
+	FileId int64  `json:"file_id"`
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+type MirrorSyncReport struct {
+	CollectionId int64  `json:"collection_id"`
+	Path         string `json:"path"`
+	// ToDisk lists the files written to or removed from the directory.
+	ToDisk []string `json:"to_disk"`
+	// ToApp lists the requests and folders created, updated or deleted in
+	// the collection.
+	ToApp     []string         `json:"to_app"`
+	Conflicts []MirrorConflict `json:"conflicts"`
+	Errors    []string         `json:"errors"`
+	SyncedAt  time.Time        `json:"synced_at"`
+}
+
+// Changed reports whether the sync touched either side.
+func (r MirrorSyncReport) Changed() bool {
+	return len(r.ToDisk) > 0 || len(r.ToApp) > 0
+}
+
+type MirrorStatus struct {
+	Watching   bool               `json:"watching"`
+	IntervalMs int64              `json:"interval_ms"`
+	Mirrors    []models.Mirror    `json:"mirrors"`
+	Reports    []MirrorSyncReport `json:"reports"`
+}
+
+// CollectionMirror keeps collections and their mirror directories in sync.
+// Both sides are compared with the state of the last sync: a change on one
+// side is copied to the other, changes on both sides are reported as
+// conflicts.
+type CollectionMirror struct {
+	Repositories *repositories.Active
+
+	mu       sync.Mutex
+	interval time.Duration
+	stop     chan struct{}
+	reports  map[int64]MirrorSyncReport
+}
+
+func NewCollectionMirror(repos *repositories.Active) *CollectionMirror {
+	return &CollectionMirror{Repositories: repos, reports: map[int64]MirrorSyncReport{}}
+}
+
+// Link mirrors a collection to dir and runs the first sync. Requests
+// already in dir are imported, files that differ from the collection are
+// reported as conflicts.
+func (m *CollectionMirror) Link(collectionId int, dir string) (MirrorSyncReport, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return MirrorSyncReport{}, err
+	}
+	repos := m.Repositories.Load()
+	if _, err := repos.Collection.SelectCollectionById(collectionId); err != nil {
+		return MirrorSyncReport{}, fmt.Errorf("error loading collection: %v", err)
+	}
+	if _, err := repos.Mirror.SelectMirrorByCollection(collectionId); err == nil {
+		return MirrorSyncReport{}, fmt.Errorf("collection is already mirrored")
+	}
+	if _, err := repos.Mirror.InsertMirror(collectionId, abs); err != nil {
+		return MirrorSyncReport{}, fmt.Errorf("error saving mirror: %v", err)
+	}
+	return m.Sync(collectionId)
+}
+
+// Unlink stops mirroring a collection. The directory is left as it is.
+func (m *CollectionMirror) Unlink(collectionId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	repos := m.Repositories.Load()
+	mirror, err := repos.Mirror.SelectMirrorByCollection(collectionId)
+	if err != nil {
+		return fmt.Errorf("error loading mirror: %v", err)
+	}
+	delete(m.reports, mirror.CollectionId)
+	return repos.Mirror.DeleteMirror(mirror.PkMirrorId)
+}
+
+func (m *CollectionMirror) Sync(collectionId int) (MirrorSyncReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	repos := m.Repositories.Load()
+	mirror, err := repos.Mirror.SelectMirrorByCollection(collectionId)
+	if err != nil {
+		return MirrorSyncReport{}, fmt.Errorf("error loading mirror: %v", err)
+	}
+	return m.syncMirror(repos, mirror)
+}
+
+// SyncAll syncs every mirrored collection. A failing mirror does not stop
+// the others, its error is part of its report.
+func (m *CollectionMirror) SyncAll() []MirrorSyncReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	repos := m.Repositories.Load()
+	reports := []MirrorSyncReport{}
+	mirrors, err := repos.Mirror.SelectAllMirrors()
+	if err != nil {
+		return reports
+	}
+	for _, mirror := range mirrors {
+		report, err := m.syncMirror(repos, mirror)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			m.reports[mirror.CollectionId] = report
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// Resolve settles a conflict by copying the kept side (MirrorKeepApp or
+// MirrorKeepDisk) over the other one, then syncs the collection.
+func (m *CollectionMirror) Resolve(collectionId int, fileId int64, keep string) (MirrorSyncReport, error) {
+	if keep != MirrorKeepApp && keep != MirrorKeepDisk {
+		return MirrorSyncReport{}, fmt.Errorf("invalid side %q, expected %s or %s", keep, MirrorKeepApp, MirrorKeepDisk)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	repos := m.Repositories.Load()
+	mirror, err := repos.Mirror.SelectMirrorByCollection(collectionId)
+	if err != nil {
+		return MirrorSyncReport{}, fmt.Errorf("error loading mirror: %v", err)
+	}
+	state, err := m.loadMirrorState(repos, mirror)
+	if err != nil {
+		return MirrorSyncReport{}, err
+	}
+
+	db, dbOk := state.db[fileId]
+	entry, hasEntry := state.entries[fileId]
+	if !dbOk && !hasEntry {
+		return MirrorSyncReport{}, fmt.Errorf("file %d is not part of the mirror", fileId)
+	}
+	target := entry.Path
+	if !hasEntry {
+		target = db.Path
+	}
+	disk, diskOk := state.disk[target]
+
+	switch {
+	case keep == MirrorKeepApp && dbOk:
+		if err := writeMirrorNode(mirror.Path, db); err != nil {
+			return MirrorSyncReport{}, fmt.Errorf("error writing %s: %v", db.Path, err)
+		}
+		if target != db.Path {
+			os.RemoveAll(filepath.Join(mirror.Path, filepath.FromSlash(target)))
+		}
+		state.entries[fileId] = models.MirrorEntry{FileId: fileId, Path: db.Path, Hash: db.Hash}
+	case keep == MirrorKeepApp:
+		if err := os.RemoveAll(filepath.Join(mirror.Path, filepath.FromSlash(target))); err != nil {
+			return MirrorSyncReport{}, err
+		}
+		delete(state.entries, fileId)
+	case diskOk && dbOk:
+		if !disk.IsFolder {
+			if err := SaveRequest(repos, int(fileId), disk.requestData(), false); err != nil {
+				return MirrorSyncReport{}, fmt.Errorf("error updating %q: %v", db.Name, err)
+			}
+		}
+		state.entries[fileId] = models.MirrorEntry{FileId: fileId, Path: target, Hash: disk.Hash}
+	case diskOk:
+		// deleted in the app, the next sync imports the file again
+		delete(state.entries, fileId)
+	default:
+		if err := repos.Trash.TrashFile(int(fileId)); err != nil {
+			return MirrorSyncReport{}, fmt.Errorf("error deleting %q: %v", db.Name, err)
+		}
+		delete(state.entries, fileId)
+	}
+
+	if err := repos.Mirror.ReplaceMirrorEntries(mirror.PkMirrorId, state.entryList()); err != nil {
+		return MirrorSyncReport{}, fmt.Errorf("error saving mirror state: %v", err)
+	}
+	return m.syncMirror(repos, mirror)
+}
+
+// Watch syncs every mirror each interval until StopWatching is called, so
+// that edits made outside the app, e.g. by a git pull, are picked up.
+func (m *CollectionMirror) Watch(interval time.Duration) {
+	m.StopWatching()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stop := make(chan struct{})
+	m.stop = stop
+	m.interval = interval
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				m.SyncAll()
+			}
+		}
+	}()
+}
+
+func (m *CollectionMirror) StopWatching() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// ClearReports forgets the reports of past syncs, e.g. once another
+// workspace was opened.
+func (m *CollectionMirror) ClearReports() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reports = map[int64]MirrorSyncReport{}
+}
+
+// Status returns the mirrors and the report of the last sync of each that
+// changed something, had conflicts or failed.
+func (m *CollectionMirror) Status() (MirrorStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := MirrorStatus{
+		Watching:   m.stop != nil,
+		IntervalMs: m.interval.Milliseconds(),
+		Reports:    []MirrorSyncReport{},
+	}
+	repos := m.Repositories.Load()
+	mirrors, err := repos.Mirror.SelectAllMirrors()
+	if err != nil {
+		return status, err
+	}
+	status.Mirrors = mirrors
+	for _, mirror := range mirrors {
+		if report, ok := m.reports[mirror.CollectionId]; ok {
+			status.Reports = append(status.Reports, report)
+		}
+	}
+	return status, nil
+}
+
+type mirrorState struct {
+	db      map[int64]*mirrorNode
+	disk    map[string]*mirrorNode
+	invalid map[string]error
+	entries map[int64]models.MirrorEntry
+}
+
+func (s *mirrorState) entryList() []models.MirrorEntry {
+	entries := []models.MirrorEntry{}
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (m *CollectionMirror) loadMirrorState(repos *repositories.Repositories, mirror models.Mirror) (*mirrorState, error) {
+	state := &mirrorState{entries: map[int64]models.MirrorEntry{}}
+
+	files, err := repos.File.SelectFilesByCollection(int(mirror.CollectionId))
+	if err != nil {
+		return nil, fmt.Errorf("error loading files: %v", err)
+	}
+	if state.db, err = mirrorDatabaseNodes(files); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(mirror.Path, 0755); err != nil {
+		return nil, err
+	}
+	if state.disk, state.invalid, err = readMirrorDirectory(mirror.Path); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", mirror.Path, err)
+	}
+
+	entries, err := repos.Mirror.SelectMirrorEntries(mirror.PkMirrorId)
+	if err != nil {
+		return nil, fmt.Errorf("error loading mirror state: %v", err)
+	}
+	for _, entry := range entries {
+		state.entries[entry.FileId] = entry
+	}
+	return state, nil
+}
+
+// mirrorEntryOrder puts requests before folders and deeper paths first, so
+// that folders are only removed once their requests have been handled.
+func mirrorEntryOrder(entries []models.MirrorEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		aRequest, bRequest := strings.HasSuffix(a.Path, mirrorRequestExt), strings.HasSuffix(b.Path, mirrorRequestExt)
+		if aRequest != bRequest {
+			return aRequest
+		}
+		if da, db := strings.Count(a.Path, "/"), strings.Count(b.Path, "/"); da != db {
+			return da > db
+		}
+		return a.Path < b.Path
+	})
+}
+
+// mirrorNodeOrder puts folders before requests and parents before children.
+func mirrorNodeOrder(nodes []*mirrorNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if a.IsFolder != b.IsFolder {
+			return a.IsFolder
+		}
+		if da, db := strings.Count(a.Path, "/"), strings.Count(b.Path, "/"); da != db {
+			return da < db
+		}
+		return a.Path < b.Path
+	})
+}
+
+// syncMirror reconciles the collection and the directory. m.mu must be held.
+func (m *CollectionMirror) syncMirror(repos *repositories.Repositories, mirror models.Mirror) (MirrorSyncReport, error) {
+	report := MirrorSyncReport{
+		CollectionId: mirror.CollectionId,
+		Path:         mirror.Path,
+		ToDisk:       []string{},
+		ToApp:        []string{},
+		Conflicts:    []MirrorConflict{},
+		Errors:       []string{},
+	}
+	collectionId := int(mirror.CollectionId)
+
+	state, err := m.loadMirrorState(repos, mirror)
+	if err != nil {
+		return report, err
+	}
+	for _, rel := range sortedKeys(state.invalid) {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", rel, state.invalid[rel]))
+	}
+
+	next := map[int64]models.MirrorEntry{}
+	claimed := map[string]bool{}
+	for rel := range state.invalid {
+		claimed[rel] = true
+	}
+	for _, entry := range state.entries {
+		claimed[entry.Path] = true
+	}
+	conflict := func(fileId int64, rel string, reason string) {
+		report.Conflicts = append(report.Conflicts, MirrorConflict{FileId: fileId, Path: rel, Reason: reason})
+	}
+	write := func(node *mirrorNode) bool {
+		if err := writeMirrorNode(mirror.Path, node); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", node.Path, err))
+			return false
+		}
+		report.ToDisk = append(report.ToDisk, "wrote "+node.Path)
+		return true
+	}
+	remove := func(rel string, isFolder bool) bool {
+		target := filepath.Join(mirror.Path, filepath.FromSlash(rel))
+		// folders are only removed once empty, new files in them are kept
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			if isFolder {
+				return false
+			}
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", rel, err))
+			return false
+		}
+		report.ToDisk = append(report.ToDisk, "removed "+rel)
+		return true
+	}
+
+	// 1. files synced before: copy the side that changed
+	entries := state.entryList()
+	mirrorEntryOrder(entries)
+	deletedOnDisk := []models.MirrorEntry{}
+	for _, entry := range entries {
+		db, dbOk := state.db[entry.FileId]
+		disk, diskOk := state.disk[entry.Path]
+		if _, invalid := state.invalid[entry.Path]; invalid {
+			next[entry.FileId] = entry
+			continue
+		}
+
+		dbChanged := !dbOk || db.Hash != entry.Hash || db.Path != entry.Path
+		diskChanged := !diskOk || disk.Hash != entry.Hash
+
+		switch {
+		case !dbChanged && !diskChanged:
+			next[entry.FileId] = entry
+		case dbChanged && !diskChanged && !dbOk:
+			if !remove(entry.Path, disk.IsFolder) {
+				conflict(entry.FileId, entry.Path, "deleted in the app but the folder has new files on disk")
+				next[entry.FileId] = entry
+			}
+		case dbChanged && !diskChanged:
+			if db.Path != entry.Path && (claimed[db.Path] || state.disk[db.Path] != nil) {
+				conflict(entry.FileId, db.Path, "renamed in the app but the new path is used on disk")
+				next[entry.FileId] = entry
+				continue
+			}
+			if write(db) {
+				claimed[db.Path] = true
+				if db.Path != entry.Path && !db.IsFolder {
+					remove(entry.Path, false)
+				}
+				next[entry.FileId] = models.MirrorEntry{FileId: entry.FileId, Path: db.Path, Hash: db.Hash}
+			} else {
+				next[entry.FileId] = entry
+			}
+		case !dbChanged && !diskOk:
+			deletedOnDisk = append(deletedOnDisk, entry)
+		case !dbChanged:
+			if err := SaveRequest(repos, int(entry.FileId), disk.requestData(), false); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", entry.Path, err))
+				next[entry.FileId] = entry
+				continue
+			}
+			report.ToApp = append(report.ToApp, "updated "+entry.Path)
+			next[entry.FileId] = models.MirrorEntry{FileId: entry.FileId, Path: entry.Path, Hash: disk.Hash}
+		case !dbOk && !diskOk:
+			// deleted on both sides
+		case dbOk && diskOk && db.Hash == disk.Hash && db.Path == entry.Path:
+			next[entry.FileId] = models.MirrorEntry{FileId: entry.FileId, Path: entry.Path, Hash: db.Hash}
+		default:
+			reason := "changed in the app and on disk"
+			if !dbOk {
+				reason = "deleted in the app and changed on disk"
+			} else if !diskOk {
+				reason = "changed in the app and deleted on disk"
+			}
+			conflict(entry.FileId, entry.Path, reason)
+			next[entry.FileId] = entry
+		}
+	}
+
+	// 2. new in the app: write them unless the path is taken on disk
+	created := []*mirrorNode{}
+	for fileId, db := range state.db {
+		if _, ok := state.entries[fileId]; !ok {
+			created = append(created, db)
+		}
+	}
+	mirrorNodeOrder(created)
+	for _, db := range created {
+		if claimed[db.Path] {
+			conflict(db.FileId, db.Path, "created in the app but the path is used on disk")
+			continue
+		}
+		claimed[db.Path] = true
+		if disk, ok := state.disk[db.Path]; ok {
+			if disk.Hash == db.Hash {
+				next[db.FileId] = models.MirrorEntry{FileId: db.FileId, Path: db.Path, Hash: db.Hash}
+			} else {
+				conflict(db.FileId, db.Path, "created in the app and on disk")
+			}
+			continue
+		}
+		if write(db) {
+			next[db.FileId] = models.MirrorEntry{FileId: db.FileId, Path: db.Path, Hash: db.Hash}
+		}
+	}
+
+	// 3. new on disk: create them, a request whose content matches one
+	// deleted on disk was moved or renamed and keeps its id
+	folderIds := map[string]int64{}
+	for _, entry := range next {
+		if node, ok := state.db[entry.FileId]; ok && node.IsFolder {
+			folderIds[entry.Path] = entry.FileId
+		}
+	}
+	added := []*mirrorNode{}
+	for rel, disk := range state.disk {
+		if !claimed[rel] {
+			added = append(added, disk)
+		}
+	}
+	mirrorNodeOrder(added)
+	for _, disk := range added {
+		var parentId *int
+		if parent := path.Dir(disk.Path); parent != "." {
+			id, ok := folderIds[parent]
+			if !ok {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: folder %s is not part of the collection", disk.Path, parent))
+				continue
+			}
+			parentRef := int(id)
+			parentId = &parentRef
+		}
+
+		moved := -1
+		for i, entry := range deletedOnDisk {
+			if !disk.IsFolder && entry.Hash == disk.Hash {
+				moved = i
+				break
+			}
+		}
+		if moved >= 0 {
+			entry := deletedOnDisk[moved]
+			deletedOnDisk = append(deletedOnDisk[:moved], deletedOnDisk[moved+1:]...)
+			if err := repos.File.MoveFile(int(entry.FileId), parentId, disk.Name); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", disk.Path, err))
+				next[entry.FileId] = entry
+				continue
+			}
+			report.ToApp = append(report.ToApp, fmt.Sprintf("moved %s to %s", entry.Path, disk.Path))
+			next[entry.FileId] = models.MirrorEntry{FileId: entry.FileId, Path: disk.Path, Hash: disk.Hash}
+			continue
+		}
+
+		fileId, err := repos.File.CreateFileOrFolder(repositories.FileCreationParam{
+			CollectionId: collectionId,
+			ParentId:     parentId,
+			IsFolder:     disk.IsFolder,
+			Name:         disk.Name,
+		})
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", disk.Path, err))
+			continue
+		}
+		if !disk.IsFolder {
+			if err := repos.File.UpdateFile(*fileId, disk.requestData()); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", disk.Path, err))
+			}
+		} else {
+			folderIds[disk.Path] = int64(*fileId)
+		}
+		report.ToApp = append(report.ToApp, "created "+disk.Path)
+		next[int64(*fileId)] = models.MirrorEntry{FileId: int64(*fileId), Path: disk.Path, Hash: disk.Hash}
+	}
+
+	// 4. deleted on disk: requests first, folders only once they are empty
+	for _, entry := range deletedOnDisk {
+		if strings.HasSuffix(entry.Path, mirrorRequestExt) || !m.hasChildren(repos, collectionId, entry.FileId) {
+			if err := repos.Trash.TrashFile(int(entry.FileId)); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", entry.Path, err))
+				next[entry.FileId] = entry
+				continue
+			}
+			report.ToApp = append(report.ToApp, "deleted "+entry.Path)
+			continue
+		}
+		conflict(entry.FileId, entry.Path, "deleted on disk but the folder still has requests in the app")
+		next[entry.FileId] = entry
+	}
+
+	// 5. store the new state and drop directories left empty by renames
+	state.entries = next
+	if err := repos.Mirror.ReplaceMirrorEntries(mirror.PkMirrorId, state.entryList()); err != nil {
+		return report, fmt.Errorf("error saving mirror state: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(mirror.Path, mirrorCollectionFile)); os.IsNotExist(err) {
+		if collection, err := repos.Collection.SelectCollectionById(collectionId); err == nil {
+			writeMirrorCollectionMeta(mirror.Path, collection)
+		}
+	}
+	tracked := map[string]bool{}
+	for _, entry := range next {
+		tracked[entry.Path] = true
+	}
+	removeEmptyDirectories(mirror.Path, tracked)
+
+	report.SyncedAt = time.Now()
+	if report.Changed() || len(report.Conflicts) > 0 || len(report.Errors) > 0 {
+		m.reports[mirror.CollectionId] = report
+	}
+	return report, nil
+}
+
+func (m *CollectionMirror) hasChildren(repos *repositories.Repositories, collectionId int, folderId int64) bool {
+	files, err := repos.File.SelectFilesByCollection(collectionId)
+	if err != nil {
+		return true
+	}
+	for _, file := range files {
+		if file.ParentId != nil && *file.ParentId == folderId {
+			return true
+		}
+	}
+	return false
+}
+
+// removeEmptyDirectories removes the empty directories below root that are
+// not folders of the collection, deepest first.
+func removeEmptyDirectories(root string, tracked map[string]bool) {
+	dirs := []string{}
+	filepath.WalkDir(root, func(name string, entry os.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() || name == root {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, name)
+		return nil
+	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		rel, err := filepath.Rel(root, dirs[i])
+		if err != nil || tracked[filepath.ToSlash(rel)] {
+			continue
+		}
+		os.Remove(dirs[i])
+	}
+}
@@ -0,0 +1,372 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"posto/app/models"
+	"posto/app/repositories"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A collection on disk is a directory with one directory per folder and one
+// JSON file per request:
+//
+//	.posto-collection.json   name of the collection
+//	Users/                   folder
+//	Users/Get user.json      request
+//
+// Hidden files and directories (e.g. .git) are ignored, as are files that
+// do not end in .json.
+const (
+	mirrorCollectionFile  = ".posto-collection.json"
+	mirrorFormatVersion   = 1
+	mirrorRequestExt      = ".json"
+	mirrorFolderHash      = "folder"
+	mirrorDefaultFileName = "untitled"
+)
+
+type mirrorCollectionMeta struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Version     int    `json:"version"`
+}
+
+// MirrorRequest is the on-disk form of a request. Headers are written as an
+// object and assertions/mock as plain JSON so that diffs stay readable.
+type MirrorRequest struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Method      string            `json:"method"`
+	Url         string            `json:"url"`
+	Headers     map[string]string `json:"headers"`
+	Body        string            `json:"body,omitempty"`
+	Assertions  json.RawMessage   `json:"assertions,omitempty"`
+	Mock        json.RawMessage   `json:"mock,omitempty"`
+}
+
+// mirrorNode is a folder or request either read from the directory or
+// rendered from the file table. Path is slash separated and relative to the
+// mirror directory.
+type mirrorNode struct {
+	FileId   int64
+	IsFolder bool
+	Name     string
+	Path     string
+	Hash     string
+	Content  []byte
+	Request  MirrorRequest
+}
+
+func (n *mirrorNode) requestData() repositories.FileRequestData {
+	headers, _ := marshalStringMap(n.Request.Headers)
+	assertions := string(n.Request.Assertions)
+	mock := string(n.Request.Mock)
+	return repositories.FileRequestData{
+		Name:        &n.Request.Name,
+		Description: &n.Request.Description,
+		Method:      &n.Request.Method,
+		Url:         &n.Request.Url,
+		Headers:     &headers,
+		Body:        &n.Request.Body,
+		Assertions:  &assertions,
+		Mock:        &mock,
+	}
+}
+
+func mirrorHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func encodeMirrorRequest(request MirrorRequest) ([]byte, error) {
+	content, err := json.MarshalIndent(request, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
+
+// mirrorRequestFromFile converts a row of the file table. Invalid JSON in
+// assertions or mock is left out rather than failing the whole collection.
+func mirrorRequestFromFile(file models.File) MirrorRequest {
+	request := MirrorRequest{Name: file.Name, Description: file.Description, Method: "GET", Headers: map[string]string{}}
+	if file.Method != nil && *file.Method != "" {
+		request.Method = *file.Method
+	}
+	if file.Url != nil {
+		request.Url = *file.Url
+	}
+	if file.Headers != nil && *file.Headers != "" {
+		json.Unmarshal([]byte(*file.Headers), &request.Headers)
+	}
+	if file.Body != nil {
+		request.Body = *file.Body
+	}
+	if file.Assertions != nil && json.Valid([]byte(*file.Assertions)) && strings.TrimSpace(*file.Assertions) != "[]" {
+		request.Assertions = json.RawMessage(*file.Assertions)
+	}
+	if file.Mock != nil && json.Valid([]byte(*file.Mock)) {
+		request.Mock = json.RawMessage(*file.Mock)
+	}
+	return request
+}
+
+var mirrorInvalidName = regexp.MustCompile(`[/\\:*?"<>|\x00-\x1f]+`)
+
+// mirrorFileName turns a request or folder name into a portable file name.
+func mirrorFileName(name string) string {
+	cleaned := strings.Trim(mirrorInvalidName.ReplaceAllString(name, "_"), " .")
+	if cleaned == "" {
+		return mirrorDefaultFileName
+	}
+	if strings.HasPrefix(cleaned, ".") {
+		cleaned = "_" + cleaned
+	}
+	return cleaned
+}
+
+// mirrorDatabaseNodes renders the files of a collection keyed by file id.
+// Names that map to the same file name get a " (2)", " (3)"... suffix.
+func mirrorDatabaseNodes(files []models.File) (map[int64]*mirrorNode, error) {
+	nodes := map[int64]*mirrorNode{}
+	var walk func(children []*FileNode, dir string) error
+	walk = func(children []*FileNode, dir string) error {
+		used := map[string]bool{}
+		for _, child := range children {
+			base := mirrorFileName(child.File.Name)
+			ext := mirrorRequestExt
+			if child.File.IsFolder {
+				ext = ""
+			}
+			name := base + ext
+			for i := 2; used[strings.ToLower(name)]; i++ {
+				name = fmt.Sprintf("%s (%d)%s", base, i, ext)
+			}
+			used[strings.ToLower(name)] = true
+
+			node := &mirrorNode{
+				FileId:   child.File.PkFileId,
+				IsFolder: child.File.IsFolder,
+				Name:     child.File.Name,
+				Path:     path.Join(dir, name),
+			}
+			if child.File.IsFolder {
+				node.Hash = mirrorFolderHash
+				if err := walk(child.Children, node.Path); err != nil {
+					return err
+				}
+			} else {
+				node.Request = mirrorRequestFromFile(child.File)
+				content, err := encodeMirrorRequest(node.Request)
+				if err != nil {
+					return fmt.Errorf("error encoding %q: %v", child.File.Name, err)
+				}
+				node.Content = content
+				node.Hash = mirrorHash(content)
+			}
+			nodes[node.FileId] = node
+		}
+		return nil
+	}
+	return nodes, walk(BuildFileTree(files), "")
+}
+
+// readMirrorDirectory reads every folder and request below root keyed by
+// path. Request files that cannot be parsed are returned separately.
+func readMirrorDirectory(root string) (map[string]*mirrorNode, map[string]error, error) {
+	nodes := map[string]*mirrorNode{}
+	invalid := map[string]error{}
+
+	err := filepath.WalkDir(root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == root {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			nodes[rel] = &mirrorNode{IsFolder: true, Name: entry.Name(), Path: rel, Hash: mirrorFolderHash}
+			return nil
+		}
+		if !strings.HasSuffix(entry.Name(), mirrorRequestExt) {
+			return nil
+		}
+
+		content, err := os.ReadFile(name)
+		if err != nil {
+			invalid[rel] = err
+			return nil
+		}
+		request := MirrorRequest{}
+		if err := json.Unmarshal(content, &request); err != nil {
+			invalid[rel] = fmt.Errorf("invalid request file: %v", err)
+			return nil
+		}
+		if request.Name == "" {
+			request.Name = strings.TrimSuffix(entry.Name(), mirrorRequestExt)
+		}
+		if request.Method == "" {
+			request.Method = "GET"
+		}
+		if request.Headers == nil {
+			request.Headers = map[string]string{}
+		}
+
+		// hash the normalised content so that formatting-only edits are
+		// not treated as changes
+		normalised, err := encodeMirrorRequest(request)
+		if err != nil {
+			invalid[rel] = err
+			return nil
+		}
+		nodes[rel] = &mirrorNode{
+			Name:    request.Name,
+			Path:    rel,
+			Hash:    mirrorHash(normalised),
+			Content: normalised,
+			Request: request,
+		}
+		return nil
+	})
+	return nodes, invalid, err
+}
+
+func writeMirrorNode(root string, node *mirrorNode) error {
+	target := filepath.Join(root, filepath.FromSlash(node.Path))
+	if node.IsFolder {
+		return os.MkdirAll(target, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, node.Content, 0644)
+}
+
+func writeMirrorCollectionMeta(root string, collection models.Collection) error {
+	meta := mirrorCollectionMeta{Name: collection.Name, Description: collection.Description, Version: mirrorFormatVersion}
+	content, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(root, mirrorCollectionFile), append(content, '\n'), 0644)
+}
+
+// ExportCollectionDirectory writes a collection to dir in the mirror
+// layout. Existing request files with the same names are overwritten.
+func ExportCollectionDirectory(repos *repositories.Repositories, collectionId int, dir string) error {
+	collection, err := repos.Collection.SelectCollectionById(collectionId)
+	if err != nil {
+		return fmt.Errorf("error loading collection: %v", err)
+	}
+	files, err := repos.File.SelectFilesByCollection(collectionId)
+	if err != nil {
+		return fmt.Errorf("error loading files: %v", err)
+	}
+	nodes, err := mirrorDatabaseNodes(files)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := writeMirrorCollectionMeta(dir, collection); err != nil {
+		return fmt.Errorf("error writing %s: %v", mirrorCollectionFile, err)
+	}
+	for _, node := range nodes {
+		if err := writeMirrorNode(dir, node); err != nil {
+			return fmt.Errorf("error writing %s: %v", node.Path, err)
+		}
+	}
+	return nil
+}
+
+// DirectoryImporter imports a collection directory written by
+// ExportCollectionDirectory or a mirror.
+type DirectoryImporter struct{}
+
+func (d *DirectoryImporter) Format() string {
+	return "directory"
+}
+
+func (d *DirectoryImporter) Parse(dir string, report *ImportReport) ([]CollectionBundle, error) {
+	name, description := filepath.Base(dir), ""
+	if content, err := os.ReadFile(filepath.Join(dir, mirrorCollectionFile)); err == nil {
+		meta := mirrorCollectionMeta{}
+		if err := json.Unmarshal(content, &meta); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", mirrorCollectionFile, err)
+		}
+		if meta.Name != "" {
+			name = meta.Name
+		}
+		description = meta.Description
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	nodes, invalid, err := readMirrorDirectory(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", dir, err)
+	}
+	for _, rel := range sortedKeys(invalid) {
+		report.Warn("%s was skipped: %v", rel, invalid[rel])
+	}
+
+	return []CollectionBundle{{Name: name, Description: description, Items: mirrorBundleItems(nodes, "")}}, nil
+}
+
+// mirrorBundleItems nests the nodes found directly below dir.
+func mirrorBundleItems(nodes map[string]*mirrorNode, dir string) []BundleItem {
+	items := []BundleItem{}
+	for _, rel := range sortedKeys(nodes) {
+		node := nodes[rel]
+		if parent := path.Dir(rel); parent != dir && !(parent == "." && dir == "") {
+			continue
+		}
+		item := BundleItem{Name: node.Name, IsFolder: node.IsFolder}
+		if node.IsFolder {
+			item.Items = mirrorBundleItems(nodes, rel)
+		} else {
+			data := node.requestData()
+			item.Method = data.Method
+			item.Url = data.Url
+			item.Headers = data.Headers
+			item.Body = data.Body
+			item.Assertions = data.Assertions
+			item.Mock = data.Mock
+			item.Description = node.Request.Description
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,550 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"posto/app/models"
+	"posto/app/repositories"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const mockRequestLogLimit = 500
+
+// mockRequestBodyLimit is the largest request body the mock server reads.
+const mockRequestBodyLimit = 10 << 20
+
+type MockServerOptions struct {
+	CollectionId int    `json:"collection_id"`
+	Host         string `json:"host"`
+	Port         int    `json:"port"`
+}
+
+type MockServerStatus struct {
+	Running      bool      `json:"running"`
+	CollectionId int       `json:"collection_id"`
+	Address      string    `json:"address"`
+	Routes       int       `json:"routes"`
+	StartedAt    time.Time `json:"started_at"`
+}
+
+// MockRoute matches incoming requests by method and path segments derived
+// from the url stored on a request file.
+type MockRoute struct {
+	FileId   int64                `json:"file_id"`
+	Name     string               `json:"name"`
+	Method   string               `json:"method"`
+	Pattern  string               `json:"pattern"`
+	Response *models.MockResponse `json:"response"`
+	segments []mockSegment
+}
+
+type mockSegment struct {
+	literal string
+	param   string
+}
+
+// MockServer serves the mock responses of a collection over net/http.
+type MockServer struct {
+	Repositories *repositories.Active
+	// OnRequest is called after every request hitting the mock, e.g. to
+	// print it on the command line.
+	OnRequest func(entry models.MockRequestLog)
+
+	mu       sync.Mutex
+	server   *http.Server
+	status   MockServerStatus
+	routes   []MockRoute
+	requests []models.MockRequestLog
+}
+
+func NewMockServer(repositories *repositories.Active) *MockServer {
+	return &MockServer{Repositories: repositories, requests: []models.MockRequestLog{}}
+}
+
+// LoadMockRoutes builds the routes of every request of a collection that has
+// a url. More specific patterns (more literal segments) are matched first.
+// Requests without a mock response serve their first saved example.
+func LoadMockRoutes(repos *repositories.Repositories, collectionId int) ([]MockRoute, error) {
+	files, err := repos.File.SelectFilesByCollection(collectionId)
+	if err != nil {
+		return nil, fmt.Errorf("error loading files: %v", err)
+	}
+
+	examples, err := repos.Example.SelectExamplesByCollection(collectionId)
+	if err != nil {
+		return nil, fmt.Errorf("error loading examples: %v", err)
+	}
+
+	routes := []MockRoute{}
+	for _, file := range files {
+		if file.IsFolder || file.Url == nil || strings.TrimSpace(*file.Url) == "" {
+			continue
+		}
+
+		route := MockRoute{FileId: file.PkFileId, Name: file.Name, Method: "GET"}
+		if file.Method != nil && *file.Method != "" {
+			route.Method = strings.ToUpper(*file.Method)
+		}
+		route.Pattern, route.segments = mockPattern(*file.Url)
+
+		if file.Mock != nil && strings.TrimSpace(*file.Mock) != "" {
+			var mock models.MockResponse
+			if err := json.Unmarshal([]byte(*file.Mock), &mock); err != nil {
+				return nil, fmt.Errorf("invalid mock response of %q: %v", file.Name, err)
+			}
+			route.Response = &mock
+		}
+		if err := resolveMockExample(&route, examples[file.PkFileId]); err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		return literalCount(routes[i].segments) > literalCount(routes[j].segments)
+	})
+	return routes, nil
+}
+
+// resolveMockExample replaces the response of a route with the saved example
+// it refers to, or uses the first example when no mock response is set.
+func resolveMockExample(route *MockRoute, examples []models.Example) error {
+	var example *models.Example
+	switch {
+	case route.Response != nil && route.Response.Example != "":
+		for i := range examples {
+			if examples[i].Name == route.Response.Example {
+				example = &examples[i]
+				break
+			}
+		}
+		if example == nil {
+			return fmt.Errorf("example %q of %q not found", route.Response.Example, route.Name)
+		}
+	case route.Response == nil && len(examples) > 0:
+		example = &examples[0]
+	default:
+		return nil
+	}
+
+	response := models.MockResponse{
+		Status:   example.StatusCode,
+		Headers:  map[string]string{},
+		Body:     example.Body,
+		IsBinary: example.IsBinary,
+	}
+	for k, v := range example.Headers {
+		// the body is re-encoded by net/http, stale transport headers would be wrong
+		switch http.CanonicalHeaderKey(k) {
+		case "Content-Length", "Content-Encoding", "Transfer-Encoding", "Date", "Connection":
+			continue
+		}
+		response.Headers[k] = v
+	}
+	if example.ContentType != "" {
+		response.Headers["Content-Type"] = example.ContentType
+	}
+	if route.Response != nil {
+		response.DelayMs = route.Response.DelayMs
+	}
+	route.Response = &response
+	return nil
+}
+
+func literalCount(segments []mockSegment) int {
+	count := 0
+	for _, segment := range segments {
+		if segment.param == "" {
+			count++
+		}
+	}
+	return count
+}
+
+var mockParamPattern = regexp.MustCompile(`^\{\{\s*([^}]+?)\s*\}\}$`)
+
+// mockPattern strips scheme, host (or a leading {{baseUrl}} variable), query
+// and fragment from a stored url and turns {{var}} and :var segments into
+// named parameters.
+func mockPattern(rawUrl string) (string, []mockSegment) {
+	path := strings.TrimSpace(rawUrl)
+	if idx := strings.IndexAny(path, "?#"); idx >= 0 {
+		path = path[:idx]
+	}
+	if idx := strings.Index(path, "://"); idx >= 0 {
+		path = path[idx+3:]
+		if slash := strings.Index(path, "/"); slash >= 0 {
+			path = path[slash:]
+		} else {
+			path = "/"
+		}
+	} else if strings.HasPrefix(path, "{{") {
+		if end := strings.Index(path, "}}"); end >= 0 {
+			path = path[end+2:]
+		}
+	} else if !strings.HasPrefix(path, "/") {
+		// host without scheme, e.g. localhost:8080/users
+		if slash := strings.Index(path, "/"); slash >= 0 {
+			path = path[slash:]
+		} else {
+			path = "/"
+		}
+	}
+
+	segments := []mockSegment{}
+	parts := []string{}
+	for _, part := range strings.Split(strings.Trim(path, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		if match := mockParamPattern.FindStringSubmatch(part); match != nil {
+			segments = append(segments, mockSegment{param: match[1]})
+			parts = append(parts, ":"+match[1])
+		} else if strings.HasPrefix(part, ":") && len(part) > 1 {
+			segments = append(segments, mockSegment{param: part[1:]})
+			parts = append(parts, part)
+		} else {
+			segments = append(segments, mockSegment{literal: part})
+			parts = append(parts, part)
+		}
+	}
+	return "/" + strings.Join(parts, "/"), segments
+}
+
+func (r MockRoute) match(method string, path string) (map[string]string, bool) {
+	if r.Method != method {
+		return nil, false
+	}
+
+	parts := []string{}
+	for _, part := range strings.Split(strings.Trim(path, "/"), "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, segment := range r.segments {
+		if segment.param != "" {
+			params[segment.param] = parts[i]
+		} else if segment.literal != parts[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// Start loads the routes of the collection and listens on the given port.
+// A running server is stopped first.
+func (m *MockServer) Start(options MockServerOptions) (MockServerStatus, error) {
+	if err := m.Stop(); err != nil {
+		return m.Status(), err
+	}
+
+	routes, err := LoadMockRoutes(m.Repositories.Load(), options.CollectionId)
+	if err != nil {
+		return m.Status(), err
+	}
+
+	host := options.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(options.Port)))
+	if err != nil {
+		return m.Status(), fmt.Errorf("error starting mock server: %v", err)
+	}
+
+	server := &http.Server{Handler: m}
+
+	m.mu.Lock()
+	m.server = server
+	m.routes = routes
+	m.status = MockServerStatus{
+		Running:      true,
+		CollectionId: options.CollectionId,
+		Address:      "http://" + listener.Addr().String(),
+		Routes:       len(routes),
+		StartedAt:    time.Now(),
+	}
+	status := m.status
+	m.mu.Unlock()
+
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			m.mu.Lock()
+			if m.server == server {
+				m.status.Running = false
+			}
+			m.mu.Unlock()
+		}
+	}()
+
+	return status, nil
+}
+
+// Reload re-reads the routes of the running collection, e.g. after a mock
+// response was edited.
+func (m *MockServer) Reload() (MockServerStatus, error) {
+	status := m.Status()
+	if !status.Running {
+		return status, fmt.Errorf("mock server is not running")
+	}
+
+	routes, err := LoadMockRoutes(m.Repositories.Load(), status.CollectionId)
+	if err != nil {
+		return status, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.routes = routes
+	m.status.Routes = len(routes)
+	return m.status, nil
+}
+
+func (m *MockServer) Stop() error {
+	m.mu.Lock()
+	server := m.server
+	m.server = nil
+	m.status.Running = false
+	m.mu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
+
+func (m *MockServer) Status() MockServerStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+func (m *MockServer) Routes() []MockRoute {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockRoute{}, m.routes...)
+}
+
+// RequestLog returns the requests that hit the mock, newest last.
+func (m *MockServer) RequestLog() []models.MockRequestLog {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.MockRequestLog{}, m.requests...)
+}
+
+func (m *MockServer) ClearRequestLog() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = []models.MockRequestLog{}
+}
+
+func (m *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	body, readErr := io.ReadAll(http.MaxBytesReader(w, r.Body, mockRequestBodyLimit))
+
+	entry := models.MockRequestLog{
+		Time:    start,
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Query:   r.URL.RawQuery,
+		Headers: flattenHeaders(r.Header),
+		Body:    string(body),
+	}
+
+	m.mu.Lock()
+	routes := m.routes
+	m.mu.Unlock()
+
+	var route *MockRoute
+	var params map[string]string
+	for i := range routes {
+		if p, ok := routes[i].match(r.Method, r.URL.Path); ok {
+			route, params = &routes[i], p
+			break
+		}
+	}
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(readErr, &tooLarge):
+		entry.Status = http.StatusRequestEntityTooLarge
+		writeMockError(w, entry.Status, fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit))
+	case readErr != nil:
+		entry.Status = http.StatusBadRequest
+		writeMockError(w, entry.Status, fmt.Sprintf("failed to read request body: %v", readErr))
+	case route == nil:
+		entry.Status = http.StatusNotFound
+		writeMockError(w, entry.Status, fmt.Sprintf("no mock route for %s %s", r.Method, r.URL.Path))
+	case route.Response == nil:
+		entry.MatchedFileId, entry.MatchedName = &route.FileId, route.Name
+		entry.Status = http.StatusNotImplemented
+		writeMockError(w, entry.Status, fmt.Sprintf("request %q has no mock response", route.Name))
+	default:
+		entry.MatchedFileId, entry.MatchedName = &route.FileId, route.Name
+		entry.Status = serveMockResponse(w, r, *route.Response, mockTemplateData{
+			params:  params,
+			query:   r.URL.Query(),
+			headers: r.Header,
+			body:    body,
+		})
+	}
+
+	entry.DurationMs = time.Since(start).Milliseconds()
+	m.mu.Lock()
+	m.requests = append(m.requests, entry)
+	if len(m.requests) > mockRequestLogLimit {
+		m.requests = m.requests[len(m.requests)-mockRequestLogLimit:]
+	}
+	onRequest := m.OnRequest
+	m.mu.Unlock()
+
+	if onRequest != nil {
+		onRequest(entry)
+	}
+}
+
+func writeMockError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+func serveMockResponse(w http.ResponseWriter, r *http.Request, mock models.MockResponse, data mockTemplateData) int {
+	if mock.DelayMs > 0 {
+		select {
+		case <-time.After(time.Duration(mock.DelayMs) * time.Millisecond):
+		case <-r.Context().Done():
+			return 499
+		}
+	}
+
+	status := mock.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	for k, v := range mock.Headers {
+		w.Header().Set(k, renderMockTemplate(v, data))
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(status)
+	if mock.IsBinary {
+		body, err := base64.StdEncoding.DecodeString(mock.Body)
+		if err == nil {
+			w.Write(body)
+		}
+		return status
+	}
+	io.WriteString(w, renderMockTemplate(mock.Body, data))
+	return status
+}
+
+type mockTemplateData struct {
+	params  map[string]string
+	query   map[string][]string
+	headers http.Header
+	body    []byte
+}
+
+var mockTemplatePattern = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// renderMockTemplate fills request.* and $-prefixed dynamic values. Unknown
+// placeholders are kept as is.
+func renderMockTemplate(s string, data mockTemplateData) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	return mockTemplatePattern.ReplaceAllStringFunc(s, func(match string) string {
+		expr := mockTemplatePattern.FindStringSubmatch(match)[1]
+		if value, ok := mockTemplateValue(expr, data); ok {
+			return value
+		}
+		return match
+	})
+}
+
+func mockTemplateValue(expr string, data mockTemplateData) (string, bool) {
+	switch expr {
+	case "$uuid":
+		return newUUID(), true
+	case "$timestamp":
+		return strconv.FormatInt(time.Now().Unix(), 10), true
+	case "$isoTimestamp":
+		return time.Now().UTC().Format(time.RFC3339), true
+	case "$randomInt":
+		n, err := rand.Int(rand.Reader, big.NewInt(1000))
+		if err != nil {
+			return "0", true
+		}
+		return n.String(), true
+	}
+
+	if !strings.HasPrefix(expr, "request.") {
+		return "", false
+	}
+	source, key, _ := strings.Cut(strings.TrimPrefix(expr, "request."), ".")
+	switch source {
+	case "params":
+		value, ok := data.params[key]
+		return value, ok
+	case "query":
+		values, ok := data.query[key]
+		if !ok || len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	case "headers":
+		values := data.headers.Values(key)
+		if len(values) == 0 {
+			return "", false
+		}
+		return strings.Join(values, ", "), true
+	case "body":
+		if key == "" {
+			return string(data.body), true
+		}
+		var doc any
+		if err := json.Unmarshal(data.body, &doc); err != nil {
+			return "", false
+		}
+		value, ok := LookupJSONPath(doc, key)
+		if !ok {
+			return "", false
+		}
+		return jsonValueString(value), true
+	}
+	return "", false
+}
+
+// newUUID returns a random RFC 4122 version 4 UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestMockServerRequestBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body io.Reader
+		want int
+	}{
+		{"no route", strings.NewReader(`{"a":1}`), http.StatusNotFound},
+		{"too large", strings.NewReader(strings.Repeat("a", mockRequestBodyLimit+1)), http.StatusRequestEntityTooLarge},
+		{"read error", failingReader{}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewMockServer(nil)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/users", tt.body))
+			if recorder.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.want, recorder.Body)
+			}
+			if requests := server.requests; len(requests) != 1 || requests[0].Status != tt.want {
+				t.Errorf("logged requests %+v, want one with status %d", requests, tt.want)
+			}
+		})
+	}
+}
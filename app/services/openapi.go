@@ -0,0 +1,556 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"posto/app/models"
+	"posto/app/redact"
+	"posto/app/repositories"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// OpenApiDocument is the subset of OpenAPI 3.0 written by
+// ExportOpenApiDocument.
+type OpenApiDocument struct {
+	OpenApi    string                                  `json:"openapi"`
+	Info       OpenApiInfo                             `json:"info"`
+	Servers    []OpenApiServer                         `json:"servers,omitempty"`
+	Tags       []OpenApiTag                            `json:"tags,omitempty"`
+	Paths      map[string]map[string]*OpenApiOperation `json:"paths"`
+	Components *OpenApiComponents                      `json:"components,omitempty"`
+}
+
+type OpenApiInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type OpenApiServer struct {
+	Url       string                           `json:"url"`
+	Variables map[string]OpenApiServerVariable `json:"variables,omitempty"`
+}
+
+type OpenApiServerVariable struct {
+	Default string `json:"default"`
+}
+
+type OpenApiTag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenApiOperation struct {
+	Tags        []string                    `json:"tags,omitempty"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	OperationId string                      `json:"operationId"`
+	Parameters  []OpenApiParameter          `json:"parameters,omitempty"`
+	RequestBody *OpenApiRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenApiResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+}
+
+type OpenApiParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Schema   map[string]any `json:"schema"`
+	Example  any            `json:"example,omitempty"`
+}
+
+type OpenApiRequestBody struct {
+	Content map[string]*OpenApiMediaType `json:"content"`
+}
+
+type OpenApiResponse struct {
+	Description string                       `json:"description"`
+	Headers     map[string]OpenApiHeader     `json:"headers,omitempty"`
+	Content     map[string]*OpenApiMediaType `json:"content,omitempty"`
+}
+
+type OpenApiHeader struct {
+	Schema map[string]any `json:"schema"`
+}
+
+type OpenApiMediaType struct {
+	Schema   map[string]any            `json:"schema,omitempty"`
+	Example  any                       `json:"example,omitempty"`
+	Examples map[string]OpenApiExample `json:"examples,omitempty"`
+}
+
+type OpenApiExample struct {
+	Summary string `json:"summary,omitempty"`
+	Value   any    `json:"value"`
+}
+
+type OpenApiComponents struct {
+	SecuritySchemes map[string]map[string]string `json:"securitySchemes,omitempty"`
+}
+
+var (
+	openApiVariable      = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+	openApiServerPattern = regexp.MustCompile(`^(?:[a-zA-Z][a-zA-Z0-9+.\-]*://[^/?#]*|\{\{[^{}]+\}\})`)
+	openApiOperationWord = regexp.MustCompile(`[A-Za-z0-9]+`)
+)
+
+// Headers described through other parts of the document.
+var openApiSkippedHeaders = map[string]bool{
+	"content-type":   true,
+	"authorization":  true,
+	"accept":         true,
+	"content-length": true,
+	"host":           true,
+	"user-agent":     true,
+}
+
+// ExportOpenApiDocument reverse engineers an OpenAPI 3 document from the
+// requests of a collection. Url prefixes become servers, {{var}} segments
+// path parameters, folders tags, and schemas are inferred from JSON request
+// bodies and saved examples. Variables of environment, when given, are used
+// as server defaults and parameter examples. Values are redacted with the
+// exports policy.
+func ExportOpenApiDocument(repos *repositories.Repositories, collectionId int, environment *models.Environment) (OpenApiDocument, error) {
+	document := OpenApiDocument{
+		OpenApi: "3.0.3",
+		Info:    OpenApiInfo{Version: "1.0.0", Description: "Generated by Posto on " + time.Now().Format("2006-01-02")},
+		Paths:   map[string]map[string]*OpenApiOperation{},
+	}
+
+	collection, err := repos.Collection.SelectCollectionById(collectionId)
+	if err != nil {
+		return document, fmt.Errorf("error loading collection: %v", err)
+	}
+	document.Info.Title = collection.Name
+	if collection.Description != "" {
+		document.Info.Description = collection.Description
+	}
+
+	files, err := repos.File.SelectFilesByCollection(collectionId)
+	if err != nil {
+		return document, fmt.Errorf("error loading files: %v", err)
+	}
+	examples, err := repos.Example.SelectExamplesByCollection(collectionId)
+	if err != nil {
+		return document, fmt.Errorf("error loading examples: %v", err)
+	}
+
+	policy := redact.Exports()
+	vars := map[string]string{}
+	if environment != nil {
+		for key, value := range environment.VariableMap() {
+			if policy.IsKey(key) && value != "" {
+				value = redact.Marker
+			}
+			vars[key] = policy.Text(value)
+		}
+	}
+
+	servers := map[string]bool{}
+	tags := map[string]bool{}
+	folderDescriptions := map[int64]string{}
+	for _, file := range files {
+		if file.IsFolder {
+			folderDescriptions[file.PkFileId] = file.Description
+		}
+	}
+	securitySchemes := map[string]map[string]string{}
+	operationIds := map[string]bool{}
+
+	WalkRequests(BuildFileTree(files), func(node *FileNode) bool {
+		request := mirrorRequestFromFile(node.File)
+		method := strings.ToLower(request.Method)
+		// The scheme is told by the header before its value is redacted.
+		scheme := openApiSecurityScheme(request.Headers)
+		request.Url = policy.Url(request.Url)
+		request.Headers = policy.Headers(request.Headers)
+		request.Body = policy.Body(request.Body)
+
+		server, path, query := splitOpenApiUrl(request.Url)
+		if server != "" && !servers[server] {
+			servers[server] = true
+			document.Servers = append(document.Servers, openApiServer(server, vars))
+		}
+
+		pathItem, ok := document.Paths[path]
+		if !ok {
+			pathItem = map[string]*OpenApiOperation{}
+			document.Paths[path] = pathItem
+		}
+		operation, exists := pathItem[method]
+		if !exists {
+			operation = &OpenApiOperation{
+				Summary:     node.File.Name,
+				Description: node.File.Description,
+				OperationId: openApiOperationId(node.File.Name, method, operationIds),
+				Responses:   map[string]*OpenApiResponse{},
+			}
+			if len(node.Path) > 0 {
+				tag := strings.Join(node.Path, " / ")
+				operation.Tags = []string{tag}
+				if !tags[tag] {
+					tags[tag] = true
+					document.Tags = append(document.Tags, OpenApiTag{
+						Name:        tag,
+						Description: folderDescriptions[*node.File.ParentId],
+					})
+				}
+			}
+			operation.Parameters = openApiParameters(path, query, request.Headers, vars)
+			if scheme != nil {
+				securitySchemes[scheme.name] = scheme.definition
+				operation.Security = []map[string][]string{{scheme.name: {}}}
+			}
+			pathItem[method] = operation
+		}
+
+		if operation.RequestBody == nil && strings.TrimSpace(request.Body) != "" && method != "get" && method != "head" {
+			contentType := headerValue(request.Headers, "Content-Type")
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			operation.RequestBody = &OpenApiRequestBody{
+				Content: map[string]*OpenApiMediaType{openApiMediaType(contentType): openApiMedia(request.Body)},
+			}
+		}
+
+		for _, example := range examples[node.File.PkFileId] {
+			if !example.IsBinary {
+				example.Body = policy.Body(example.Body)
+			}
+			addOpenApiExample(operation, example)
+		}
+		if len(operation.Responses) == 0 {
+			operation.Responses["default"] = &OpenApiResponse{Description: "No saved response"}
+		} else if _, ok := operation.Responses["default"]; ok && len(operation.Responses) > 1 {
+			delete(operation.Responses, "default")
+		}
+		return true
+	})
+
+	if len(securitySchemes) > 0 {
+		document.Components = &OpenApiComponents{SecuritySchemes: securitySchemes}
+	}
+	return document, nil
+}
+
+func WriteOpenApiDocument(path string, document OpenApiDocument) error {
+	content, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing OpenAPI document: %v", err)
+	}
+	return nil
+}
+
+// splitOpenApiUrl splits a stored url into the server part (scheme and host
+// or a leading {{variable}}), the OpenAPI path and the query.
+func splitOpenApiUrl(rawUrl string) (string, string, url.Values) {
+	rawUrl = strings.TrimSpace(rawUrl)
+	server := openApiServerPattern.FindString(rawUrl)
+	rest := strings.TrimPrefix(rawUrl, server)
+
+	if idx := strings.Index(rest, "#"); idx >= 0 {
+		rest = rest[:idx]
+	}
+	query := url.Values{}
+	if path, rawQuery, ok := strings.Cut(rest, "?"); ok {
+		rest = path
+		query, _ = url.ParseQuery(rawQuery)
+	}
+	if !strings.HasPrefix(rest, "/") {
+		rest = "/" + rest
+	}
+	return server, openApiVariable.ReplaceAllString(rest, "{$1}"), query
+}
+
+func openApiServer(server string, vars map[string]string) OpenApiServer {
+	result := OpenApiServer{Url: openApiVariable.ReplaceAllString(server, "{$1}")}
+	for _, match := range openApiVariable.FindAllStringSubmatch(server, -1) {
+		if result.Variables == nil {
+			result.Variables = map[string]OpenApiServerVariable{}
+		}
+		value, ok := vars[match[1]]
+		if !ok {
+			value = match[1]
+		}
+		result.Variables[match[1]] = OpenApiServerVariable{Default: value}
+	}
+	return result
+}
+
+var openApiPathParameter = regexp.MustCompile(`\{([^{}]+)\}`)
+
+func openApiParameters(path string, query url.Values, headers map[string]string, vars map[string]string) []OpenApiParameter {
+	parameters := []OpenApiParameter{}
+	for _, match := range openApiPathParameter.FindAllStringSubmatch(path, -1) {
+		parameter := OpenApiParameter{Name: match[1], In: "path", Required: true, Schema: map[string]any{"type": "string"}}
+		if value, ok := vars[match[1]]; ok {
+			parameter.Schema = inferOpenApiSchema(parseScalar(value))
+			parameter.Example = parseScalar(value)
+		}
+		parameters = append(parameters, parameter)
+	}
+
+	for _, name := range sortedKeys(query) {
+		value := query.Get(name)
+		parameter := OpenApiParameter{Name: name, In: "query", Schema: map[string]any{"type": "string"}}
+		if !openApiVariable.MatchString(value) {
+			parameter.Schema = inferOpenApiSchema(parseScalar(value))
+			parameter.Example = parseScalar(value)
+		}
+		parameters = append(parameters, parameter)
+	}
+
+	for _, name := range sortedKeys(headers) {
+		if openApiSkippedHeaders[strings.ToLower(name)] {
+			continue
+		}
+		parameter := OpenApiParameter{Name: name, In: "header", Schema: map[string]any{"type": "string"}}
+		if value := headers[name]; !openApiVariable.MatchString(value) {
+			parameter.Example = value
+		}
+		parameters = append(parameters, parameter)
+	}
+	return parameters
+}
+
+type openApiScheme struct {
+	name       string
+	definition map[string]string
+}
+
+func openApiSecurityScheme(headers map[string]string) *openApiScheme {
+	authorization := strings.ToLower(headerValue(headers, "Authorization"))
+	switch {
+	case strings.HasPrefix(authorization, "bearer "):
+		return &openApiScheme{"bearerAuth", map[string]string{"type": "http", "scheme": "bearer"}}
+	case strings.HasPrefix(authorization, "basic "):
+		return &openApiScheme{"basicAuth", map[string]string{"type": "http", "scheme": "basic"}}
+	}
+	return nil
+}
+
+func headerValue(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// openApiMediaType drops parameters such as charset from a content type.
+func openApiMediaType(contentType string) string {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	if mediaType == "" {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+// openApiMedia infers the schema of JSON bodies, other bodies are described
+// as strings.
+func openApiMedia(body string) *OpenApiMediaType {
+	var value any
+	if err := json.Unmarshal([]byte(body), &value); err == nil {
+		return &OpenApiMediaType{Schema: inferOpenApiSchema(value), Example: value}
+	}
+	return &OpenApiMediaType{Schema: map[string]any{"type": "string"}, Example: body}
+}
+
+func addOpenApiExample(operation *OpenApiOperation, example models.Example) {
+	status := strconv.Itoa(example.StatusCode)
+	response, ok := operation.Responses[status]
+	if !ok {
+		description := http.StatusText(example.StatusCode)
+		if description == "" {
+			description = example.Name
+		}
+		response = &OpenApiResponse{Description: description}
+		operation.Responses[status] = response
+	}
+
+	for name := range example.Headers {
+		if openApiSkippedHeaders[strings.ToLower(name)] {
+			continue
+		}
+		if response.Headers == nil {
+			response.Headers = map[string]OpenApiHeader{}
+		}
+		response.Headers[name] = OpenApiHeader{Schema: map[string]any{"type": "string"}}
+	}
+
+	if example.IsBinary {
+		if response.Content == nil {
+			response.Content = map[string]*OpenApiMediaType{}
+		}
+		response.Content[openApiMediaType(example.ContentType)] = &OpenApiMediaType{
+			Schema: map[string]any{"type": "string", "format": "binary"},
+		}
+		return
+	}
+	if strings.TrimSpace(example.Body) == "" {
+		return
+	}
+
+	if response.Content == nil {
+		response.Content = map[string]*OpenApiMediaType{}
+	}
+	mediaType := openApiMediaType(example.ContentType)
+	inferred := openApiMedia(example.Body)
+	media, ok := response.Content[mediaType]
+	if !ok {
+		media = &OpenApiMediaType{Schema: inferred.Schema, Examples: map[string]OpenApiExample{}}
+		response.Content[mediaType] = media
+	} else {
+		media.Schema = mergeOpenApiSchemas(media.Schema, inferred.Schema)
+	}
+	key := example.Name
+	for i := 2; ; i++ {
+		if _, taken := media.Examples[key]; !taken {
+			break
+		}
+		key = fmt.Sprintf("%s %d", example.Name, i)
+	}
+	media.Examples[key] = OpenApiExample{Summary: example.Name, Value: inferred.Example}
+}
+
+// inferOpenApiSchema describes a decoded JSON value. Array items are merged
+// so that optional properties of later elements are included.
+func inferOpenApiSchema(value any) map[string]any {
+	switch v := value.(type) {
+	case nil:
+		return map[string]any{"nullable": true}
+	case bool:
+		return map[string]any{"type": "boolean"}
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return map[string]any{"type": "integer"}
+		}
+		return map[string]any{"type": "number"}
+	case string:
+		schema := map[string]any{"type": "string"}
+		if _, err := time.Parse(time.RFC3339, v); err == nil {
+			schema["format"] = "date-time"
+		} else if _, err := time.Parse("2006-01-02", v); err == nil {
+			schema["format"] = "date"
+		}
+		return schema
+	case []any:
+		var items map[string]any
+		for _, item := range v {
+			items = mergeOpenApiSchemas(items, inferOpenApiSchema(item))
+		}
+		if items == nil {
+			items = map[string]any{}
+		}
+		return map[string]any{"type": "array", "items": items}
+	case map[string]any:
+		properties := map[string]any{}
+		for key, item := range v {
+			properties[key] = inferOpenApiSchema(item)
+		}
+		return map[string]any{"type": "object", "properties": properties}
+	}
+	return map[string]any{}
+}
+
+// mergeOpenApiSchemas combines two inferred schemas. Object properties are
+// united, differing types fall back to the first one.
+func mergeOpenApiSchemas(a, b map[string]any) map[string]any {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if _, ok := a["type"]; !ok {
+		if a["nullable"] == true {
+			merged := copySchema(b)
+			merged["nullable"] = true
+			return merged
+		}
+		return b
+	}
+	if a["type"] == "integer" && b["type"] == "number" {
+		return b
+	}
+	if a["type"] != b["type"] {
+		return a
+	}
+	merged := copySchema(a)
+	switch a["type"] {
+	case "object":
+		properties := map[string]any{}
+		for key, schema := range a["properties"].(map[string]any) {
+			properties[key] = schema
+		}
+		for key, schema := range b["properties"].(map[string]any) {
+			if existing, ok := properties[key].(map[string]any); ok {
+				properties[key] = mergeOpenApiSchemas(existing, schema.(map[string]any))
+			} else {
+				properties[key] = schema
+			}
+		}
+		merged["properties"] = properties
+	case "array":
+		merged["items"] = mergeOpenApiSchemas(a["items"].(map[string]any), b["items"].(map[string]any))
+	}
+	return merged
+}
+
+func copySchema(schema map[string]any) map[string]any {
+	copied := map[string]any{}
+	for key, value := range schema {
+		copied[key] = value
+	}
+	return copied
+}
+
+// parseScalar decodes numbers and booleans of query strings and variables.
+func parseScalar(value string) any {
+	var decoded any
+	if err := json.Unmarshal([]byte(value), &decoded); err == nil {
+		switch decoded.(type) {
+		case float64, bool:
+			return decoded
+		}
+	}
+	return value
+}
+
+// openApiOperationId builds a unique lowerCamelCase id from a request name.
+func openApiOperationId(name string, method string, used map[string]bool) string {
+	words := openApiOperationWord.FindAllString(name, -1)
+	if len(words) == 0 {
+		words = []string{method, "request"}
+	}
+	var id strings.Builder
+	for i, word := range words {
+		runes := []rune(strings.ToLower(word))
+		if i > 0 {
+			runes[0] = unicode.ToUpper(runes[0])
+		}
+		id.WriteString(string(runes))
+	}
+
+	base := id.String()
+	unique := base
+	for i := 2; used[unique]; i++ {
+		unique = base + strconv.Itoa(i)
+	}
+	used[unique] = true
+	return unique
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	proxyCACertFile = "proxy-ca.crt"
+	proxyCAKeyFile  = "proxy-ca.key"
+)
+
+// ProxyCA is the local certificate authority used to intercept HTTPS traffic.
+// Its certificate has to be trusted by the device whose traffic is recorded.
+type ProxyCA struct {
+	CertPath string
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+
+	mu    sync.Mutex
+	leafs map[string]*tls.Certificate
+}
+
+// LoadOrCreateProxyCA reads the CA from dir, generating and saving a new one
+// on first use so the user only has to trust it once.
+func LoadOrCreateProxyCA(dir string) (*ProxyCA, error) {
+	certPath := filepath.Join(dir, proxyCACertFile)
+	keyPath := filepath.Join(dir, proxyCAKeyFile)
+
+	certPEM, certErr := os.ReadFile(certPath)
+	keyPEM, keyErr := os.ReadFile(keyPath)
+	if certErr == nil && keyErr == nil {
+		return parseProxyCA(certPath, certPEM, keyPEM)
+	}
+	if !os.IsNotExist(certErr) && certErr != nil {
+		return nil, fmt.Errorf("error reading proxy CA certificate: %v", certErr)
+	}
+	if !os.IsNotExist(keyErr) && keyErr != nil {
+		return nil, fmt.Errorf("error reading proxy CA key: %v", keyErr)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating proxy CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "Posto Local Proxy CA", Organization: []string{"Posto"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating proxy CA certificate: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return nil, fmt.Errorf("error saving proxy CA key: %v", err)
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return nil, fmt.Errorf("error saving proxy CA certificate: %v", err)
+	}
+
+	return parseProxyCA(certPath, certPEM, keyPEM)
+}
+
+func parseProxyCA(certPath string, certPEM []byte, keyPEM []byte) (*ProxyCA, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, fmt.Errorf("invalid proxy CA files in %s", filepath.Dir(certPath))
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing proxy CA certificate: %v", err)
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing proxy CA key: %v", err)
+	}
+	return &ProxyCA{CertPath: certPath, cert: cert, key: key, leafs: map[string]*tls.Certificate{}}, nil
+}
+
+// CertificatePEM returns the CA certificate to install on client devices.
+func (c *ProxyCA) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+}
+
+// LeafCertificate returns a certificate for host signed by the CA, generated
+// once per host.
+func (c *ProxyCA) LeafCertificate(host string) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if leaf, ok := c.leafs[host]; ok {
+		return leaf, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: host, Organization: []string{"Posto"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(0, 0, 30),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, c.cert, &key.PublicKey, c.key)
+	if err != nil {
+		return nil, err
+	}
+	leaf := &tls.Certificate{Certificate: [][]byte{der, c.cert.Raw}, PrivateKey: key}
+	c.leafs[host] = leaf
+	return leaf, nil
+}
+
+func randomSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
@@ -0,0 +1,527 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"posto/app/models"
+	"posto/app/repositories"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	proxyCaptureLimit     = 1000
+	proxyCaptureBodyLimit = 1 << 20
+)
+
+// hop-by-hop headers are never forwarded nor saved into requests.
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+type ProxyOptions struct {
+	Host           string `json:"host"`
+	Port           int    `json:"port"`
+	InterceptHttps bool   `json:"intercept_https"`
+}
+
+type ProxyStatus struct {
+	Running        bool      `json:"running"`
+	Address        string    `json:"address"`
+	InterceptHttps bool      `json:"intercept_https"`
+	CACertPath     string    `json:"ca_cert_path,omitempty"`
+	StartedAt      time.Time `json:"started_at"`
+}
+
+// RecordingProxy is an HTTP forward proxy recording every request/response
+// pair going through it. With InterceptHttps, CONNECT tunnels are terminated
+// with certificates signed by the local ProxyCA so HTTPS traffic is recorded
+// as well; otherwise tunnels are passed through untouched.
+type RecordingProxy struct {
+	// CADir is where the proxy CA is loaded from or created in.
+	CADir string
+	// OnCapture is called after every recorded exchange.
+	OnCapture func(capture models.ProxyCapture)
+
+	mu        sync.Mutex
+	server    *http.Server
+	status    ProxyStatus
+	ca        *ProxyCA
+	captures  []models.ProxyCapture
+	nextId    int64
+	transport *http.Transport
+}
+
+func NewRecordingProxy(caDir string) *RecordingProxy {
+	return &RecordingProxy{
+		CADir:    caDir,
+		captures: []models.ProxyCapture{},
+		transport: &http.Transport{
+			Proxy:               nil,
+			ForceAttemptHTTP2:   false,
+			MaxIdleConnsPerHost: 4,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// CA returns the proxy CA, creating it on first use.
+func (p *RecordingProxy) CA() (*ProxyCA, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ca == nil {
+		ca, err := LoadOrCreateProxyCA(p.CADir)
+		if err != nil {
+			return nil, err
+		}
+		p.ca = ca
+	}
+	return p.ca, nil
+}
+
+func (p *RecordingProxy) Start(options ProxyOptions) (ProxyStatus, error) {
+	if err := p.Stop(); err != nil {
+		return p.Status(), err
+	}
+
+	caCertPath := ""
+	if options.InterceptHttps {
+		ca, err := p.CA()
+		if err != nil {
+			return p.Status(), err
+		}
+		caCertPath = ca.CertPath
+	}
+
+	host := options.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(options.Port)))
+	if err != nil {
+		return p.Status(), fmt.Errorf("error starting proxy: %v", err)
+	}
+
+	server := &http.Server{Handler: p}
+
+	p.mu.Lock()
+	p.server = server
+	p.status = ProxyStatus{
+		Running:        true,
+		Address:        listener.Addr().String(),
+		InterceptHttps: options.InterceptHttps,
+		CACertPath:     caCertPath,
+		StartedAt:      time.Now(),
+	}
+	status := p.status
+	p.mu.Unlock()
+
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			p.mu.Lock()
+			if p.server == server {
+				p.status.Running = false
+			}
+			p.mu.Unlock()
+		}
+	}()
+
+	return status, nil
+}
+
+func (p *RecordingProxy) Stop() error {
+	p.mu.Lock()
+	server := p.server
+	p.server = nil
+	p.status.Running = false
+	p.mu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// hijacked tunnels are not tracked by Shutdown, they end with their peers
+	return server.Shutdown(ctx)
+}
+
+func (p *RecordingProxy) Status() ProxyStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+// Captures returns the recorded exchanges, oldest first.
+func (p *RecordingProxy) Captures() []models.ProxyCapture {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]models.ProxyCapture{}, p.captures...)
+}
+
+func (p *RecordingProxy) Capture(id int64) (models.ProxyCapture, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, capture := range p.captures {
+		if capture.Id == id {
+			return capture, true
+		}
+	}
+	return models.ProxyCapture{}, false
+}
+
+func (p *RecordingProxy) ClearCaptures() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.captures = []models.ProxyCapture{}
+}
+
+func (p *RecordingProxy) record(capture models.ProxyCapture) {
+	p.mu.Lock()
+	p.nextId++
+	capture.Id = p.nextId
+	p.captures = append(p.captures, capture)
+	if len(p.captures) > proxyCaptureLimit {
+		p.captures = p.captures[len(p.captures)-proxyCaptureLimit:]
+	}
+	onCapture := p.OnCapture
+	p.mu.Unlock()
+
+	if onCapture != nil {
+		onCapture(capture)
+	}
+}
+
+func (p *RecordingProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.handleConnect(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "This is the Posto recording proxy, configure it as the HTTP proxy of your client", http.StatusBadRequest)
+		return
+	}
+	p.forward(w, r, r.URL.String())
+}
+
+// forward sends r to targetUrl, streams the response back and records both.
+func (p *RecordingProxy) forward(w http.ResponseWriter, r *http.Request, targetUrl string) {
+	start := time.Now()
+	capture := models.ProxyCapture{
+		Time:           start,
+		Method:         r.Method,
+		Url:            targetUrl,
+		RequestHeaders: flattenHeaders(withoutHopHeaders(r.Header)),
+	}
+
+	requestBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	capture.RequestBody, capture.RequestTruncated = limitCaptureBody(requestBody)
+
+	outReq, err := http.NewRequestWithContext(r.Context(), r.Method, targetUrl, bytes.NewReader(requestBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	outReq.Header = withoutHopHeaders(r.Header)
+	outReq.ContentLength = int64(len(requestBody))
+
+	resp, err := p.transport.RoundTrip(outReq)
+	if err != nil {
+		capture.Error = err.Error()
+		capture.StatusCode = http.StatusBadGateway
+		capture.DurationMs = time.Since(start).Milliseconds()
+		p.record(capture)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for k, v := range withoutHopHeaders(resp.Header) {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	buffer := &limitedBuffer{limit: proxyCaptureBodyLimit}
+	_, copyErr := io.Copy(w, io.TeeReader(resp.Body, buffer))
+
+	capture.StatusCode = resp.StatusCode
+	capture.ResponseHeaders = flattenHeaders(resp.Header)
+	capture.ContentType = resp.Header.Get("Content-Type")
+	capture.DurationMs = time.Since(start).Milliseconds()
+	if copyErr != nil {
+		capture.Error = copyErr.Error()
+	}
+
+	responseBody := buffer.Bytes()
+	if !buffer.truncated && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		if decoded, err := gunzip(responseBody); err == nil {
+			responseBody = decoded
+		}
+	}
+	capture.ResponseTruncated = buffer.truncated
+	if IsTextContentType(capture.ContentType) {
+		capture.ResponseBody = string(responseBody)
+	} else {
+		capture.ResponseBody = base64.StdEncoding.EncodeToString(responseBody)
+		capture.IsBinary = true
+	}
+
+	p.record(capture)
+}
+
+func (p *RecordingProxy) handleConnect(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+
+	if !p.Status().InterceptHttps {
+		upstream, err := net.DialTimeout("tcp", r.Host, 15*time.Second)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		client, _, err := hijacker.Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		io.WriteString(client, "HTTP/1.1 200 Connection Established\r\n\r\n")
+		go tunnel(client, upstream)
+		return
+	}
+
+	ca, err := p.CA()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+
+	client, _, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	io.WriteString(client, "HTTP/1.1 200 Connection Established\r\n\r\n")
+
+	tlsConn := tls.Server(client, &tls.Config{
+		NextProtos: []string{"http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hello.ServerName
+			if name == "" {
+				name = host
+			}
+			return ca.LeafCertificate(name)
+		},
+	})
+	if err := tlsConn.Handshake(); err != nil {
+		tlsConn.Close()
+		return
+	}
+
+	authority := r.Host
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		target := "https://" + authority + req.URL.RequestURI()
+		p.forward(w, req, target)
+	})
+	go (&http.Server{Handler: handler}).Serve(newSingleConnListener(tlsConn))
+}
+
+func tunnel(a net.Conn, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(a, b); done <- struct{}{} }()
+	go func() { io.Copy(b, a); done <- struct{}{} }()
+	<-done
+	a.Close()
+	b.Close()
+}
+
+func withoutHopHeaders(header http.Header) http.Header {
+	cleaned := header.Clone()
+	for _, h := range hopHeaders {
+		cleaned.Del(h)
+	}
+	return cleaned
+}
+
+func limitCaptureBody(body []byte) (string, bool) {
+	if len(body) > proxyCaptureBodyLimit {
+		return string(body[:proxyCaptureBodyLimit]), true
+	}
+	return string(body), false
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// limitedBuffer keeps the first limit bytes written to it and silently
+// drops the rest.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	room := b.limit - b.Len()
+	if room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// singleConnListener hands a single already accepted connection to an
+// http.Server, which then serves keep-alive requests on it.
+type singleConnListener struct {
+	conn   net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	return &singleConnListener{conn: &notifyCloseConn{Conn: conn}, closed: make(chan struct{})}
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	var conn net.Conn
+	l.once.Do(func() {
+		conn = l.conn
+		l.conn.(*notifyCloseConn).onClose = func() { close(l.closed) }
+	})
+	if conn != nil {
+		return conn, nil
+	}
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+func (l *singleConnListener) Close() error {
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+type notifyCloseConn struct {
+	net.Conn
+	closeOnce sync.Once
+	onClose   func()
+}
+
+func (c *notifyCloseConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		if c.onClose != nil {
+			c.onClose()
+		}
+	})
+	return err
+}
+
+// SaveProxyCaptures stores captures as new request files in a collection,
+// below parentId when given, all of them or none. The captured response is
+// saved as an example of the new request. Bodies cut at the capture limit
+// are marked: a cut request body is left out and noted in the description,
+// an example with a cut body is named so. It returns the ids of the created
+// files.
+func SaveProxyCaptures(repos *repositories.Repositories, captures []models.ProxyCapture, collectionId int, parentId *int) ([]int, error) {
+	requests := []repositories.NewRequest{}
+	for _, capture := range captures {
+		headers := map[string]string{}
+		for k, v := range capture.RequestHeaders {
+			switch http.CanonicalHeaderKey(k) {
+			case "Content-Length", "Accept-Encoding", "Host":
+				continue
+			}
+			headers[k] = v
+		}
+		headersJson, err := marshalStringMap(headers)
+		if err != nil {
+			return nil, err
+		}
+		request := repositories.NewRequest{
+			Name:    captureName(capture),
+			Method:  capture.Method,
+			Url:     capture.Url,
+			Headers: headersJson,
+		}
+		if capture.RequestTruncated {
+			request.Description = fmt.Sprintf("The captured body was larger than %d MB and was left out.", proxyCaptureBodyLimit>>20)
+		} else if capture.RequestBody != "" {
+			body := capture.RequestBody
+			request.Body = &body
+		}
+
+		if capture.Error == "" {
+			responseHeaders := map[string]string{}
+			for k, v := range capture.ResponseHeaders {
+				if http.CanonicalHeaderKey(k) == "Content-Encoding" {
+					// the stored body is already decoded
+					continue
+				}
+				responseHeaders[k] = v
+			}
+			example := models.Example{
+				Name:        "Captured response",
+				StatusCode:  capture.StatusCode,
+				ContentType: capture.ContentType,
+				Headers:     responseHeaders,
+				Body:        capture.ResponseBody,
+				IsBinary:    capture.IsBinary,
+			}
+			if capture.ResponseTruncated {
+				example.Name = fmt.Sprintf("Captured response (first %d MB)", proxyCaptureBodyLimit>>20)
+			}
+			request.Examples = []models.Example{example}
+		}
+		requests = append(requests, request)
+	}
+	return repos.File.InsertRequests(collectionId, parentId, requests)
+}
+
+// captureName is "METHOD /path" without the query string.
+func captureName(capture models.ProxyCapture) string {
+	path := capture.Url
+	if idx := strings.Index(path, "://"); idx >= 0 {
+		path = path[idx+3:]
+		if slash := strings.Index(path, "/"); slash >= 0 {
+			path = path[slash:]
+		} else {
+			path = "/"
+		}
+	}
+	if idx := strings.IndexAny(path, "?#"); idx >= 0 {
+		path = path[:idx]
+	}
+	return capture.Method + " " + path
+}
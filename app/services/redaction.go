@@ -0,0 +1,89 @@
+package services
+
+import (
+	"posto/app/models"
+	"posto/app/redact"
+	"strings"
+)
+
+// The helpers below return redacted copies, the values they are given are
+// left untouched. A nil policy returns them as is.
+
+func redactSentRequest(policy *redact.Policy, sent SentRequest) SentRequest {
+	if policy == nil {
+		return sent
+	}
+	sent.Url = policy.Url(sent.Url)
+	sent.Headers = policy.Headers(sent.Headers)
+	sent.Body = policy.Body(sent.Body)
+	return sent
+}
+
+func redactResponse(policy *redact.Policy, resp models.HttpResponse) models.HttpResponse {
+	if policy == nil {
+		return resp
+	}
+	resp.Headers = policy.Headers(resp.Headers)
+	if !resp.IsBinary {
+		resp.Body = policy.Body(resp.Body)
+	}
+	wire := []models.WireExchange{}
+	for _, exchange := range resp.Wire {
+		exchange.Request = policy.Message(exchange.Request)
+		exchange.Response = policy.Message(exchange.Response)
+		exchange.Error = policy.Url(exchange.Error)
+		wire = append(wire, exchange)
+	}
+	if resp.Wire != nil {
+		resp.Wire = wire
+	}
+	return resp
+}
+
+func redactRunResult(policy *redact.Policy, result RunResult) RunResult {
+	if policy == nil {
+		return result
+	}
+	requests := []RequestRunResult{}
+	for _, request := range result.Requests {
+		request.Url = policy.Url(request.Url)
+		request.Error = policy.Url(request.Error)
+		if request.Request != nil {
+			sent := redactSentRequest(policy, *request.Request)
+			request.Request = &sent
+		}
+		if request.Response != nil {
+			resp := redactResponse(policy, *request.Response)
+			request.Response = &resp
+		}
+		assertions := []models.AssertionResult{}
+		for _, assertion := range request.Assertions {
+			assertions = append(assertions, redactAssertionResult(policy, assertion))
+		}
+		request.Assertions = assertions
+		requests = append(requests, request)
+	}
+	result.Requests = requests
+	return result
+}
+
+// redactAssertionResult removes the actual value of assertions on a
+// sensitive header or JSON field, also from the message quoting it.
+func redactAssertionResult(policy *redact.Policy, result models.AssertionResult) models.AssertionResult {
+	actual := policy.Text(result.Actual)
+	property := result.Assertion.Property
+	switch result.Assertion.Source {
+	case "header":
+		actual = policy.Header(property, result.Actual)
+	case "json":
+		if policy.IsKey(property[strings.LastIndex(property, ".")+1:]) && result.Actual != "" {
+			actual = redact.Marker
+		}
+	}
+	if actual != result.Actual && result.Actual != "" {
+		result.Message = strings.ReplaceAll(result.Message, result.Actual, actual)
+	}
+	result.Actual = actual
+	result.Message = policy.Text(result.Message)
+	return result
+}
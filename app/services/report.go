@@ -0,0 +1,221 @@
+package services
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"posto/app/redact"
+	"strings"
+)
+
+const (
+	ReportFormatJUnit = "junit"
+	ReportFormatJSON  = "json"
+	ReportFormatHTML  = "html"
+	ReportFormatHAR   = "har"
+)
+
+var ReportFormats = []string{ReportFormatJUnit, ReportFormatJSON, ReportFormatHTML, ReportFormatHAR}
+
+// WriteRunReport renders a collection run in the given format to path,
+// creating missing parent directories.
+func WriteRunReport(result RunResult, format string, path string) error {
+	if path == "" {
+		return fmt.Errorf("report path is empty")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating report directory: %v", err)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating report file: %v", err)
+	}
+	defer file.Close()
+
+	if err := RenderRunReport(file, result, format); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// RenderRunReport writes result in format, redacted with the exports policy.
+func RenderRunReport(w io.Writer, result RunResult, format string) error {
+	result = redactRunResult(redact.Exports(), result)
+	switch format {
+	case ReportFormatJUnit:
+		return renderJUnitReport(w, result)
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	case ReportFormatHTML:
+		return htmlReportTemplate.Execute(w, result)
+	case ReportFormatHAR:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(RunResultToHar(result))
+	default:
+		return fmt.Errorf("unknown report format %q, expected one of %s", format, strings.Join(ReportFormats, ", "))
+	}
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func junitSeconds(ms int64) string {
+	return fmt.Sprintf("%.3f", float64(ms)/1000)
+}
+
+// renderJUnitReport writes one testsuite per collection and one testcase per
+// request. Failed assertions become <failure>, transport errors <error>.
+func renderJUnitReport(w io.Writer, result RunResult) error {
+	suite := junitTestSuite{
+		Name:      result.CollectionName,
+		Tests:     result.Total,
+		Time:      junitSeconds(result.DurationMs),
+		Timestamp: result.StartedAt.Format("2006-01-02T15:04:05"),
+		Cases:     []junitTestCase{},
+	}
+
+	for _, request := range result.Requests {
+		testCase := junitTestCase{
+			Name:      request.FullName(),
+			ClassName: strings.Join(append([]string{result.CollectionName}, request.Path...), "."),
+			Time:      junitSeconds(request.DurationMs),
+			SystemOut: fmt.Sprintf("%s %s", request.Method, request.Url),
+		}
+		if request.Response != nil {
+			testCase.SystemOut += fmt.Sprintf(" -> %d", request.Response.StatusCode)
+		}
+
+		if request.Error != "" {
+			suite.Errors++
+			testCase.Error = &junitMessage{Message: request.Error, Type: "RequestError", Text: request.Error}
+		} else if !request.Passed {
+			suite.Failures++
+			messages := []string{}
+			for _, assertion := range request.Assertions {
+				if !assertion.Passed {
+					messages = append(messages, assertion.Message)
+				}
+			}
+			testCase.Failure = &junitMessage{
+				Message: fmt.Sprintf("%d assertion(s) failed", len(messages)),
+				Type:    "AssertionError",
+				Text:    strings.Join(messages, "\n"),
+			}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	suites := junitTestSuites{
+		Name:     result.CollectionName,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"fullName": func(r RequestRunResult) string { return r.FullName() },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.CollectionName}} - Posto run report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Roboto, sans-serif; margin: 2rem; background: #1b2636; color: #e6e6e6; }
+h1 { font-size: 1.4rem; margin-bottom: .25rem; }
+.summary { color: #aab; margin-bottom: 1.5rem; }
+.request { border: 1px solid #334; border-radius: 6px; margin-bottom: .75rem; padding: .75rem 1rem; }
+.request.pass { border-left: 4px solid #3fb950; }
+.request.fail { border-left: 4px solid #f85149; }
+.method { font-weight: bold; display: inline-block; min-width: 4rem; }
+.meta { color: #aab; font-size: .85rem; }
+table { border-collapse: collapse; margin-top: .5rem; font-size: .85rem; }
+td, th { text-align: left; padding: .2rem .75rem .2rem 0; }
+.ok { color: #3fb950; }
+.ko { color: #f85149; }
+.error { color: #f85149; margin-top: .5rem; }
+</style>
+</head>
+<body>
+<h1>{{.CollectionName}}</h1>
+<div class="summary">
+{{.Total}} requests &middot; <span class="ok">{{.Passed}} passed</span> &middot; <span class="ko">{{.Failed}} failed</span> &middot; {{.DurationMs}}ms
+{{if .EnvironmentName}}&middot; environment {{.EnvironmentName}}{{end}}
+&middot; started {{.StartedAt.Format "2006-01-02 15:04:05"}}
+</div>
+{{range .Requests}}
+<div class="request {{if .Passed}}pass{{else}}fail{{end}}">
+  <div><span class="method">{{.Method}}</span> {{fullName .}}</div>
+  <div class="meta">{{.Url}}{{if .Response}} &middot; status {{.Response.StatusCode}}{{end}} &middot; {{.DurationMs}}ms</div>
+  {{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+  {{if .Assertions}}
+  <table>
+    <tr><th></th><th>Assertion</th><th>Expected</th><th>Actual</th></tr>
+    {{range .Assertions}}
+    <tr>
+      <td>{{if .Passed}}<span class="ok">&#10003;</span>{{else}}<span class="ko">&#10007;</span>{{end}}</td>
+      <td>{{.Assertion.Source}} {{.Assertion.Property}} {{.Assertion.Operator}}</td>
+      <td>{{.Assertion.Expected}}</td>
+      <td>{{.Actual}}{{if .Message}}<div class="ko">{{.Message}}</div>{{end}}</td>
+    </tr>
+    {{end}}
+  </table>
+  {{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// responsePreviewSize is the size of the start of a streamed body
+	// returned in HttpResponse.Body.
+	responsePreviewSize = 256 << 10
+	// maxResponseBodies is the number of streamed bodies kept, older ones
+	// are removed.
+	maxResponseBodies = 20
+	// progressInterval is the time between two progress reports.
+	progressInterval = 100 * time.Millisecond
+)
+
+// ProgressFunc is called while a response body is read with the bytes
+// received so far and the expected total, -1 when the server did not tell
+// it. done is set on the last call.
+type ProgressFunc func(received int64, total int64, done bool)
+
+// ResponseBodies are the temporary files holding response bodies larger
+// than the memory limit, known by the id returned in HttpResponse.BodyId.
+type ResponseBodies struct {
+	mu  sync.Mutex
+	dir string
+	ids []string
+}
+
+func NewResponseBodies() *ResponseBodies {
+	return &ResponseBodies{dir: filepath.Join(os.TempDir(), "posto-responses")}
+}
+
+// create opens a new body file, removing the oldest one when there are
+// too many.
+func (b *ResponseBodies) create() (*os.File, string, error) {
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return nil, "", fmt.Errorf("error creating response directory: %v", err)
+	}
+	file, err := os.CreateTemp(b.dir, "body-*")
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating response file: %v", err)
+	}
+	id := filepath.Base(file.Name())
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ids = append(b.ids, id)
+	for len(b.ids) > maxResponseBodies {
+		os.Remove(filepath.Join(b.dir, b.ids[0]))
+		b.ids = b.ids[1:]
+	}
+	return file, id, nil
+}
+
+// path returns the file of a body, only for bodies created by b so that
+// ids cannot name other files.
+func (b *ResponseBodies) path(id string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, known := range b.ids {
+		if known == id {
+			return filepath.Join(b.dir, id), nil
+		}
+	}
+	return "", fmt.Errorf("the response body is no longer available, send the request again")
+}
+
+func (b *ResponseBodies) remove(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, known := range b.ids {
+		if known == id {
+			os.Remove(filepath.Join(b.dir, id))
+			b.ids = append(b.ids[:i], b.ids[i+1:]...)
+			return
+		}
+	}
+}
+
+// SaveTo copies the body to path.
+func (b *ResponseBodies) SaveTo(id string, path string) error {
+	source, err := b.path(id)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %v", err)
+	}
+	defer in.Close()
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating file: %v", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("error writing file: %v", err)
+	}
+	return out.Close()
+}
+
+// RemoveAll deletes every body file, when the app exits.
+func (b *ResponseBodies) RemoveAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, id := range b.ids {
+		os.Remove(filepath.Join(b.dir, id))
+	}
+	b.ids = nil
+}
+
+// readBody reads the body of resp. Up to limit bytes it is returned whole,
+// a larger body is written to a file of bodies and only its start is
+// returned, with the id of the file. size is the size of the whole body.
+func readBody(resp *http.Response, limit int64, bodies *ResponseBodies, progress ProgressFunc) (content []byte, size int64, bodyId string, err error) {
+	reader := io.Reader(resp.Body)
+	if progress != nil {
+		counter := &progressReader{reader: resp.Body, total: resp.ContentLength, progress: progress}
+		reader = counter
+		defer counter.finish()
+	}
+
+	content, err = io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil || int64(len(content)) <= limit {
+		return content, int64(len(content)), "", err
+	}
+
+	file, id, err := bodies.create()
+	if err != nil {
+		return nil, 0, "", err
+	}
+	defer file.Close()
+	if _, err := file.Write(content); err != nil {
+		bodies.remove(id)
+		return nil, 0, "", fmt.Errorf("error writing response file: %v", err)
+	}
+	rest, err := io.Copy(file, reader)
+	if err != nil {
+		bodies.remove(id)
+		return nil, 0, "", err
+	}
+	return content[:min(len(content), responsePreviewSize)], int64(len(content)) + rest, id, nil
+}
+
+// textPreview cuts the rune the preview may end in the middle of. It reports
+// false if the preview is not valid UTF-8 otherwise, to show it as binary.
+func textPreview(preview []byte) ([]byte, bool) {
+	for i := len(preview) - 1; i >= 0 && i >= len(preview)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(preview[i]) {
+			if !utf8.FullRune(preview[i:]) {
+				preview = preview[:i]
+			}
+			break
+		}
+	}
+	return preview, utf8.Valid(preview)
+}
+
+// progressReader reports the bytes read at most every progressInterval.
+type progressReader struct {
+	reader   io.Reader
+	total    int64
+	received int64
+	progress ProgressFunc
+	last     time.Time
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.received += int64(n)
+	if time.Since(r.last) >= progressInterval {
+		r.last = time.Now()
+		r.progress(r.received, r.total, false)
+	}
+	return n, err
+}
+
+func (r *progressReader) finish() {
+	r.progress(r.received, r.total, true)
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTextPreview(t *testing.T) {
+	tests := []struct {
+		name    string
+		preview string
+		want    string
+		text    bool
+	}{
+		{"ascii", "hello", "hello", true},
+		{"ends with a full rune", "café", "café", true},
+		{"cut inside a rune", "caf\xc3", "caf", true},
+		{"cut inside a 4 byte rune", "ok \xf0\x9f\x98", "ok ", true},
+		{"empty", "", "", true},
+		{"invalid before the end", "a\xffbcdef", "a\xffbcdef", false},
+		{"invalid last byte", "abc\xff", "abc\xff", false},
+		{"stray continuation bytes", "abc\x80\x80\x80\x80", "abc\x80\x80\x80\x80", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, text := textPreview([]byte(tt.preview))
+			if !bytes.Equal(got, []byte(tt.want)) || text != tt.text {
+				t.Errorf("textPreview(%q) = %q, %v, want %q, %v", tt.preview, got, text, tt.want, tt.text)
+			}
+		})
+	}
+}
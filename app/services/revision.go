@@ -0,0 +1,187 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"posto/app/models"
+	"posto/app/repositories"
+	"strings"
+	"time"
+)
+
+const (
+	// Auto-saves less than revisionCoalesceWindow apart update the same
+	// revision, as long as it was started less than revisionMaxSpan ago.
+	revisionCoalesceWindow = time.Minute
+	revisionMaxSpan        = 10 * time.Minute
+	// revisionLimit is the number of revisions kept per request.
+	revisionLimit = 200
+	// diffMaxCells bounds the size of the line diff table; larger changes
+	// are shown as all lines removed and added.
+	diffMaxCells = 4_000_000
+)
+
+// SaveRequest updates a request and records a revision of it when a
+// revisioned field (name, method, url, headers, body) is written. Saves
+// made with coalesce in quick succession share one revision.
+func SaveRequest(repos *repositories.Repositories, fileId int, data repositories.FileRequestData, coalesce bool) error {
+	revisioned := data.Name != nil || data.Method != nil || data.Url != nil || data.Headers != nil || data.Body != nil
+	if revisioned {
+		if err := repos.Revision.InsertBaselineRevision(fileId); err != nil {
+			return fmt.Errorf("error saving revision: %v", err)
+		}
+	}
+
+	if err := repos.File.UpdateFile(fileId, data); err != nil {
+		return err
+	}
+	if !revisioned {
+		return nil
+	}
+
+	window := time.Duration(0)
+	if coalesce {
+		window = revisionCoalesceWindow
+	}
+	if err := repos.Revision.RecordRevision(fileId, window, revisionMaxSpan); err != nil {
+		return fmt.Errorf("error saving revision: %v", err)
+	}
+	return repos.Revision.PruneRevisions(fileId, revisionLimit)
+}
+
+// RestoreRevision writes a revision back to its request. The restored
+// state becomes a new revision, so a restore can be undone as well.
+func RestoreRevision(repos *repositories.Repositories, revisionId int) error {
+	revision, err := repos.Revision.SelectRevisionById(revisionId)
+	if err != nil {
+		return fmt.Errorf("error loading revision: %v", err)
+	}
+	return SaveRequest(repos, int(revision.FileId), repositories.FileRequestData{
+		Name:    &revision.Name,
+		Method:  &revision.Method,
+		Url:     &revision.Url,
+		Headers: &revision.Headers,
+		Body:    &revision.Body,
+	}, false)
+}
+
+// DiffRevisions compares two revisions field by field.
+func DiffRevisions(from models.Revision, to models.Revision) models.RevisionDiff {
+	diff := models.RevisionDiff{From: from, To: to, Changes: []models.RevisionChange{}}
+	fields := []struct {
+		name     string
+		from, to string
+		lines    func(string) []string
+	}{
+		{"name", from.Name, to.Name, singleLine},
+		{"method", from.Method, to.Method, singleLine},
+		{"url", from.Url, to.Url, singleLine},
+		{"headers", from.Headers, to.Headers, headerLines},
+		{"body", from.Body, to.Body, bodyLines},
+	}
+	for _, field := range fields {
+		if field.from == field.to {
+			continue
+		}
+		diff.Changes = append(diff.Changes, models.RevisionChange{
+			Field: field.name,
+			From:  field.from,
+			To:    field.to,
+			Lines: diffLines(field.lines(field.from), field.lines(field.to)),
+		})
+	}
+	return diff
+}
+
+func singleLine(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+func bodyLines(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, "\n")
+}
+
+// headerLines renders a headers object as sorted "Name: value" lines. Text
+// that is not a JSON object is diffed as is.
+func headerLines(value string) []string {
+	headers := map[string]string{}
+	if err := json.Unmarshal([]byte(value), &headers); err != nil {
+		return bodyLines(value)
+	}
+	lines := []string{}
+	for _, name := range sortedKeys(headers) {
+		lines = append(lines, name+": "+headers[name])
+	}
+	return lines
+}
+
+// diffLines returns a line diff of a and b based on their longest common
+// subsequence.
+func diffLines(a []string, b []string) []models.DiffLine {
+	lines := []models.DiffLine{}
+
+	// the common prefix and suffix need no table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	for _, line := range a[:prefix] {
+		lines = append(lines, models.DiffLine{Op: " ", Text: line})
+	}
+
+	x, y := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if (len(x)+1)*(len(y)+1) > diffMaxCells {
+		for _, line := range x {
+			lines = append(lines, models.DiffLine{Op: "-", Text: line})
+		}
+		for _, line := range y {
+			lines = append(lines, models.DiffLine{Op: "+", Text: line})
+		}
+	} else {
+		// common[i][j] is the length of the LCS of x[i:] and y[j:]
+		common := make([][]int, len(x)+1)
+		for i := range common {
+			common[i] = make([]int, len(y)+1)
+		}
+		for i := len(x) - 1; i >= 0; i-- {
+			for j := len(y) - 1; j >= 0; j-- {
+				if x[i] == y[j] {
+					common[i][j] = common[i+1][j+1] + 1
+				} else {
+					common[i][j] = max(common[i+1][j], common[i][j+1])
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < len(x) || j < len(y) {
+			switch {
+			case i < len(x) && j < len(y) && x[i] == y[j]:
+				lines = append(lines, models.DiffLine{Op: " ", Text: x[i]})
+				i++
+				j++
+			case j < len(y) && (i == len(x) || common[i][j+1] > common[i+1][j]):
+				lines = append(lines, models.DiffLine{Op: "+", Text: y[j]})
+				j++
+			default:
+				lines = append(lines, models.DiffLine{Op: "-", Text: x[i]})
+				i++
+			}
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		lines = append(lines, models.DiffLine{Op: " ", Text: line})
+	}
+	return lines
+}
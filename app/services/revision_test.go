@@ -0,0 +1,44 @@
+package services
+
+import (
+	"posto/app/repositories"
+	"testing"
+)
+
+func TestSaveRequestKeepsBaseline(t *testing.T) {
+	repos := openTestRepositories(t)
+	collectionId, err := repos.Collection.InsertCollection("Revisions")
+	if err != nil {
+		t.Fatalf("InsertCollection: %v", err)
+	}
+	fileId, err := repos.File.CreateFileOrFolder(repositories.FileCreationParam{CollectionId: collectionId, Name: "Get user"})
+	if err != nil {
+		t.Fatalf("CreateFileOrFolder: %v", err)
+	}
+	original := "https://api.test/users/1"
+	if err := repos.File.UpdateFile(*fileId, repositories.FileRequestData{Url: &original}); err != nil {
+		t.Fatalf("UpdateFile: %v", err)
+	}
+
+	// saves right after creating the request coalesce with each other, but
+	// not with the state before the first of them
+	for _, url := range []string{"https://api.test/users/2", "https://api.test/users/3"} {
+		if err := SaveRequest(repos, *fileId, repositories.FileRequestData{Url: &url}, true); err != nil {
+			t.Fatalf("SaveRequest: %v", err)
+		}
+	}
+
+	revisions, err := repos.Revision.SelectRevisionsByFile(*fileId)
+	if err != nil {
+		t.Fatalf("SelectRevisionsByFile: %v", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("got %d revisions, want 2: %+v", len(revisions), revisions)
+	}
+	if latest := revisions[0]; latest.IsBaseline || latest.Url != "https://api.test/users/3" {
+		t.Errorf("latest revision = %+v, want the last save", latest)
+	}
+	if baseline := revisions[1]; !baseline.IsBaseline || baseline.Url != original {
+		t.Errorf("first revision = %+v, want the baseline with %s", baseline, original)
+	}
+}
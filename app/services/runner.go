@@ -0,0 +1,166 @@
+package services
+
+import (
+	"fmt"
+	"posto/app/models"
+	"posto/app/repositories"
+	"strings"
+	"time"
+)
+
+type RunOptions struct {
+	CollectionId int `json:"collection_id"`
+	// FolderId limits the run to the requests below a folder.
+	FolderId      *int `json:"folder_id"`
+	EnvironmentId *int `json:"environment_id"`
+	// Variables override the environment variables for this run.
+	Variables map[string]string `json:"variables"`
+	// Bail stops the run at the first failed request.
+	Bail bool `json:"bail"`
+}
+
+type RequestRunResult struct {
+	FileId     int64                    `json:"file_id"`
+	Name       string                   `json:"name"`
+	Path       []string                 `json:"path"`
+	Method     string                   `json:"method"`
+	Url        string                   `json:"url"`
+	Request    *SentRequest             `json:"request,omitempty"`
+	Response   *models.HttpResponse     `json:"response,omitempty"`
+	Assertions []models.AssertionResult `json:"assertions"`
+	Error      string                   `json:"error,omitempty"`
+	Passed     bool                     `json:"passed"`
+	StartedAt  time.Time                `json:"started_at"`
+	DurationMs int64                    `json:"duration_ms"`
+}
+
+// FullName is the request name prefixed with its folders, e.g. "Users/Get user".
+func (r RequestRunResult) FullName() string {
+	return strings.Join(append(append([]string{}, r.Path...), r.Name), "/")
+}
+
+type RunResult struct {
+	CollectionId    int                `json:"collection_id"`
+	CollectionName  string             `json:"collection_name"`
+	EnvironmentName string             `json:"environment_name,omitempty"`
+	StartedAt       time.Time          `json:"started_at"`
+	DurationMs      int64              `json:"duration_ms"`
+	Requests        []RequestRunResult `json:"requests"`
+	Total           int                `json:"total"`
+	Passed          int                `json:"passed"`
+	Failed          int                `json:"failed"`
+}
+
+func (r RunResult) Success() bool {
+	return r.Failed == 0
+}
+
+// CollectionRunner executes every request of a collection in tree order and
+// evaluates their assertions.
+type CollectionRunner struct {
+	Repositories *repositories.Repositories
+	Executor     *Executor
+}
+
+func NewCollectionRunner(repositories *repositories.Repositories, executor *Executor) *CollectionRunner {
+	return &CollectionRunner{Repositories: repositories, Executor: executor}
+}
+
+func (c *CollectionRunner) Run(options RunOptions) (RunResult, error) {
+	result := RunResult{CollectionId: options.CollectionId, Requests: []RequestRunResult{}}
+
+	collection, err := c.Repositories.Collection.SelectCollectionById(options.CollectionId)
+	if err != nil {
+		return result, fmt.Errorf("error loading collection: %v", err)
+	}
+	result.CollectionName = collection.Name
+
+	vars := map[string]string{}
+	secretValues := []string{}
+	if options.EnvironmentId != nil {
+		environment, err := c.Repositories.Environment.SelectEnvironmentById(*options.EnvironmentId)
+		if err != nil {
+			return result, fmt.Errorf("error loading environment: %v", err)
+		}
+		result.EnvironmentName = environment.Name
+		vars, secretValues, err = RevealVariables(environment)
+		if err != nil {
+			return result, err
+		}
+	}
+	vars = MergeVariables(vars, options.Variables)
+
+	files, err := c.Repositories.File.SelectFilesByCollection(options.CollectionId)
+	if err != nil {
+		return result, fmt.Errorf("error loading files: %v", err)
+	}
+
+	nodes := BuildFileTree(files)
+	if options.FolderId != nil {
+		folder := FindNode(nodes, int64(*options.FolderId))
+		if folder == nil || !folder.File.IsFolder {
+			return result, fmt.Errorf("folder %d not found in collection %q", *options.FolderId, collection.Name)
+		}
+		nodes = folder.Children
+	}
+
+	result.StartedAt = time.Now()
+	WalkRequests(nodes, func(node *FileNode) bool {
+		requestResult := c.runRequest(node, vars, secretValues)
+		result.Requests = append(result.Requests, requestResult)
+		result.Total++
+		if requestResult.Passed {
+			result.Passed++
+		} else {
+			result.Failed++
+		}
+		return requestResult.Passed || !options.Bail
+	})
+	result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+
+	return result, nil
+}
+
+func (c *CollectionRunner) runRequest(node *FileNode, vars map[string]string, secretValues []string) RequestRunResult {
+	data := RequestData(node.File)
+	result := RequestRunResult{
+		FileId:     node.File.PkFileId,
+		Name:       node.File.Name,
+		Path:       node.Path,
+		Method:     "GET",
+		Assertions: []models.AssertionResult{},
+		StartedAt:  time.Now(),
+	}
+	if data.Method != nil && *data.Method != "" {
+		result.Method = strings.ToUpper(*data.Method)
+	}
+	if data.Url != nil {
+		result.Url = MaskSecrets(ResolveVariables(*data.Url, vars), secretValues)
+	}
+
+	assertions, err := ParseAssertions(data.Assertions)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	sent, resp, err := c.Executor.SendWith(data, vars, SendOptions{Secrets: secretValues})
+	result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+	if sent.Method != "" {
+		result.Request = &sent
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Response = &resp
+	result.Assertions = EvaluateAssertions(assertions, resp)
+
+	result.Passed = true
+	for _, assertion := range result.Assertions {
+		if !assertion.Passed {
+			result.Passed = false
+		}
+	}
+	return result
+}
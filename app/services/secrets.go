@@ -0,0 +1,381 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"posto/app/config"
+	"posto/app/models"
+	"posto/app/repositories"
+	"posto/app/secrets"
+	"sort"
+	"strings"
+)
+
+const (
+	SecretMethodPassword = "password"
+	SecretMethodKeyFile  = "key_file"
+	// SecretMask replaces the value of secret variables sent to the UI.
+	// Saving a variable with this value keeps its stored value.
+	SecretMask = "••••••••"
+
+	secretIterations  = 600000
+	secretSaltSize    = 16
+	secretCheckValue  = "posto"
+	minPasswordLength = 8
+)
+
+// SecretStatus reports whether secrets are set up for the open database
+// and whether they are unlocked.
+func SecretStatus(repos *repositories.Repositories) (models.SecretStatus, error) {
+	vault, err := repos.Vault.SelectVault()
+	if err != nil {
+		return models.SecretStatus{}, err
+	}
+	status := models.SecretStatus{Unlocked: secrets.Unlocked()}
+	if vault != nil {
+		status.Configured = true
+		status.Method = vault.Method
+	}
+	return status, nil
+}
+
+// SetupSecrets sets up secret variables for the open database with a master
+// password or a key file, and unlocks them. A key file that does not exist
+// is created with a random key.
+func SetupSecrets(repos *repositories.Repositories, method string, secret string) error {
+	existing, err := repos.Vault.SelectVault()
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("secrets are already set up")
+	}
+
+	salt, err := secrets.RandomBytes(secretSaltSize)
+	if err != nil {
+		return err
+	}
+	vault := models.Vault{Method: method, Salt: base64.StdEncoding.EncodeToString(salt)}
+	switch method {
+	case SecretMethodPassword:
+		if len(secret) < minPasswordLength {
+			return fmt.Errorf("the master password must be at least %d characters long", minPasswordLength)
+		}
+		vault.Iterations = secretIterations
+	case SecretMethodKeyFile:
+		if err := createKeyFile(secret); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown method %q, expected %s or %s", method, SecretMethodPassword, SecretMethodKeyFile)
+	}
+
+	key, err := secretKey(vault, secret)
+	if err != nil {
+		return err
+	}
+	vault.CheckValue, err = secrets.SealWith(key, secretCheckValue)
+	if err != nil {
+		return err
+	}
+	if err := repos.Vault.InsertVault(vault); err != nil {
+		return err
+	}
+	secrets.Unlock(key)
+	return nil
+}
+
+func createKeyFile(path string) error {
+	path = config.ExpandPath(path)
+	if path == "" {
+		return fmt.Errorf("key file path is required")
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	key, err := secrets.RandomBytes(secrets.KeySize)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return fmt.Errorf("error creating key file: %v", err)
+	}
+	return nil
+}
+
+// UnlockSecrets checks the master password or key file path against the
+// vault and keeps the key in memory.
+func UnlockSecrets(repos *repositories.Repositories, secret string) error {
+	vault, err := repos.Vault.SelectVault()
+	if err != nil {
+		return err
+	}
+	if vault == nil {
+		return fmt.Errorf("secrets are not set up")
+	}
+	key, err := secretKey(*vault, secret)
+	if err != nil {
+		return err
+	}
+	if _, err := secrets.OpenWith(key, vault.CheckValue); err != nil {
+		if vault.Method == SecretMethodKeyFile {
+			return fmt.Errorf("wrong key file")
+		}
+		return fmt.Errorf("wrong master password")
+	}
+	secrets.Unlock(key)
+	return nil
+}
+
+// UnlockSecretsOnStart unlocks the secrets of the open database with the
+// secrets_key_file setting or the POSTO_MASTER_PASSWORD environment
+// variable, when they are set up and one of those is given.
+func UnlockSecretsOnStart(repos *repositories.Repositories) error {
+	secrets.Lock()
+	vault, err := repos.Vault.SelectVault()
+	if err != nil || vault == nil {
+		return err
+	}
+	switch {
+	case vault.Method == SecretMethodKeyFile && config.ConfigData != nil && config.ConfigData.Settings.SecretsKeyFile != "":
+		return UnlockSecrets(repos, config.ConfigData.Settings.SecretsKeyFile)
+	case vault.Method == SecretMethodPassword && os.Getenv(config.EnvMasterPassword) != "":
+		return UnlockSecrets(repos, os.Getenv(config.EnvMasterPassword))
+	}
+	return nil
+}
+
+func secretKey(vault models.Vault, secret string) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(vault.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("vault is corrupt: %v", err)
+	}
+	if vault.Method == SecretMethodPassword {
+		return secrets.PasswordKey(secret, salt, vault.Iterations), nil
+	}
+	content, err := os.ReadFile(config.ExpandPath(secret))
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file: %v", err)
+	}
+	return secrets.KeyFileKey([]byte(strings.TrimSpace(string(content))), salt), nil
+}
+
+// MaskVariables returns variables with the value of secrets replaced by
+// SecretMask, empty secrets stay empty.
+func MaskVariables(variables []models.Variable) []models.Variable {
+	masked := []models.Variable{}
+	for _, variable := range variables {
+		if variable.Secret && variable.Value != "" {
+			variable.Value = SecretMask
+		}
+		masked = append(masked, variable)
+	}
+	return masked
+}
+
+// MaskEnvironments applies MaskVariables to every environment.
+func MaskEnvironments(environments []models.Environment) []models.Environment {
+	masked := []models.Environment{}
+	for _, environment := range environments {
+		environment.Variables = MaskVariables(environment.Variables)
+		masked = append(masked, environment)
+	}
+	return masked
+}
+
+// SealVariables prepares variables edited in the UI for storage: secret
+// values are sealed, and SecretMask stands for the value stored in
+// previous under the same key. SecretMask without such a value, e.g. for a
+// renamed secret, is rejected rather than stored in place of the secret.
+// Sealing needs unlocked secrets.
+func SealVariables(variables []models.Variable, previous []models.Variable) ([]models.Variable, error) {
+	stored := map[string]models.Variable{}
+	for _, variable := range previous {
+		stored[variable.Key] = variable
+	}
+
+	sealed := []models.Variable{}
+	for _, variable := range variables {
+		old, hasOld := stored[variable.Key]
+		keep := variable.Value == SecretMask && hasOld && old.Secret
+		if variable.Value == SecretMask && !keep {
+			return nil, fmt.Errorf("variable %q has no stored secret to keep, enter its value again", variable.Key)
+		}
+		switch {
+		case variable.Secret && keep:
+			variable.Value = old.Value
+		case variable.Secret && variable.Value != "":
+			value, err := secrets.Seal(variable.Value)
+			if err != nil {
+				return nil, err
+			}
+			variable.Value = value
+		case !variable.Secret && keep:
+			// no longer a secret, stored in plain text again
+			value, err := secrets.Open(old.Value)
+			if err != nil {
+				return nil, err
+			}
+			variable.Value = value
+		}
+		sealed = append(sealed, variable)
+	}
+	return sealed, nil
+}
+
+// RevealVariables is Environment.VariableMap including the decrypted
+// secrets, for sending requests. The secret values are also returned, to
+// be passed as SendOptions.Secrets. It fails when an enabled secret is set
+// and secrets are locked.
+func RevealVariables(environment models.Environment) (map[string]string, []string, error) {
+	vars := environment.VariableMap()
+	values := []string{}
+	for _, variable := range environment.Variables {
+		if !variable.Secret || !variable.Enabled || variable.Key == "" {
+			continue
+		}
+		if variable.Value == "" {
+			vars[variable.Key] = ""
+			continue
+		}
+		value, err := secrets.Open(variable.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("secret variable %q: %v", variable.Key, err)
+		}
+		vars[variable.Key] = value
+		values = append(values, value)
+	}
+	return vars, values, nil
+}
+
+// MaskSecrets replaces the secret values in text with SecretMask, also
+// when they were URL encoded. Longer values are replaced first so that a
+// secret containing another one is masked whole.
+func MaskSecrets(text string, values []string) string {
+	if text == "" || len(values) == 0 {
+		return text
+	}
+	sorted := append([]string{}, values...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, value := range sorted {
+		if value == "" {
+			continue
+		}
+		path := (&url.URL{Path: value}).EscapedPath()
+		for _, form := range []string{value, url.QueryEscape(value), url.PathEscape(value), path} {
+			text = strings.ReplaceAll(text, form, SecretMask)
+		}
+	}
+	return text
+}
+
+func maskSentRequest(sent SentRequest, values []string) SentRequest {
+	if len(values) == 0 {
+		return sent
+	}
+	sent.Url = MaskSecrets(sent.Url, values)
+	headers := map[string]string{}
+	for name, value := range sent.Headers {
+		headers[name] = MaskSecrets(value, values)
+	}
+	sent.Headers = headers
+	sent.Body = MaskSecrets(sent.Body, values)
+	return sent
+}
+
+func maskWire(wire []models.WireExchange, values []string) []models.WireExchange {
+	if len(values) == 0 || wire == nil {
+		return wire
+	}
+	masked := []models.WireExchange{}
+	for _, exchange := range wire {
+		exchange.Request = MaskSecrets(exchange.Request, values)
+		// servers echo secrets back, e.g. in Set-Cookie or Location
+		exchange.Response = MaskSecrets(exchange.Response, values)
+		exchange.Error = MaskSecrets(exchange.Error, values)
+		masked = append(masked, exchange)
+	}
+	return masked
+}
+
+// maskError masks the secrets in the message of err, keeping what it
+// wraps for errors.As.
+func maskError(err error, values []string) error {
+	if err == nil || len(values) == 0 {
+		return err
+	}
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		masked := &RequestError{Message: MaskSecrets(reqErr.Message, values)}
+		if reqErr.Err != nil {
+			masked.Err = &maskedError{err: reqErr.Err, message: MaskSecrets(reqErr.Err.Error(), values)}
+		}
+		return masked
+	}
+	return &maskedError{err: err, message: MaskSecrets(err.Error(), values)}
+}
+
+type maskedError struct {
+	err     error
+	message string
+}
+
+func (e *maskedError) Error() string {
+	return e.message
+}
+
+func (e *maskedError) Unwrap() error {
+	return e.err
+}
+
+// exportVariables returns variables for a file leaving posto: secrets are
+// emptied, or decrypted with includeSecrets.
+func exportVariables(variables []models.Variable, includeSecrets bool) ([]models.Variable, error) {
+	exported := []models.Variable{}
+	for _, variable := range variables {
+		if variable.Secret && variable.Value != "" {
+			if !includeSecrets {
+				variable.Value = ""
+			} else {
+				value, err := secrets.Open(variable.Value)
+				if err != nil {
+					return nil, fmt.Errorf("secret variable %q: %v", variable.Key, err)
+				}
+				variable.Value = value
+			}
+		}
+		exported = append(exported, variable)
+	}
+	return exported, nil
+}
+
+// importVariables seals the secrets of imported variables. They are
+// imported empty, with a warning, while secrets are locked.
+func importVariables(environmentName string, variables []models.Variable, report *ImportReport) ([]models.Variable, error) {
+	imported := []models.Variable{}
+	for _, variable := range variables {
+		if variable.Secret && variable.Value != "" {
+			switch {
+			case secrets.IsSealed(variable.Value):
+				// sealed with the key of another database
+				report.Warn("secret variable %q of environment %q was imported without its value, export it with secrets to keep it", variable.Key, environmentName)
+				variable.Value = ""
+			case !secrets.Unlocked():
+				report.Warn("secret variable %q of environment %q was imported without its value, unlock secrets before importing to keep it", variable.Key, environmentName)
+				variable.Value = ""
+			default:
+				value, err := secrets.Seal(variable.Value)
+				if err != nil {
+					return nil, err
+				}
+				variable.Value = value
+			}
+		}
+		imported = append(imported, variable)
+	}
+	return imported, nil
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"errors"
+	"posto/app/models"
+	"posto/app/secrets"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func unlockTestSecrets(t *testing.T) {
+	t.Helper()
+	secrets.Unlock(secrets.PasswordKey("test password", []byte("salt"), 1))
+	t.Cleanup(secrets.Lock)
+}
+
+func sealTestValue(t *testing.T, value string) string {
+	t.Helper()
+	sealed, err := secrets.Seal(value)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	return sealed
+}
+
+func TestSealVariables(t *testing.T) {
+	unlockTestSecrets(t)
+	storedToken := sealTestValue(t, "s3cret")
+	previous := []models.Variable{
+		{Key: "base", Value: "https://api.test", Enabled: true},
+		{Key: "token", Value: storedToken, Enabled: true, Secret: true},
+	}
+
+	tests := []struct {
+		name     string
+		variable models.Variable
+		// want is the plain value stored, sealed when the variable is secret
+		want    string
+		wantErr string
+	}{
+		{name: "plain", variable: models.Variable{Key: "base", Value: "https://other.test"}, want: "https://other.test"},
+		{name: "new secret", variable: models.Variable{Key: "password", Value: "p", Secret: true}, want: "p"},
+		{name: "empty secret", variable: models.Variable{Key: "password", Secret: true}, want: ""},
+		{name: "mask keeps the secret", variable: models.Variable{Key: "token", Value: SecretMask, Secret: true}, want: "s3cret"},
+		{name: "new value replaces the secret", variable: models.Variable{Key: "token", Value: "new", Secret: true}, want: "new"},
+		{name: "mask of a secret made plain", variable: models.Variable{Key: "token", Value: SecretMask}, want: "s3cret"},
+		{name: "mask of a renamed secret", variable: models.Variable{Key: "api_token", Value: SecretMask, Secret: true}, wantErr: `variable "api_token" has no stored secret`},
+		{name: "mask of a plain variable", variable: models.Variable{Key: "base", Value: SecretMask, Secret: true}, wantErr: `variable "base" has no stored secret`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := SealVariables([]models.Variable{tt.variable}, previous)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("SealVariables error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SealVariables: %v", err)
+			}
+
+			got := sealed[0].Value
+			if tt.variable.Secret && got != "" {
+				if !secrets.IsSealed(got) {
+					t.Fatalf("secret stored as %q, not sealed", got)
+				}
+				if got, err = secrets.Open(got); err != nil {
+					t.Fatalf("Open: %v", err)
+				}
+			}
+			if got != tt.want {
+				t.Errorf("stored %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// the mask keeps the stored value as is, it is not sealed again
+	sealed, err := SealVariables([]models.Variable{{Key: "token", Value: SecretMask, Secret: true}}, previous)
+	if err != nil || sealed[0].Value != storedToken {
+		t.Errorf("SealVariables with the mask = %v, %v, want the stored value", sealed, err)
+	}
+}
+
+func TestSealVariablesLocked(t *testing.T) {
+	secrets.Lock()
+	_, err := SealVariables([]models.Variable{{Key: "token", Value: "s3cret", Secret: true}}, nil)
+	if !errors.Is(err, secrets.ErrLocked) {
+		t.Errorf("SealVariables while locked = %v, want ErrLocked", err)
+	}
+}
+
+func TestRevealVariables(t *testing.T) {
+	unlockTestSecrets(t)
+	environment := models.Environment{Variables: []models.Variable{
+		{Key: "base", Value: "https://api.test", Enabled: true},
+		{Key: "token", Value: sealTestValue(t, "s3cret"), Enabled: true, Secret: true},
+		{Key: "empty", Value: "", Enabled: true, Secret: true},
+		{Key: "disabled", Value: sealTestValue(t, "unused"), Enabled: false, Secret: true},
+	}}
+
+	vars, values, err := RevealVariables(environment)
+	if err != nil {
+		t.Fatalf("RevealVariables: %v", err)
+	}
+	wantVars := map[string]string{"base": "https://api.test", "token": "s3cret", "empty": ""}
+	if !reflect.DeepEqual(vars, wantVars) {
+		t.Errorf("vars = %v, want %v", vars, wantVars)
+	}
+	if !reflect.DeepEqual(values, []string{"s3cret"}) {
+		t.Errorf("secret values = %q, want [s3cret]", values)
+	}
+
+	secrets.Lock()
+	if _, _, err := RevealVariables(environment); err == nil || !strings.Contains(err.Error(), secrets.ErrLocked.Error()) {
+		t.Errorf("RevealVariables while locked = %v, want ErrLocked", err)
+	}
+}
+
+func TestMaskSecrets(t *testing.T) {
+	values := []string{"s3cret", "a/b c", "s3cret-long"}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", ""},
+		{"Bearer s3cret", "Bearer " + SecretMask},
+		{"key=s3cret-long", "key=" + SecretMask},
+		{"https://api.test/a/b%20c?q=a%2Fb+c", "https://api.test/" + SecretMask + "?q=" + SecretMask},
+		{"nothing to hide", "nothing to hide"},
+	}
+	for _, tt := range tests {
+		if got := MaskSecrets(tt.text, values); got != tt.want {
+			t.Errorf("MaskSecrets(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMaskWire(t *testing.T) {
+	values := []string{"s3cret"}
+	wire := []models.WireExchange{{
+		Request:  "GET /login?token=s3cret HTTP/1.1\r\nAuthorization: Bearer s3cret\r\n",
+		Response: "HTTP/1.1 302 Found\r\nLocation: /home?token=s3cret\r\nSet-Cookie: session=s3cret\r\n",
+		Error:    "redirect to /home?token=s3cret failed",
+	}}
+	want := []models.WireExchange{{
+		Request:  "GET /login?token=" + SecretMask + " HTTP/1.1\r\nAuthorization: Bearer " + SecretMask + "\r\n",
+		Response: "HTTP/1.1 302 Found\r\nLocation: /home?token=" + SecretMask + "\r\nSet-Cookie: session=" + SecretMask + "\r\n",
+		Error:    "redirect to /home?token=" + SecretMask + " failed",
+	}}
+	if got := maskWire(wire, values); !reflect.DeepEqual(got, want) {
+		t.Errorf("maskWire() =\n%q\nwant\n%q", got, want)
+	}
+	if wire[0].Response == want[0].Response {
+		t.Error("maskWire changed the exchanges passed to it")
+	}
+}
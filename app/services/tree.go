@@ -0,0 +1,113 @@
+package services
+
+import (
+	"posto/app/models"
+	"posto/app/repositories"
+)
+
+// FileNode is a file or folder of a collection together with its children.
+type FileNode struct {
+	File models.File `json:"file"`
+	// Path holds the names of the enclosing folders, outermost first.
+	Path     []string    `json:"path"`
+	Children []*FileNode `json:"children"`
+}
+
+// BuildFileTree nests the flat rows returned by FileRepo.SelectFilesByCollection.
+// The relative order of the rows is kept for siblings.
+func BuildFileTree(files []models.File) []*FileNode {
+	nodes := map[int64]*FileNode{}
+	for _, file := range files {
+		nodes[file.PkFileId] = &FileNode{File: file, Children: []*FileNode{}}
+	}
+
+	roots := []*FileNode{}
+	for _, file := range files {
+		node := nodes[file.PkFileId]
+		if file.ParentId == nil {
+			roots = append(roots, node)
+			continue
+		}
+		parent, ok := nodes[*file.ParentId]
+		if !ok {
+			// orphaned rows are treated as top level items
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+
+	setPaths(roots, []string{})
+	return roots
+}
+
+func setPaths(nodes []*FileNode, path []string) {
+	for _, node := range nodes {
+		node.Path = path
+		if node.File.IsFolder {
+			childPath := append(append([]string{}, path...), node.File.Name)
+			setPaths(node.Children, childPath)
+		}
+	}
+}
+
+// WalkRequests calls fn for every request (non folder) node depth first.
+// Returning false from fn stops the walk.
+func WalkRequests(nodes []*FileNode, fn func(node *FileNode) bool) bool {
+	for _, node := range nodes {
+		if node.File.IsFolder {
+			if !WalkRequests(node.Children, fn) {
+				return false
+			}
+			continue
+		}
+		if !fn(node) {
+			return false
+		}
+	}
+	return true
+}
+
+// FindNode returns the node with the given file id, or nil.
+func FindNode(nodes []*FileNode, fileId int64) *FileNode {
+	for _, node := range nodes {
+		if node.File.PkFileId == fileId {
+			return node
+		}
+		if found := FindNode(node.Children, fileId); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// FindFolderByName returns the first folder with the given name, searching
+// depth first.
+func FindFolderByName(nodes []*FileNode, name string) *FileNode {
+	for _, node := range nodes {
+		if !node.File.IsFolder {
+			continue
+		}
+		if node.File.Name == name {
+			return node
+		}
+		if found := FindFolderByName(node.Children, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// RequestData converts a request file row into the shape used by FileRepo.
+func RequestData(file models.File) repositories.FileRequestData {
+	name := file.Name
+	return repositories.FileRequestData{
+		Name:       &name,
+		Method:     file.Method,
+		Url:        file.Url,
+		Headers:    file.Headers,
+		Body:       file.Body,
+		Assertions: file.Assertions,
+		Mock:       file.Mock,
+	}
+}
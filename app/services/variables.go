@@ -0,0 +1,39 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+var variablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.\-]+)\s*\}\}`)
+
+// ResolveVariables replaces every {{name}} placeholder in s with its value
+// from vars. Unknown placeholders are left untouched so they remain visible
+// in the outgoing request.
+func ResolveVariables(s string, vars map[string]string) string {
+	if len(vars) == 0 || !strings.Contains(s, "{{") {
+		return s
+	}
+	return variablePattern.ReplaceAllStringFunc(s, func(match string) string {
+		name := variablePattern.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// MergeVariables returns a new map holding base overridden by every
+// non-nil overrides map in order.
+func MergeVariables(base map[string]string, overrides ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for k, v := range base {
+		merged[k] = v
+	}
+	for _, override := range overrides {
+		for k, v := range override {
+			merged[k] = v
+		}
+	}
+	return merged
+}
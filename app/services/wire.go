@@ -0,0 +1,101 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"posto/app/models"
+	"strings"
+	"sync"
+)
+
+// maxWireBody is the number of bytes of a request body kept in a wire
+// exchange.
+const maxWireBody = 64 << 10
+
+// wireTransport records every round trip of one request, redirects
+// included. The headers are the ones the transport actually wrote, which
+// adds Host, User-Agent, Content-Length, Accept-Encoding… to the request.
+type wireTransport struct {
+	base      http.RoundTripper
+	mu        sync.Mutex
+	exchanges []models.WireExchange
+}
+
+func newWireTransport(base http.RoundTripper) *wireTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &wireTransport{base: base}
+}
+
+func (t *wireTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the header fields may be written by the transport's goroutine
+	var mu sync.Mutex
+	fields := []string{}
+	trace := &httptrace.ClientTrace{
+		WroteHeaderField: func(key string, value []string) {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, v := range value {
+				fields = append(fields, key+": "+v)
+			}
+		},
+	}
+	resp, err := t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+
+	proto := req.Proto
+	if resp != nil {
+		proto = resp.Proto
+	}
+	var request strings.Builder
+	fmt.Fprintf(&request, "%s %s %s\r\n", req.Method, req.URL.RequestURI(), proto)
+	mu.Lock()
+	for _, field := range fields {
+		request.WriteString(field + "\r\n")
+	}
+	mu.Unlock()
+	request.WriteString("\r\n")
+	request.WriteString(wireBody(req))
+
+	exchange := models.WireExchange{Request: request.String()}
+	if err != nil {
+		exchange.Error = err.Error()
+	} else if head, dumpErr := httputil.DumpResponse(resp, false); dumpErr == nil {
+		exchange.Response = string(head)
+	}
+
+	t.mu.Lock()
+	t.exchanges = append(t.exchanges, exchange)
+	t.mu.Unlock()
+	return resp, err
+}
+
+func (t *wireTransport) Exchanges() []models.WireExchange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]models.WireExchange{}, t.exchanges...)
+}
+
+// wireBody reads a copy of the request body, which the transport has
+// consumed already.
+func wireBody(req *http.Request) string {
+	if req.GetBody == nil {
+		return ""
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+	content, err := io.ReadAll(io.LimitReader(body, maxWireBody+1))
+	if err != nil {
+		return ""
+	}
+	if len(content) > maxWireBody {
+		return fmt.Sprintf("%s… (truncated at %d bytes)", content[:maxWireBody], maxWireBody)
+	}
+	return string(content)
+}
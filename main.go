@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
 	"embed"
-	"fmt"
+	"log/slog"
+	"os"
 	"posto/app/api"
+	"posto/app/cli"
 	"posto/app/config"
 	"posto/app/db"
+	"posto/app/logging"
+	"posto/app/redact"
 	"posto/app/repositories"
+	"posto/app/services"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -17,33 +23,79 @@ import (
 var assets embed.FS
 
 func main() {
+	// log records are redacted once the settings are loaded, and go to
+	// the log file once it is set up
+	slog.SetDefault(slog.New(redact.NewHandler(slog.NewTextHandler(os.Stderr, nil))))
+
+	// Headless subcommands (e.g. `posto run`) never start the window
+	if cli.IsCommand(os.Args[1:]) {
+		os.Exit(cli.Main(os.Args[1:]))
+	}
+
 	// Create an instance of the app structure
 	app := NewApp()
 
 	// Setup config
 	_, err := config.NewConfig()
 	if err != nil {
-		fmt.Println("Error setting up config:", err)
+		slog.Error("Error setting up config", "error", err)
 		return
 	}
 
+	// the app still runs when the log file cannot be written
+	if err := logging.Setup(config.ConfigData.LogDir, os.Stderr, nil); err != nil {
+		slog.Error("Error setting up logging", "error", err)
+	}
+	slog.Info("Starting posto", "workspace", config.ConfigData.Workspace, "database", config.ConfigData.DBPath)
+
+	// invalid settings are reset to their defaults and shown in the UI
+	if problems := config.ConfigData.LoadProblems(); len(problems) > 0 {
+		slog.Warn("Invalid settings reset to their defaults", "path", config.ConfigData.SettingsPath, "problems", config.FormatProblems(problems))
+	}
+
 	// init db
 	DB, err := db.InitDB()
 	if err != nil {
-		fmt.Println("Error initializing database:", err)
+		slog.Error("Error initializing database", "error", err)
 		return
 	}
 
-	// run migrations
-	err = db.Migrate()
-	if err != nil {
-		fmt.Println("Error running migrations:", err)
+	// a corrupt database is reported but still opened, so that a backup
+	// can be restored from the app. It is not migrated, which would write
+	// to it and back it up as if it were sound; restoring migrates.
+	if err := db.CheckIntegrity(); err != nil {
+		slog.Error("Database integrity check failed, skipping migrations", "error", err)
+	} else if err := db.Migrate(); err != nil {
+		slog.Error("Error running migrations", "error", err)
 		return
 	}
 
 	// Create repositories
 	Repositories := repositories.NewRepositories(DB)
 
+	// search still works without the index, just slower
+	if err := Repositories.Search.EnsureSearchIndex(); err != nil {
+		slog.Warn("Error creating search index", "error", err)
+	}
+
+	// unlock secret variables with the key file or master password given
+	// in the settings or environment, otherwise the UI asks for them
+	if err := services.UnlockSecretsOnStart(Repositories); err != nil {
+		slog.Warn("Error unlocking secrets", "error", err)
+	}
+
+	// empty the trash of items older than the retention period
+	if err := Repositories.Trash.PurgeTrash(config.ConfigData.TrashRetention); err != nil {
+		slog.Warn("Error purging trash", "error", err)
+	}
+
+	// delete history older than the retention period, if one is set
+	if config.ConfigData.HistoryRetention > 0 {
+		if err := Repositories.History.PruneHistory(config.ConfigData.HistoryRetention); err != nil {
+			slog.Warn("Error pruning history", "error", err)
+		}
+	}
+
 	// Create api
 	Api := api.NewApi(Repositories)
 
@@ -56,15 +108,36 @@ func main() {
 			Assets: assets,
 		},
 		BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
-		OnStartup:        app.startup,
+		OnStartup: func(ctx context.Context) {
+			app.startup(ctx)
+			Api.Startup(ctx)
+		},
+		OnShutdown: func(ctx context.Context) {
+			Api.Shutdown()
+			Api.Executor.Bodies.RemoveAll()
+		},
 		Bind: []interface{}{
 			app,
 			Api.CollectionApi,
 			Api.FileApi,
+			Api.EnvironmentApi,
+			Api.MockServerApi,
+			Api.ExampleApi,
+			Api.ProxyApi,
+			Api.HistoryApi,
+			Api.MirrorApi,
+			Api.SearchApi,
+			Api.RevisionApi,
+			Api.TrashApi,
+			Api.BackupApi,
+			Api.WorkspaceApi,
+			Api.SettingsApi,
+			Api.SecretApi,
+			Api.LogApi,
 		},
 	})
 
 	if err != nil {
-		println("Error:", err.Error())
+		slog.Error("Error running app", "error", err)
 	}
 }